@@ -73,8 +73,43 @@ type Actions interface {
 	Stop()
 }
 
+// OutputActions are optional Actions for styled and buffered output,
+// implemented by the Actions of the shell. Context provides them for any
+// Actions, falling back to plain output.
+type OutputActions interface {
+	// Errorln prints an error message, prefixed with "Error:" and styled
+	// with the theme's error style.
+	Errorln(val ...interface{})
+	// Warnln prints a warning styled with the theme's warning style.
+	Warnln(val ...interface{})
+	// Flush writes out output buffered by Shell.BufferOutput. It is a no-op
+	// when output is not buffered.
+	Flush() error
+}
+
+// errorln prints an error message with a, see OutputActions.Errorln.
+func errorln(a Actions, val ...interface{}) {
+	if o, ok := a.(OutputActions); ok {
+		o.Errorln(val...)
+		return
+	}
+	a.Println(append([]interface{}{"Error:"}, val...)...)
+}
+
+// warnln prints a warning with a, see OutputActions.Warnln.
+func warnln(a Actions, val ...interface{}) {
+	if o, ok := a.(OutputActions); ok {
+		o.Warnln(val...)
+		return
+	}
+	a.Println(val...)
+}
+
 type shellActionsImpl struct {
 	*Shell
+	// output captures everything printed instead of the shell's writer,
+	// e.g. for commands run by ProcessBatch. nil means no capture.
+	output io.Writer
 }
 
 // ReadLine reads a line from standard input.
@@ -95,10 +130,12 @@ func (s *shellActionsImpl) ReadLineWithDefault(defaultValue string) string {
 }
 
 func (s *shellActionsImpl) ReadPassword() string {
+	s.flush()
 	return s.reader.readPassword()
 }
 
 func (s *shellActionsImpl) ReadPasswordErr() (string, error) {
+	s.flush()
 	return s.reader.readPasswordErr()
 }
 
@@ -117,22 +154,44 @@ func (s *shellActionsImpl) ReadMultiLines(terminator string) string {
 }
 
 func (s *shellActionsImpl) Println(val ...interface{}) {
-	s.reader.buf.Truncate(0)
+	if s.output != nil {
+		fmt.Fprintln(s.output, val...)
+		return
+	}
+	s.reader.buf.Reset()
 	fmt.Fprintln(s.writer, val...)
 }
 
 func (s *shellActionsImpl) Print(val ...interface{}) {
-	s.reader.buf.Truncate(0)
+	if s.output != nil {
+		fmt.Fprint(s.output, val...)
+		return
+	}
+	s.reader.buf.Reset()
 	fmt.Fprint(s.reader.buf, val...)
 	fmt.Fprint(s.writer, val...)
 }
 
 func (s *shellActionsImpl) Printf(format string, val ...interface{}) {
-	s.reader.buf.Truncate(0)
+	if s.output != nil {
+		fmt.Fprintf(s.output, format, val...)
+		return
+	}
+	s.reader.buf.Reset()
 	fmt.Fprintf(s.reader.buf, format, val...)
 	fmt.Fprintf(s.writer, format, val...)
 }
 
+func (s *shellActionsImpl) Errorln(val ...interface{}) {
+	text := "Error: " + strings.TrimSuffix(fmt.Sprintln(val...), "\n")
+	s.Println(styled(s.Theme().Error, text))
+}
+
+func (s *shellActionsImpl) Warnln(val ...interface{}) {
+	text := strings.TrimSuffix(fmt.Sprintln(val...), "\n")
+	s.Println(styled(s.Theme().Warning, text))
+}
+
 func (s *shellActionsImpl) MultiChoice(options []string, text string) int {
 	choice := s.multiChoice(options, text, nil, false)
 	return choice[0]
@@ -142,7 +201,7 @@ func (s *shellActionsImpl) Checklist(options []string, text string, init []int)
 }
 func (s *shellActionsImpl) SetPrompt(prompt string) {
 	s.reader.prompt = prompt
-	s.reader.scanner.SetPrompt(s.reader.rlPrompt())
+	s.reader.updatePrompt()
 }
 
 func (s *shellActionsImpl) SetMultiPrompt(prompt string) {
@@ -160,15 +219,11 @@ func (s *shellActionsImpl) SetChecklistOptions(open, selected string) {
 
 func (s *shellActionsImpl) ShowPrompt(show bool) {
 	s.reader.showPrompt = show
-	s.reader.scanner.SetPrompt(s.reader.rlPrompt())
+	s.reader.updatePrompt()
 }
 
 func (s *shellActionsImpl) Cmds() []*Cmd {
-	var cmds []*Cmd
-	for _, cmd := range s.rootCmd.children {
-		cmds = append(cmds, cmd)
-	}
-	return cmds
+	return append(s.rootCmd.added(), s.rootCmd.provided()...)
 }
 
 func (s *shellActionsImpl) ClearScreen() error {
@@ -176,19 +231,35 @@ func (s *shellActionsImpl) ClearScreen() error {
 }
 
 func (s *shellActionsImpl) ShowPaged(text string) error {
-	return showPagedReader(s.Shell, strings.NewReader(text))
+	return s.ShowPagedReader(strings.NewReader(text))
 }
 
 func (s *shellActionsImpl) ShowPagedReader(r io.Reader) error {
+	if s.output != nil {
+		// captured output cannot be scrolled, keep it as is.
+		_, err := io.Copy(s.output, r)
+		return err
+	}
+	if s.checkRestricted(RestrictExec) != nil {
+		_, err := io.Copy(s.writer, r)
+		return err
+	}
 	return showPagedReader(s.Shell, r)
 }
 
+func (s *shellActionsImpl) Flush() error {
+	if s.output != nil {
+		return nil
+	}
+	return s.flush()
+}
+
 func (s *shellActionsImpl) Stop() {
 	s.stop()
 }
 
 func (s *shellActionsImpl) HelpText() string {
-	return s.rootCmd.HelpText()
+	return s.helpText(s.rootCmd)
 }
 
 func showPagedReader(s *Shell, r io.Reader) error {
@@ -202,6 +273,10 @@ func showPagedReader(s *Shell, r io.Reader) error {
 		}
 	}
 
+	// the pager takes over the terminal, write out what came before it.
+	s.flush()
+	defer s.flush()
+
 	cmd = exec.Command(s.pager, s.pagerArgs...)
 	cmd.Stdout = s.writer
 	cmd.Stderr = s.writer
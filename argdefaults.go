@@ -0,0 +1,139 @@
+package ishell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// argDefaults holds default argument values set on the shell, keyed by
+// command path (e.g. "net ping") and argument key.
+type argDefaults struct {
+	values map[string]map[string][]string
+	sync.RWMutex
+}
+
+// SetArgDefault sets the default values of the argument key of the command
+// at path, e.g. SetArgDefault("deploy", "--region", "eu-west-1"). They are
+// used when the argument is not given and take precedence over
+// CmdArg.Default.
+func (s *Shell) SetArgDefault(path string, key string, values ...string) {
+	s.argDefaults.Lock()
+	defer s.argDefaults.Unlock()
+	if s.argDefaults.values == nil {
+		s.argDefaults.values = make(map[string]map[string][]string)
+	}
+	if s.argDefaults.values[path] == nil {
+		s.argDefaults.values[path] = make(map[string][]string)
+	}
+	s.argDefaults.values[path][key] = values
+}
+
+// LoadArgDefaults reads default argument values from a YAML (or JSON) file
+// mapping command paths to argument keys and values, e.g.
+//
+//	deploy:
+//	  --region: eu-west-1
+//	net ping:
+//	  --count: 3
+//	  --tag: [a, b]
+//
+// Keys are the long flags or positional names of the arguments. Unknown
+// commands and keys are an error, and nothing is set. It returns
+// ErrRestricted if the shell is restricted with RestrictFiles. See
+// SetArgDefault.
+func (s *Shell) LoadArgDefaults(path string) error {
+	if err := s.checkRestricted(RestrictFiles); err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file map[string]map[string]interface{}
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	defaults := make(map[string]map[string][]string)
+	for cmdPath, args := range file {
+		parser, name, err := s.argDefaultsParser(cmdPath)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if defaults[name] == nil {
+			defaults[name] = make(map[string][]string)
+		}
+		for key, value := range args {
+			if _, ok := parser.argmap[key]; !ok {
+				if is_short_arg(key) && !is_long_arg(key) {
+					return fmt.Errorf("%s: %s: use the long flag instead of %s", path, cmdPath, key)
+				}
+				return fmt.Errorf("%s: %s: unknown argument %s", path, cmdPath, key)
+			}
+			var values []string
+			switch v := value.(type) {
+			case []interface{}:
+				for _, item := range v {
+					values = append(values, fmt.Sprint(item))
+				}
+			default:
+				values = []string{fmt.Sprint(v)}
+			}
+			defaults[name][key] = values
+		}
+	}
+	for cmdPath, args := range defaults {
+		for key, values := range args {
+			s.SetArgDefault(cmdPath, key, values...)
+		}
+	}
+	return nil
+}
+
+// argDefaultsParser returns the command at the path of words cmdPath with
+// the arguments it inherits, and the path by the names of the commands.
+func (s *Shell) argDefaultsParser(cmdPath string) (*Cmd, string, error) {
+	words := strings.Fields(cmdPath)
+	path, n := s.rootCmd.findPath(words)
+	if len(words) == 0 || n != len(words) {
+		return nil, "", fmt.Errorf("unknown command %q", cmdPath)
+	}
+	names := make([]string, len(path))
+	for i, cmd := range path {
+		names[i] = cmd.Name
+	}
+	ancestors := append([]*Cmd{s.rootCmd}, path[:len(path)-1]...)
+	return path[len(path)-1].inherit(ancestors), strings.Join(names, " "), nil
+}
+
+// argDefaultsFor returns a copy of the default argument values of the
+// command found for line, args being the words of line left after the
+// command.
+func (s *Shell) argDefaultsFor(line []string, args []string) map[string][]string {
+	s.argDefaults.RLock()
+	defer s.argDefaults.RUnlock()
+	if len(s.argDefaults.values) == 0 {
+		return nil
+	}
+	words := line[:len(line)-len(args)]
+	path, n := s.rootCmd.findPath(words)
+	if n != len(words) {
+		return nil
+	}
+	var names []string
+	for _, cmd := range path {
+		names = append(names, cmd.Name)
+	}
+	values := s.argDefaults.values[strings.Join(names, " ")]
+	if values == nil {
+		return nil
+	}
+	defaults := make(map[string][]string, len(values))
+	for key, value := range values {
+		defaults[key] = append([]string(nil), value...)
+	}
+	return defaults
+}
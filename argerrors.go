@@ -0,0 +1,72 @@
+package ishell
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by ParseArgs for invalid input. Use errors.Is to check for
+// them, the messages also name the argument and value at fault.
+var (
+	// ErrUnknownFlag is returned for an argument that matches no flag and
+	// no positional argument.
+	ErrUnknownFlag = errors.New("unknown argument")
+	// ErrAmbiguousFlag is returned for an abbreviated long flag that
+	// matches several flags.
+	ErrAmbiguousFlag = errors.New("ambiguous flag")
+	// ErrMissingValue is returned for a flag that is not followed by its
+	// value.
+	ErrMissingValue = errors.New("missing value")
+	// ErrInvalidInt is returned for an IntType value that is not an
+	// integer.
+	ErrInvalidInt = errors.New("invalid integer")
+	// ErrInvalidValue is returned for other values that are not valid for
+	// their type, choices or validator.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrTooManyValues is returned for an argument given more than once
+	// that cannot have multiple values.
+	ErrTooManyValues = errors.New("too many values")
+)
+
+// ErrMissingRequired is returned by ParseArgs when a required argument is
+// not given, or an argument another one requires.
+type ErrMissingRequired struct {
+	// Arg is the key of the missing argument.
+	Arg string
+	// RequiredBy is the key of the argument that requires Arg, if Arg is
+	// not required by itself.
+	RequiredBy string
+}
+
+func (e *ErrMissingRequired) Error() string {
+	if e.RequiredBy != "" {
+		return fmt.Sprintf("Argument '%s' requires '%s'", e.RequiredBy, e.Arg)
+	}
+	return fmt.Sprintf("%s is a required argument", e.Arg)
+}
+
+// parseError is an error in the input to ParseArgs with a detailed message.
+type parseError struct {
+	err error
+	msg string
+}
+
+func newParseError(err error, format string, a ...interface{}) error {
+	return &parseError{err: err, msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *parseError) Error() string {
+	return e.msg
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// IsParseError tells if err is caused by invalid input to ParseArgs, as
+// opposed to an invalid definition of the arguments.
+func IsParseError(err error) bool {
+	var pe *parseError
+	var mr *ErrMissingRequired
+	return errors.As(err, &pe) || errors.As(err, &mr)
+}
@@ -0,0 +1,162 @@
+package ishell
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ArgOption configures an argument created with NewArg.
+type ArgOption func(arg *CmdArg)
+
+// NewArg creates an argument with the given long flag and type configured by
+// opts. It is NewCmdArg with the flags spelled out, e.g.
+//
+//	NewArg("--env", StringType, WithShort("-e"), Required(), WithHelp("target environment"))
+//
+// longFlag without leading dashes declares a positional argument.
+func NewArg(longFlag string, typ ArgType, opts ...ArgOption) (*CmdArg, error) {
+	arg := &CmdArg{}
+	for _, opt := range opts {
+		opt(arg)
+	}
+	valid, err := NewCmdArg(arg.flag, longFlag, typ, arg.canHaveMultiple, arg.required)
+	if err != nil {
+		return nil, err
+	}
+	arg.longFlag = valid.longFlag
+	arg.typ = valid.typ
+	arg.positional = valid.positional
+	if arg.Rest && !arg.positional {
+		return nil, fmt.Errorf("Rest argument '%s' must be positional", longFlag)
+	}
+
+	if arg.Default != "" && typ != BoolType && typ != CountType {
+		c := &Cmd{arglist: []*CmdArg{arg}}
+		if _, err := c.parse_value(0, arg.Default); err != nil {
+			return nil, err
+		}
+	}
+	return arg, nil
+}
+
+// WithShort sets the short flag, e.g. "-e".
+func WithShort(flag string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.flag = flag
+	}
+}
+
+// Required makes the argument required.
+func Required() ArgOption {
+	return func(arg *CmdArg) {
+		arg.required = true
+	}
+}
+
+// Multiple allows the argument to be given more than once.
+func Multiple() ArgOption {
+	return func(arg *CmdArg) {
+		arg.canHaveMultiple = true
+	}
+}
+
+// Rest makes a positional argument take all remaining arguments.
+func Rest() ArgOption {
+	return func(arg *CmdArg) {
+		arg.Rest = true
+	}
+}
+
+// WithDefault sets the value used when the argument is not given.
+func WithDefault(value string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Default = value
+	}
+}
+
+// WithHelp sets the help of the argument.
+func WithHelp(help string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Help = help
+	}
+}
+
+// WithGroup lists the argument under the heading group in help.
+func WithGroup(group string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Group = group
+	}
+}
+
+// WithPattern requires the value of a string argument to match re.
+func WithPattern(re *regexp.Regexp) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Pattern = re
+	}
+}
+
+// WithRange bounds the value of a numeric argument to [min, max].
+func WithRange(min, max float64) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Min = &min
+		arg.Max = &max
+	}
+}
+
+// WithMin sets the lowest value of a numeric argument.
+func WithMin(min float64) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Min = &min
+	}
+}
+
+// WithMax sets the highest value of a numeric argument.
+func WithMax(max float64) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Max = &max
+	}
+}
+
+// WithLayouts sets the layouts accepted for a TimeType value.
+func WithLayouts(layouts ...string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Layouts = layouts
+	}
+}
+
+// WithDelimiter sets the separator of the elements of an IntSliceType or
+// StringSliceType value.
+func WithDelimiter(delimiter string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Delimiter = delimiter
+	}
+}
+
+// WithCompleter sets the function returning the values offered by tab
+// completion.
+func WithCompleter(completer func(prefix string) []string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Completer = completer
+	}
+}
+
+// WithAliases adds other long flags for the argument.
+func WithAliases(aliases ...string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Aliases = aliases
+	}
+}
+
+// WithChoices restricts the value to one of choices.
+func WithChoices(choices ...string) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Choices = choices
+	}
+}
+
+// WithValidator sets a function that validates the value.
+func WithValidator(validator func(value string) error) ArgOption {
+	return func(arg *CmdArg) {
+		arg.Validator = validator
+	}
+}
@@ -0,0 +1,96 @@
+package ishell
+
+import (
+	"fmt"
+	"sync"
+)
+
+// customArgType is an argument type registered with RegisterArgType.
+type customArgType struct {
+	name  string
+	parse func(value string) (interface{}, error)
+}
+
+const (
+	// lastBuiltinArgType is the highest built-in ArgType, to be updated
+	// with new built-in types.
+	lastBuiltinArgType = SizeType
+	// firstCustomArgType is the ArgType of the first registered type.
+	firstCustomArgType ArgType = 100
+)
+
+var (
+	customArgTypes      []customArgType
+	customArgTypesMutex sync.RWMutex
+)
+
+// RegisterArgType adds an argument type for values parsed by parse, e.g. a
+// UUID or a cron expression, and returns it for use with NewCmdArg. ParseArgs
+// rejects values parse returns an error for and stores the value it returns
+// in ParsedArg.Parsed. name is shown in help and names the type in manifests
+// and specs, so it must not be the name of another type.
+func RegisterArgType(name string, parse func(value string) (interface{}, error)) (ArgType, error) {
+	for typ := IntType; typ <= lastBuiltinArgType; typ++ {
+		if typ.String() == name {
+			return 0, fmt.Errorf("Argument type '%s' already exists", name)
+		}
+	}
+	customArgTypesMutex.Lock()
+	defer customArgTypesMutex.Unlock()
+	for _, custom := range customArgTypes {
+		if custom.name == name {
+			return 0, fmt.Errorf("Argument type '%s' already exists", name)
+		}
+	}
+	customArgTypes = append(customArgTypes, customArgType{name: name, parse: parse})
+	return firstCustomArgType + ArgType(len(customArgTypes)-1), nil
+}
+
+// lookupArgType returns the registered type typ.
+func lookupArgType(typ ArgType) (customArgType, bool) {
+	customArgTypesMutex.RLock()
+	defer customArgTypesMutex.RUnlock()
+	i := int(typ - firstCustomArgType)
+	if i < 0 || i >= len(customArgTypes) {
+		return customArgType{}, false
+	}
+	return customArgTypes[i], true
+}
+
+// MarshalText encodes the type by its name, e.g. "int", so it can be
+// written in manifests and specs.
+func (t ArgType) MarshalText() ([]byte, error) {
+	if !validArgType(t) {
+		return nil, fmt.Errorf("Typ '%d' is not a valid argument type", t)
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a type encoded by MarshalText. Types added with
+// RegisterArgType must be registered first.
+func (t *ArgType) UnmarshalText(text []byte) error {
+	for typ := IntType; typ <= lastBuiltinArgType; typ++ {
+		if typ.String() == string(text) {
+			*t = typ
+			return nil
+		}
+	}
+	customArgTypesMutex.RLock()
+	defer customArgTypesMutex.RUnlock()
+	for i, custom := range customArgTypes {
+		if custom.name == string(text) {
+			*t = firstCustomArgType + ArgType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown argument type '%s'", text)
+}
+
+// validArgType tells if typ is a built-in or registered type.
+func validArgType(typ ArgType) bool {
+	if typ >= 0 && typ <= lastBuiltinArgType {
+		return true
+	}
+	_, ok := lookupArgType(typ)
+	return ok
+}
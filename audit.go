@@ -0,0 +1,196 @@
+package ishell
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is an entry of an audit log, one per command line run.
+// Records are chained: each includes the hash of the previous record, so
+// editing, removing or reordering records breaks the chain.
+type AuditRecord struct {
+	// Seq is the position of the record in the log, starting at 1.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// User is the authenticated user, if any.
+	User string   `json:"user,omitempty"`
+	Args []string `json:"args"`
+	// Error is the error of the command, if it failed.
+	Error string `json:"error,omitempty"`
+	// PrevHash is the Hash of the previous record, empty for the first.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the SHA-256 of the record with Hash left empty.
+	Hash string `json:"hash"`
+}
+
+func (r AuditRecord) computeHash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditError describes where an audit log failed verification.
+type AuditError struct {
+	// Seq is the sequence number of the offending record, or the expected
+	// one if the record could not be decoded.
+	Seq    uint64
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit record %d: %s", e.Seq, e.Reason)
+}
+
+// AuditLog writes hash chained AuditRecords as JSON lines.
+type AuditLog struct {
+	writer io.Writer
+	closer io.Closer
+	seq    uint64
+	prev   string
+	mu     sync.Mutex
+}
+
+// NewAuditLog creates an audit log writing to w. To append to an existing
+// log, call Resume with its content first.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{writer: w}
+}
+
+// Resume verifies the existing log in r and continues its chain.
+func (l *AuditLog) Resume(r io.Reader) error {
+	last, err := verifyAuditLog(r)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq = last.Seq
+	l.prev = last.Hash
+	return nil
+}
+
+// Close closes the file of a log opened by Shell.SetAuditFile. It does
+// nothing for logs created with NewAuditLog, or a nil AuditLog.
+func (l *AuditLog) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closer.Close()
+}
+
+// Record appends a record for args run by user, which failed with err if
+// not nil. Recording to a nil AuditLog does nothing.
+func (l *AuditLog) Record(user string, args []string, err error) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := AuditRecord{
+		Seq:      l.seq + 1,
+		Time:     time.Now().UTC(),
+		User:     user,
+		Args:     args,
+		PrevHash: l.prev,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	hash, err := record.computeHash()
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := l.writer.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	l.seq = record.Seq
+	l.prev = record.Hash
+	return nil
+}
+
+// VerifyAuditLog reads an audit log from r and checks that its chain is
+// intact. It returns an *AuditError pointing at the first record that was
+// modified, removed or reordered.
+func VerifyAuditLog(r io.Reader) error {
+	_, err := verifyAuditLog(r)
+	return err
+}
+
+// verifyAuditLog returns the last record of a verified log.
+func verifyAuditLog(r io.Reader) (AuditRecord, error) {
+	var last AuditRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return last, &AuditError{Seq: last.Seq + 1, Reason: err.Error()}
+		}
+		if record.Seq != last.Seq+1 {
+			return last, &AuditError{Seq: record.Seq, Reason: fmt.Sprintf("expected sequence number %d", last.Seq+1)}
+		}
+		if record.PrevHash != last.Hash {
+			return last, &AuditError{Seq: record.Seq, Reason: "previous hash does not match"}
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return last, err
+		}
+		if hash != record.Hash {
+			return last, &AuditError{Seq: record.Seq, Reason: "hash does not match content"}
+		}
+		last = record
+	}
+	return last, scanner.Err()
+}
+
+// SetAuditLog records every command line the shell runs to log. A nil log
+// disables auditing, the default.
+func (s *Shell) SetAuditLog(log *AuditLog) {
+	s.auditLog = log
+}
+
+// SetAuditFile records every command line the shell runs to the audit log
+// in the file at path, continuing its chain if the file exists. It returns
+// ErrRestricted if the shell is restricted with RestrictFiles.
+func (s *Shell) SetAuditFile(path string) error {
+	if err := s.checkRestricted(RestrictFiles); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	log := NewAuditLog(f)
+	if err := log.Resume(f); err != nil {
+		f.Close()
+		return err
+	}
+	log.closer = f
+	s.auditLog.Close()
+	s.auditLog = log
+	return nil
+}
@@ -0,0 +1,123 @@
+package ishell
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAuthFailed is returned by authenticators for wrong credentials.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrAuthLocked is returned once the maximum number of failed
+	// authentication attempts has been reached.
+	ErrAuthLocked = errors.New("too many failed attempts, shell is locked")
+	// ErrNotAuthenticated is returned for commands run before the user
+	// has authenticated.
+	ErrNotAuthenticated = errors.New("not authenticated")
+)
+
+// Authenticator authenticates the user of the shell, e.g. by prompting
+// for credentials through c. It returns the name of the user, or an error
+// if authentication failed.
+type Authenticator func(c *Context) (user string, err error)
+
+// PasswordAuthenticator returns an Authenticator that prompts for a user
+// name and password, accepted if check returns true.
+func PasswordAuthenticator(check func(user, password string) bool) Authenticator {
+	return func(c *Context) (string, error) {
+		c.ShowPrompt(false)
+		defer c.ShowPrompt(true)
+		c.Print("Username: ")
+		user, err := c.ReadLineErr()
+		if err != nil {
+			return "", err
+		}
+		c.Print("Password: ")
+		password, err := c.ReadPasswordErr()
+		if err != nil {
+			return "", err
+		}
+		if !check(user, password) {
+			return "", ErrAuthFailed
+		}
+		return user, nil
+	}
+}
+
+// TokenAuthenticator returns an Authenticator that prompts for a token
+// without echoing it. check returns the user the token belongs to, or
+// false if the token is not valid.
+func TokenAuthenticator(check func(token string) (user string, ok bool)) Authenticator {
+	return func(c *Context) (string, error) {
+		c.ShowPrompt(false)
+		defer c.ShowPrompt(true)
+		c.Print("Token: ")
+		token, err := c.ReadPasswordErr()
+		if err != nil {
+			return "", err
+		}
+		user, ok := check(token)
+		if !ok {
+			return "", ErrAuthFailed
+		}
+		return user, nil
+	}
+}
+
+// SetAuthenticator requires the user to authenticate with auth before the
+// shell runs any command. The interactive shell prompts for authentication
+// when it starts. After maxAttempts consecutive failures the shell is
+// locked and refuses further attempts; 0 or less allows unlimited
+// attempts. Only errors wrapping ErrAuthFailed, and an empty user name,
+// count as failures; other errors, e.g. reading input, end the attempt.
+func (s *Shell) SetAuthenticator(auth Authenticator, maxAttempts int) {
+	s.authenticator = auth
+	s.maxAuthAttempts = maxAttempts
+	s.user = ""
+}
+
+// Authenticate runs the authenticator until it succeeds or the shell gets
+// locked. It is called by Run and Start, and can be called directly before
+// using Process. It returns nil if no authenticator is set.
+func (s *Shell) Authenticate() error {
+	if s.authenticator == nil {
+		return nil
+	}
+	for {
+		if s.maxAuthAttempts > 0 && s.authFailures >= s.maxAuthAttempts {
+			return ErrAuthLocked
+		}
+		user, err := s.authenticator(newContext(s, nil, nil, nil))
+		if err == nil && user == "" {
+			err = fmt.Errorf("%w: empty user name", ErrAuthFailed)
+		}
+		if err == nil {
+			if err := s.saveUser(); err != nil {
+				s.printError(err)
+			}
+			s.user = user
+			s.authFailures = 0
+			return s.loadUser()
+		}
+		s.printError(err)
+		if !errors.Is(err, ErrAuthFailed) {
+			// input failed, e.g. EOF; don't retry forever.
+			return err
+		}
+		s.authFailures++
+	}
+}
+
+// User returns the name of the authenticated user, or an empty string.
+func (s *Shell) User() string {
+	return s.user
+}
+
+// checkAuthenticated returns ErrNotAuthenticated if an authenticator is
+// set and the user has not authenticated.
+func (s *Shell) checkAuthenticated() error {
+	if s.authenticator != nil && s.user == "" {
+		return ErrNotAuthenticated
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package ishell
+
+import (
+	"sync"
+)
+
+// BatchResult is the result of a command run by ProcessBatch.
+type BatchResult struct {
+	// Args is the command line that was run.
+	Args []string
+	// Output is what the command printed. It is cut off at the limit
+	// set by SetCaptureLimit, see Truncated.
+	Output string
+	// Truncated is true if the command printed more than the capture
+	// limit.
+	Truncated bool
+	// Err is the error of the command, nil if it succeeded.
+	Err error
+}
+
+// ProcessBatch runs lines in a non-interactive mode like Process, with up to
+// workers commands running at the same time. It is meant for scripts of
+// independent commands; commands that read input or depend on the effects
+// of a previous line should be run with Process instead.
+//
+// The output of each command is collected and written to the shell's
+// output in the order of lines, followed by the error if the command
+// failed. The results are returned in the order of lines. Collected
+// output is bounded by SetCaptureLimit.
+func (s *Shell) ProcessBatch(workers int, lines ...[]string) []BatchResult {
+	if workers < 1 {
+		workers = 1
+	}
+	defer s.flush()
+	refreshProviders()
+	results := make([]BatchResult, len(lines))
+	outputs := make([]*captureBuffer, len(lines))
+	done := make([]chan struct{}, len(lines))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out := newCaptureBuffer(s.captureLimit, s.captureSpill)
+				actions := &shellActionsImpl{Shell: s, output: out}
+				release := s.acquireCommandSlot()
+				err := handleInputWith(s, actions, lines[i])
+				release()
+				outputs[i] = out
+				results[i] = BatchResult{
+					Args:      lines[i],
+					Output:    out.String(),
+					Truncated: out.truncated(),
+					Err:       err,
+				}
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range lines {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	// collate the output in order while the remaining commands run.
+	for i := range lines {
+		<-done[i]
+		s.reader.buf.Reset()
+		outputs[i].WriteTo(s.writer)
+		if outputs[i].dropped > 0 {
+			s.Printf("(%d bytes of output discarded)\n", outputs[i].dropped)
+		}
+		outputs[i].Close()
+		if results[i].Err != nil {
+			s.reportError(s.Actions, lines[i], results[i].Err)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// SetCaptureLimit limits how much output of a command is kept in memory
+// when the output is collected rather than printed, e.g. by ProcessBatch.
+// If spill is true, output beyond limit bytes is kept in a temporary file
+// until it is written out, otherwise it is discarded. A limit of 0 or less
+// means no limit, which is the default.
+func (s *Shell) SetCaptureLimit(limit int64, spill bool) {
+	s.captureLimit = limit
+	s.captureSpill = spill
+}
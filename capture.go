@@ -0,0 +1,89 @@
+package ishell
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// captureBuffer collects output in memory up to a limit. Output beyond
+// the limit is written to a temporary file if spilling is enabled and is
+// discarded otherwise, so a runaway command cannot exhaust memory.
+type captureBuffer struct {
+	// limit is the maximum number of bytes kept in memory, 0 for no limit.
+	limit int64
+	spill bool
+	mem   bytes.Buffer
+	file  *os.File
+	// dropped is the number of bytes discarded.
+	dropped int64
+}
+
+func newCaptureBuffer(limit int64, spill bool) *captureBuffer {
+	return &captureBuffer{limit: limit, spill: spill}
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.file == nil && b.dropped == 0 {
+		room := b.limit - int64(b.mem.Len())
+		if b.limit <= 0 || int64(len(p)) <= room {
+			return b.mem.Write(p)
+		}
+		b.mem.Write(p[:room])
+		p = p[room:]
+	}
+	if b.file == nil && b.spill {
+		f, err := os.CreateTemp("", "ishell-output-")
+		if err != nil {
+			// can't spill, drop the rest instead.
+			b.spill = false
+		} else {
+			b.file = f
+		}
+	}
+	if b.file != nil {
+		if _, err := b.file.Write(p); err != nil {
+			return n - len(p), err
+		}
+		return n, nil
+	}
+	b.dropped += int64(len(p))
+	return n, nil
+}
+
+// truncated reports whether output didn't fit in memory.
+func (b *captureBuffer) truncated() bool {
+	return b.file != nil || b.dropped > 0
+}
+
+// String returns the output kept in memory.
+func (b *captureBuffer) String() string {
+	return b.mem.String()
+}
+
+// WriteTo writes all captured output to w, including output spilled to
+// disk.
+func (b *captureBuffer) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b.mem.Bytes())
+	written := int64(n)
+	if err != nil || b.file == nil {
+		return written, err
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return written, err
+	}
+	m, err := io.Copy(w, b.file)
+	return written + m, err
+}
+
+// Close removes the spill file, if any.
+func (b *captureBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	err := os.Remove(b.file.Name())
+	b.file = nil
+	return err
+}
@@ -0,0 +1,142 @@
+package ishell
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadCmds adds the commands described in a YAML (or JSON) file, in the
+// format written by ExportManifest, binding the Func of each command by
+// the name in its "func" field to a function of funcs, e.g.
+//
+//	commands:
+//	  - name: net
+//	    help: network tools
+//	    commands:
+//	      - name: ping
+//	        aliases: [p]
+//	        func: ping
+//	        args:
+//	          - name: host
+//	            type: string
+//	            required: true
+//	          - name: --count
+//	            short: -c
+//	            type: int
+//	            default: "1"
+//
+// This way the tree can be restructured without code changes. Commands
+// without a func show their help. Commands with the name of one already
+// added replace it. Nothing is added if the file has an error. It returns
+// ErrRestricted if the shell is restricted with RestrictFiles.
+func (s *Shell) LoadCmds(path string, funcs map[string]func(*Context)) error {
+	if err := s.checkRestricted(RestrictFiles); err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var manifest Manifest
+	if err := yaml.Unmarshal(b, &manifest); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	var cmds []*Cmd
+	for _, spec := range manifest.Commands {
+		cmd, err := spec.Build(funcs)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		s.AddCmd(cmd)
+	}
+	return nil
+}
+
+// Build returns the command described by spec and its subcommands, with
+// the Funcs named in the specs looked up in funcs.
+func (spec CmdSpec) Build(funcs map[string]func(*Context)) (*Cmd, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("Command has no name")
+	}
+	cmd := &Cmd{
+		Name:               spec.Name,
+		Aliases:            spec.Aliases,
+		Help:               spec.Help,
+		LongHelp:           spec.LongHelp,
+		Category:           spec.Category,
+		Tags:               spec.Tags,
+		Weight:             spec.Weight,
+		Deprecated:         spec.Deprecated,
+		DeprecationMessage: spec.DeprecationMessage,
+		RequireSubcommand:  spec.RequireSubcommand,
+		Examples:           spec.Examples,
+	}
+	if spec.Func != "" {
+		f, ok := funcs[spec.Func]
+		if !ok {
+			return nil, fmt.Errorf("Command '%s': no func '%s'", spec.Name, spec.Func)
+		}
+		cmd.Func = f
+	}
+	for _, argSpec := range spec.Args {
+		arg, err := argSpec.build()
+		if err == nil {
+			err = cmd.AddCmdArg(arg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Command '%s': %v", spec.Name, err)
+		}
+	}
+	for _, childSpec := range spec.Commands {
+		child, err := childSpec.Build(funcs)
+		if err != nil {
+			return nil, err
+		}
+		cmd.AddCmd(child)
+	}
+	return cmd, nil
+}
+
+// build returns the argument described by spec.
+func (spec ArgSpec) build() (*CmdArg, error) {
+	var opts []ArgOption
+	if spec.Short != "" {
+		opts = append(opts, WithShort(spec.Short))
+	}
+	if spec.Required {
+		opts = append(opts, Required())
+	}
+	if spec.Multiple {
+		opts = append(opts, Multiple())
+	}
+	if spec.Rest {
+		opts = append(opts, Rest())
+	}
+	if len(spec.Aliases) > 0 {
+		opts = append(opts, WithAliases(spec.Aliases...))
+	}
+	if len(spec.Choices) > 0 {
+		opts = append(opts, WithChoices(spec.Choices...))
+	}
+	if spec.Default != "" {
+		opts = append(opts, WithDefault(spec.Default))
+	}
+	if spec.Help != "" {
+		opts = append(opts, WithHelp(spec.Help))
+	}
+	if spec.Group != "" {
+		opts = append(opts, WithGroup(spec.Group))
+	}
+	arg, err := NewArg(spec.Name, spec.Type, opts...)
+	if err != nil {
+		return nil, err
+	}
+	arg.Hidden = spec.Hidden
+	arg.Deprecated = spec.Deprecated
+	return arg, nil
+}
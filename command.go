@@ -2,21 +2,93 @@ package ishell
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"text/tabwriter"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 type ArgType int
 
 const (
-	IntType    ArgType = 0
-	StringType ArgType = 1
-	BoolType   ArgType = 2
+	IntType      ArgType = 0
+	StringType   ArgType = 1
+	BoolType     ArgType = 2
+	FloatType    ArgType = 3
+	DurationType ArgType = 4
+	FilePathType ArgType = 5
+	CountType    ArgType = 6
+	// IntSliceType and StringSliceType take a list in a single value, e.g.
+	// "1,2,3", split on the Delimiter of the argument.
+	IntSliceType    ArgType = 7
+	StringSliceType ArgType = 8
+	// URLType takes an absolute URL and IPType an IPv4 or IPv6 address.
+	URLType ArgType = 9
+	IPType  ArgType = 10
+	// TimeType takes a time in one of the Layouts of the argument.
+	TimeType ArgType = 11
+	// SecretType takes a value such as a password. When a required secret
+	// flag is left out of a command typed in the interactive shell, the
+	// shell prompts for it with masked input, which is not kept in the
+	// history. Secret values are redacted in the audit log.
+	SecretType ArgType = 12
+	// JSONType takes a JSON document, e.g. '{"replicas": 3}'.
+	JSONType ArgType = 13
+	// SizeType takes a size in bytes such as "512K", "10MB" or "2GiB".
+	SizeType ArgType = 14
 )
 
+// String returns the name of the type as shown in help.
+func (t ArgType) String() string {
+	switch t {
+	case IntType:
+		return "int"
+	case StringType:
+		return "string"
+	case BoolType:
+		return "bool"
+	case FloatType:
+		return "float"
+	case DurationType:
+		return "duration"
+	case FilePathType:
+		return "path"
+	case CountType:
+		return "count"
+	case IntSliceType:
+		return "ints"
+	case StringSliceType:
+		return "strings"
+	case URLType:
+		return "url"
+	case IPType:
+		return "ip"
+	case TimeType:
+		return "time"
+	case SecretType:
+		return "secret"
+	case JSONType:
+		return "json"
+	case SizeType:
+		return "size"
+	}
+	if custom, ok := lookupArgType(t); ok {
+		return custom.name
+	}
+	return fmt.Sprintf("ArgType(%d)", int(t))
+}
+
 type CmdArg struct {
 	// short flag, such as '-p'
 	flag string
@@ -33,6 +105,160 @@ type CmdArg struct {
 	canHaveMultiple bool
 	// whether this is required
 	required bool
+
+	// PathCheck selects the checks done on the value of a FilePathType
+	// argument, e.g. PathIsFile | PathReadable. By default the path is not
+	// checked.
+	PathCheck PathCheck
+
+	// Aliases are other long flags of the argument, e.g. "--colour" for
+	// "--color". Values given with an alias are keyed by the long flag.
+	Aliases []string
+
+	// Choices restricts the value to one of the listed values.
+	Choices []string
+
+	// Completer returns the values offered by tab completion after the
+	// flag, e.g. the environments for "--env". Choices are offered when it
+	// is nil.
+	Completer func(prefix string) []string
+
+	// Pattern, if not nil, must match the value of a StringType or
+	// StringSliceType argument, e.g. a commit SHA or a ticket ID.
+	Pattern *regexp.Regexp
+
+	// Validator, if not nil, checks the value after it passed the type
+	// validation, e.g. to enforce a port range.
+	Validator func(value string) error
+
+	// Min and Max, if not nil, bound the value of an IntType, FloatType or
+	// IntSliceType argument.
+	Min *float64
+	Max *float64
+
+	// Requires lists the keys of arguments that must be given along with
+	// this one, e.g. "--user" for "--password".
+	Requires []string
+	// Implies lists the keys of BoolType arguments that are set when this
+	// one is given.
+	Implies []string
+
+	// Deprecated marks the argument as deprecated. It is still accepted,
+	// but the shell warns when it is used.
+	Deprecated bool
+	// ReplacedBy is the key of the argument to use instead of a deprecated
+	// one.
+	ReplacedBy string
+
+	// Help describes the argument in the help of the command.
+	Help string
+
+	// Group is the heading the argument is listed under in help, e.g.
+	// "Connection options". Arguments without a group are listed first.
+	Group string
+
+	// Delimiter separates the elements of an IntSliceType or
+	// StringSliceType value. It defaults to ",".
+	Delimiter string
+
+	// Layouts are the time layouts accepted for a TimeType value, tried in
+	// order. They default to time.RFC3339 and "2006-01-02".
+	Layouts []string
+
+	// Default is the value used when the argument is not given. It also
+	// satisfies required arguments.
+	Default string
+
+	// Rest makes a positional argument take all remaining arguments,
+	// including ones that look like flags. It must be the last positional
+	// argument.
+	Rest bool
+
+	// Hidden leaves the argument out of help and completion. It is still
+	// accepted by ParseArgs.
+	Hidden bool
+}
+
+// deprecation returns the warning for using a deprecated argument.
+func (a *CmdArg) deprecation() string {
+	if a.ReplacedBy != "" {
+		return fmt.Sprintf("Argument '%s' is deprecated, use '%s' instead", a.longFlag, a.ReplacedBy)
+	}
+	return fmt.Sprintf("Argument '%s' is deprecated", a.longFlag)
+}
+
+// name returns how the argument is shown in help, e.g. "-f, --format".
+func (a *CmdArg) name() string {
+	if a.positional {
+		return "<" + a.longFlag + ">"
+	}
+	name := strings.Join(a.longFlags(), ", ")
+	if a.flag != "" {
+		return a.flag + ", " + name
+	}
+	return name
+}
+
+// longFlags returns the long flag of the argument and its aliases.
+func (a *CmdArg) longFlags() []string {
+	return append([]string{a.longFlag}, a.Aliases...)
+}
+
+// description returns the help of the argument followed by its notes.
+func (a *CmdArg) description() string {
+	notes := a.notes()
+	if a.Help == "" || notes == "" {
+		return a.Help + notes
+	}
+	return a.Help + " " + notes
+}
+
+// bounds describes the range of the argument, e.g. "between 1 and 65535".
+func (a *CmdArg) bounds() string {
+	switch {
+	case a.Min != nil && a.Max != nil:
+		return fmt.Sprintf("between %v and %v", *a.Min, *a.Max)
+	case a.Min != nil:
+		return fmt.Sprintf("at least %v", *a.Min)
+	case a.Max != nil:
+		return fmt.Sprintf("at most %v", *a.Max)
+	}
+	return ""
+}
+
+// notes returns the details of the argument shown in help.
+func (a *CmdArg) notes() string {
+	var notes []string
+	if a.Deprecated && a.ReplacedBy != "" {
+		notes = append(notes, "deprecated, use "+a.ReplacedBy)
+	} else if a.Deprecated {
+		notes = append(notes, "deprecated")
+	}
+	if len(a.Choices) > 0 {
+		notes = append(notes, "one of "+strings.Join(a.Choices, ", "))
+	}
+	if a.Pattern != nil {
+		notes = append(notes, "matches "+a.Pattern.String())
+	}
+	if bounds := a.bounds(); bounds != "" {
+		notes = append(notes, bounds)
+	}
+	if a.required {
+		notes = append(notes, "required")
+	}
+	if a.Default != "" {
+		notes = append(notes, "default "+a.Default)
+	}
+	if len(a.Requires) > 0 {
+		notes = append(notes, "requires "+strings.Join(a.Requires, ", "))
+	}
+	if len(a.Implies) > 0 {
+		notes = append(notes, "implies "+strings.Join(a.Implies, ", "))
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(notes, "; ") + ")"
 }
 
 type ParsedArg struct {
@@ -40,6 +266,85 @@ type ParsedArg struct {
 	Key   string
 	Typ   ArgType
 	Value string
+	// Parsed is Value converted to Typ: an int, string, bool, float64 or
+	// time.Duration. BoolType values are false when given as "--flag=false"
+	// or "--no-flag". FilePathType and SecretType values are strings,
+	// CountType values are the number of times the flag was given,
+	// IntSliceType and StringSliceType values are a []int and a []string,
+	// URLType and IPType values are a *url.URL and a netip.Addr, TimeType
+	// values are a time.Time, JSONType values are decoded as by
+	// json.Unmarshal into an interface{}, SizeType values are an int64
+	// number of bytes and types added with RegisterArgType hold the value
+	// returned by their parse function.
+	Parsed interface{}
+	// Start and End are the indices of the arguments given to ParseArgs
+	// that the argument was parsed from, args[Start:End]. Grouped short
+	// flags share one argument. They are equal for arguments that were not
+	// given, such as defaults.
+	Start int
+	End   int
+}
+
+// Float returns the value of a FloatType argument, 0 for other types.
+func (p ParsedArg) Float() float64 {
+	f, _ := p.Parsed.(float64)
+	return f
+}
+
+// Count returns the number of times a CountType flag was given.
+func (p ParsedArg) Count() int {
+	if p.Typ != CountType {
+		return 0
+	}
+	n, _ := p.Parsed.(int)
+	return n
+}
+
+// IntSlice returns the elements of an IntSliceType argument, nil for other
+// types.
+func (p ParsedArg) IntSlice() []int {
+	s, _ := p.Parsed.([]int)
+	return s
+}
+
+// StringSlice returns the elements of a StringSliceType argument, nil for
+// other types.
+func (p ParsedArg) StringSlice() []string {
+	s, _ := p.Parsed.([]string)
+	return s
+}
+
+// URL returns the value of a URLType argument, nil for other types.
+func (p ParsedArg) URL() *url.URL {
+	u, _ := p.Parsed.(*url.URL)
+	return u
+}
+
+// IP returns the value of an IPType argument, the zero Addr for other
+// types.
+func (p ParsedArg) IP() netip.Addr {
+	ip, _ := p.Parsed.(netip.Addr)
+	return ip
+}
+
+// Size returns the number of bytes of a SizeType argument, 0 for other
+// types.
+func (p ParsedArg) Size() int64 {
+	n, _ := p.Parsed.(int64)
+	return n
+}
+
+// Time returns the value of a TimeType argument, the zero Time for other
+// types.
+func (p ParsedArg) Time() time.Time {
+	t, _ := p.Parsed.(time.Time)
+	return t
+}
+
+// Duration returns the value of a DurationType argument, 0 for other types.
+func (p ParsedArg) Duration() time.Duration {
+	d, _ := p.Parsed.(time.Duration)
+	return d
 }
 
 // Cmd is a shell command handler.
@@ -50,10 +355,75 @@ type Cmd struct {
 	Aliases []string
 	// Function to execute for the command.
 	Func func(c *Context)
+	// ErrFunc is Func returning the error of the command, rather than
+	// reporting it with Context.Err. It takes priority over Func.
+	ErrFunc func(c *Context) error
+	// NotFoundFunc, if not nil, is called instead of Func when the word
+	// after the command is neither a subcommand nor a flag, with the words
+	// left unparsed in Context.Args, e.g. for "ssh <host>" without adding a
+	// subcommand per host. Shell.NotFound is the top level equivalent.
+	NotFoundFunc func(c *Context)
+	// PreRun and PostRun, if not nil, are called before and after Func
+	// with the same Context, e.g. to open and close a connection. Func and
+	// PostRun are skipped when PreRun reports an error with Context.Err.
+	PreRun  func(c *Context)
+	PostRun func(c *Context)
 	// One liner help message for the command.
 	Help string
 	// More descriptive help message for the command.
 	LongHelp string
+	// Deprecated marks the command as deprecated. It still runs, but the
+	// shell warns the first time it is used and help and completion mark
+	// it. DeprecationMessage is added to the warning, e.g.
+	// "use 'vm list' instead".
+	Deprecated         bool
+	DeprecationMessage string
+	// Category is the heading the command is listed under in the help of
+	// its parent, e.g. "Networking". Commands without one are listed first.
+	Category string
+	// Tags group commands by area across the tree, e.g. "network", see
+	// Shell.CommandsByTag and "help --tag".
+	Tags []string
+	// Weight orders the command among its siblings in Children and help:
+	// lower weights come first and equal ones by name, so commands can be
+	// listed in workflow order, e.g. init, configure, deploy, status.
+	Weight int
+	// OrderChildren, if not nil, orders the subcommands instead of Weight,
+	// reporting whether a goes before b. Equal ones are ordered by name.
+	// See OrderAdded.
+	OrderChildren func(a, b *Cmd) bool
+	// Examples are shown under "Examples:" in help.
+	Examples []Example
+	// HelpTemplate, if not nil, renders the help of the command instead of
+	// the default layout, see HelpData.
+	HelpTemplate *template.Template
+	// Subshell makes running the command without arguments enter it, like
+	// a directory with cd: the prompt shows it, e.g. "app(config)> ", and
+	// its subcommands run without its name, as do the top level commands
+	// that are not among them. ".." or "exit" leaves it. Only input typed
+	// at the prompt is scoped: Process runs the command as usual. See
+	// Shell.Scope and Shell.FindCmd.
+	Subshell bool
+	// RequireSubcommand makes running the command without the name of a
+	// subcommand print its help and fail with ErrSubcommandRequired, or
+	// *ErrCmdNotFound for an unknown name, instead of running Func, e.g.
+	// for grouping commands like "config".
+	RequireSubcommand bool
+	// Version, if not empty, is shown for "--version" as the only
+	// argument of the command, instead of running it, e.g. for commands
+	// added by plugins.
+	Version string
+	// Async runs the command in the background as a task, returning to
+	// the prompt at once. Its output is kept for "tasks output", see
+	// Shell.EnableTasks, and Context.Context is cancelled by "tasks
+	// cancel".
+	Async bool
+	// Timeout, if not zero, limits how long the command may run. When it
+	// expires, Context.Context is cancelled and the shell fails the command
+	// with ErrTimeout and returns to the prompt, without waiting for Func.
+	// Func must honour Context.Context and return once it is done, as it
+	// cannot be stopped otherwise; until then, what it prints is discarded.
+	Timeout time.Duration
 
 	// Completer is custom autocomplete for command.
 	// It takes in command arguments and returns
@@ -70,21 +440,79 @@ type Cmd struct {
 	// CompleterWithPrefix takes precedence
 	CompleterWithPrefix func(prefix string, args []string) []string
 
+	// StopAtPositional ends flag parsing at the first positional argument,
+	// so the arguments after it are positional even if they start with
+	// "-", e.g. for "run <binary> <binary-args...>".
+	StopAtPositional bool
+
+	// IgnoreFlagCase makes ParseArgs match long flags regardless of case,
+	// so "--Force" and "--FORCE" are taken as "--force".
+	IgnoreFlagCase bool
+
+	// IgnoreCase makes FindCmd match the names and aliases of the
+	// subcommands regardless of case, so "STATUS" and "Status" find
+	// "status". It applies to their subcommands too.
+	IgnoreCase bool
+
+	// NamespaceSeparator, if not empty, lets one word name a subcommand
+	// and its subcommands joined by it, e.g. "net.ping" for "net ping"
+	// with ".". It applies to their subcommands too, unless they set
+	// another one.
+	NamespaceSeparator string
+
 	// subcommands.
 	children map[string]*Cmd
+	// the command c was last added to, guarded by cmdTree.
+	parent *Cmd
+	// when c was last added, see OrderAdded.
+	addSeq uint64
+	// functions returning more subcommands, see Shell.AddCmdProvider
+	providers []func() []*Cmd
+	// the commands the providers returned last, replaced with providers.
+	providerCmds *providerCache
+
+	// pass args to Func without parsing, for built-ins that take
+	// another command line as their arguments.
+	rawArgs bool
 
 	// Args in the order that they were added
 	arglist []*CmdArg
+	// flags also taken by the subcommands, see AddPersistentCmdArg
+	persistent []*CmdArg
 	// Args that are in a map via longArg -> CmdArg
 	argmap map[string]*CmdArg
+	// Index into arglist by flag and longFlag, for non positional args
+	argindex map[string]int
+
+	// sorted names of children and flags for completion, nil when stale.
+	childIndex prefixIndex
+	flagIndex  prefixIndex
+
+	// set by Disable, guarded by cmdTree.
+	disabled       bool
+	disabledReason string
 }
 
+// cmdTree guards the subcommands, providers and completion indexes of all
+// commands, so commands can be added and deleted at runtime,
+// e.g. from a running command or a background goroutine, while the shell
+// completes and finds commands. It is shared rather than part of Cmd
+// because Context holds a copy of the command.
+var cmdTree sync.RWMutex
+
+// patterns of valid short flags, long flags and positional argument keys.
+var (
+	shortFlagPattern  = regexp.MustCompile(`^-[a-zA-Z0-9]$`)
+	longFlagPattern   = regexp.MustCompile(`^--[a-zA-Z0-9][a-zA-Z0-9_-]+$`)
+	positionalPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]+$`)
+)
+
 func NewCmdArg(flag string, longFlag string, typ ArgType,
 	canHaveMultiple bool, required bool) (*CmdArg, error) {
 	var ret *CmdArg
 
 	// flag can be empty so check to see if it is before checking
-	if flag != "" && !(len(flag) == 2 && regexp.MustCompile(`^-[a-zA-Z0-9]$`).MatchString(flag)) {
+	if flag != "" && !(len(flag) == 2 && shortFlagPattern.MatchString(flag)) {
 		return ret, fmt.Errorf("Flag '%s' is not a valid parameter", flag)
 	}
 	if longFlag == "" {
@@ -94,17 +522,21 @@ func NewCmdArg(flag string, longFlag string, typ ArgType,
 	positional := !is_long_arg(longFlag) && flag == ""
 
 	// check validity of string
-	if positional && !regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]+$`).MatchString(longFlag) {
+	if positional && !positionalPattern.MatchString(longFlag) {
 		return ret, fmt.Errorf("'%s' is not a valid key for a positional argument", longFlag)
 	} else if positional && typ == BoolType {
 		return ret, fmt.Errorf("A positional argument cannot be a boolean")
-	} else if !positional && !(len(longFlag) > 3 && regexp.MustCompile(`^--[a-zA-Z0-9][a-zA-Z0-9_-]+$`).MatchString(longFlag)) {
+	} else if positional && typ == CountType {
+		return ret, fmt.Errorf("A positional argument cannot be a counter")
+	} else if positional && typ == SecretType {
+		return ret, fmt.Errorf("A positional argument cannot be a secret")
+	} else if !positional && !(len(longFlag) > 3 && longFlagPattern.MatchString(longFlag)) {
 		return ret, fmt.Errorf("LongFlag '%s' is not a valid parameter", longFlag)
 	}
 
 	// not a valid ArgType
-	if typ < 0 || typ > 2 {
-		return ret, fmt.Errorf("Typ '%d' is not a valid parameter. Please use values IntType, StringType, or BoolType", typ)
+	if !validArgType(typ) {
+		return ret, fmt.Errorf("Typ '%d' is not a valid parameter. Please use values IntType, StringType, BoolType, FloatType, DurationType, FilePathType, CountType, IntSliceType, StringSliceType, URLType, IPType, TimeType, SecretType, JSONType, SizeType or a type added with RegisterArgType", typ)
 	}
 
 	ret = &CmdArg{
@@ -119,228 +551,1592 @@ func NewCmdArg(flag string, longFlag string, typ ArgType,
 	return ret, nil
 }
 
-// AddCmd adds cmd as a subcommand.
+// AddCmd adds cmd as a subcommand. It is safe to call while the shell is
+// running. A subcommand with the same name is replaced, see AddCmdE. Names
+// and aliases clashing with siblings are not checked, see Validate.
 func (c *Cmd) AddCmd(cmd *Cmd) {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
 	if c.children == nil {
 		c.children = make(map[string]*Cmd)
 	}
+	if old := c.children[cmd.Name]; old != nil && old != cmd {
+		old.parent = nil
+	}
 	c.children[cmd.Name] = cmd
+	cmd.parent = c
+	atomic.StoreUint64(&cmd.addSeq, atomic.AddUint64(&cmdAdds, 1))
+	c.invalidateIndexes()
 }
 
-// DeleteCmd deletes cmd from subcommands.
-func (c *Cmd) DeleteCmd(name string) {
-	delete(c.children, name)
+// AddCmdE is AddCmd that fails with ErrCmdExists when c already has a
+// subcommand added with the name of cmd, instead of replacing it. Use
+// ReplaceCmd to replace one.
+func (c *Cmd) AddCmdE(cmd *Cmd) error {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	if _, ok := c.children[cmd.Name]; ok {
+		return fmt.Errorf("Command '%s': %w", cmd.Name, ErrCmdExists)
+	}
+	if c.children == nil {
+		c.children = make(map[string]*Cmd)
+	}
+	c.children[cmd.Name] = cmd
+	cmd.parent = c
+	atomic.StoreUint64(&cmd.addSeq, atomic.AddUint64(&cmdAdds, 1))
+	c.invalidateIndexes()
+	return nil
 }
 
-func (c *Cmd) AddCmdArg(arg *CmdArg) {
-	if c.arglist == nil {
-		c.arglist = make([]*CmdArg, 0)
+// ReplaceCmd adds cmd as a subcommand in place of the one added with the
+// same name, if any, and returns that one or nil.
+func (c *Cmd) ReplaceCmd(cmd *Cmd) *Cmd {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	if c.children == nil {
+		c.children = make(map[string]*Cmd)
 	}
-	if c.argmap == nil {
-		c.argmap = make(map[string]*CmdArg)
+	old := c.children[cmd.Name]
+	if old != nil && old != cmd {
+		old.parent = nil
 	}
-	c.arglist = append(c.arglist, arg)
-	c.argmap[arg.longFlag] = arg
+	c.children[cmd.Name] = cmd
+	cmd.parent = c
+	atomic.StoreUint64(&cmd.addSeq, atomic.AddUint64(&cmdAdds, 1))
+	c.invalidateIndexes()
+	return old
 }
 
-// Children returns the subcommands of c.
-func (c *Cmd) Children() []*Cmd {
-	var cmds []*Cmd
+// AddCmdProvider adds a function returning subcommands, see
+// Shell.AddCmdProvider.
+func (c *Cmd) AddCmdProvider(provider func() []*Cmd) {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	c.providers = append(c.providers, provider)
+	c.providerCmds = &providerCache{}
+	c.invalidateIndexes()
+}
+
+// providerCache holds the commands returned by the providers of a command
+// until refreshProviders is called.
+type providerCache struct {
+	mu     sync.Mutex
+	called bool
+	gen    uint64
+	cmds   []*Cmd
+}
+
+// providerGen is increased by refreshProviders.
+var providerGen uint64
+
+// refreshProviders has the providers of every command called again the
+// next time their commands are needed.
+func refreshProviders() {
+	atomic.AddUint64(&providerGen, 1)
+}
+
+// DeleteCmd deletes the subcommand named by path, e.g. DeleteCmd("vm")
+// or DeleteCmd("net", "ping") for a subcommand of "net". Each name can also
+// be an alias. It returns false if there is no such command, which includes
+// commands of providers. It is safe to call while the shell is running.
+func (c *Cmd) DeleteCmd(path ...string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	parent := c
+	if len(path) > 1 {
+		cmds, n := c.findPath(path[:len(path)-1])
+		if n != len(path)-1 {
+			return false
+		}
+		parent = cmds[len(cmds)-1]
+	}
+	cmd := parent.findChildCmd(path[len(path)-1], false)
+	if cmd == nil {
+		return false
+	}
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	if parent.children[cmd.Name] != cmd {
+		// a provided command, or deleted meanwhile
+		return false
+	}
+	delete(parent.children, cmd.Name)
+	cmd.parent = nil
+	parent.invalidateIndexes()
+	return true
+}
+
+// child returns the subcommand added with name.
+func (c *Cmd) child(name string) (*Cmd, bool) {
+	cmdTree.RLock()
+	defer cmdTree.RUnlock()
+	cmd, ok := c.children[name]
+	return cmd, ok
+}
+
+// added returns the subcommands added with AddCmd, unsorted.
+func (c *Cmd) added() []*Cmd {
+	cmdTree.RLock()
+	defer cmdTree.RUnlock()
+	cmds := make([]*Cmd, 0, len(c.children))
 	for _, cmd := range c.children {
 		cmds = append(cmds, cmd)
 	}
-	sort.Sort(cmdSorter(cmds))
 	return cmds
 }
 
-func (c *Cmd) hasSubcommand() bool {
-	if len(c.children) > 1 {
-		return true
-	}
-	if _, ok := c.children["help"]; !ok {
-		return len(c.children) > 0
-	}
-	return false
+// snapshot returns a copy of c made while the tree is not being changed.
+func (c *Cmd) snapshot() Cmd {
+	cmdTree.RLock()
+	defer cmdTree.RUnlock()
+	return *c
 }
 
-// HelpText returns the computed help of the command and its subcommands.
-func (c Cmd) HelpText() string {
-	var b bytes.Buffer
-	p := func(s ...interface{}) {
-		fmt.Fprintln(&b)
-		if len(s) > 0 {
-			fmt.Fprintln(&b, s...)
+// AddCmdArg adds arg to the arguments of the command. Positional arguments
+// are filled in the order they are added, so a required positional argument
+// cannot follow an optional one and none can follow a Rest argument.
+func (c *Cmd) AddCmdArg(arg *CmdArg) error {
+	if arg.positional {
+		for _, prev := range c.arglist {
+			if !prev.positional {
+				continue
+			}
+			if prev.Rest {
+				return fmt.Errorf("Positional argument '%s' cannot follow rest argument '%s'", arg.longFlag, prev.longFlag)
+			}
+			if arg.required && !prev.required {
+				return fmt.Errorf("Required positional argument '%s' cannot follow optional '%s'", arg.longFlag, prev.longFlag)
+			}
 		}
 	}
-	if c.LongHelp != "" {
-		p(c.LongHelp)
-	} else if c.Help != "" {
-		p(c.Help)
-	} else if c.Name != "" {
-		p(c.Name, "has no help")
+	for _, alias := range arg.Aliases {
+		if arg.positional || !longFlagPattern.MatchString(alias) {
+			return fmt.Errorf("Alias '%s' of argument '%s' is not a valid long flag", alias, arg.longFlag)
+		}
+		if _, ok := c.argindex[alias]; ok || alias == arg.longFlag {
+			return fmt.Errorf("Alias '%s' of argument '%s' is already a flag", alias, arg.longFlag)
+		}
 	}
-	if c.hasSubcommand() {
-		p("Commands:")
-		w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
-		for _, child := range c.Children() {
-			fmt.Fprintf(w, "\t%s\t\t\t%s\n", child.Name, child.Help)
+	if c.arglist == nil {
+		c.arglist = make([]*CmdArg, 0)
+	}
+	if c.argmap == nil {
+		c.argmap = make(map[string]*CmdArg)
+	}
+	if c.argindex == nil {
+		c.argindex = make(map[string]int)
+	}
+	if !arg.positional {
+		if arg.flag != "" {
+			c.argindex[arg.flag] = len(c.arglist)
+		}
+		c.argindex[arg.longFlag] = len(c.arglist)
+		for _, alias := range arg.Aliases {
+			c.argindex[alias] = len(c.arglist)
 		}
-		w.Flush()
-		p()
 	}
-	return b.String()
+	c.arglist = append(c.arglist, arg)
+	c.argmap[arg.longFlag] = arg
+	cmdTree.Lock()
+	c.invalidateIndexes()
+	cmdTree.Unlock()
+	return nil
 }
 
-// findChildCmd returns the subcommand with matching name or alias.
-func (c *Cmd) findChildCmd(name string) *Cmd {
-	// find perfect matches first
-	if cmd, ok := c.children[name]; ok {
-		return cmd
+// AddPersistentCmdArg adds the flag arg to the arguments of the command and
+// of all its subcommands, e.g. "--verbose" or "--profile". Subcommands get
+// it when the shell parses their arguments, unless they have an argument
+// with the same long flag.
+func (c *Cmd) AddPersistentCmdArg(arg *CmdArg) error {
+	if arg.positional {
+		return fmt.Errorf("Persistent argument '%s' cannot be positional", arg.longFlag)
 	}
-
-	// find alias matching the name
-	for _, cmd := range c.children {
-		for _, alias := range cmd.Aliases {
-			if alias == name {
-				return cmd
-			}
-		}
+	if err := c.AddCmdArg(arg); err != nil {
+		return err
 	}
-
+	c.persistent = append(c.persistent, arg)
 	return nil
 }
 
-// FindCmd finds the matching Cmd for args.
-// It returns the Cmd and the remaining args.
-func (c Cmd) FindCmd(args []string) (*Cmd, []string) {
-	var cmd *Cmd
-	for i, arg := range args {
-		if cmd1 := c.findChildCmd(arg); cmd1 != nil {
-			cmd = cmd1
-			c = *cmd
+// inherit returns a copy of c that also takes the persistent arguments of
+// ancestors, which are ordered from the root down. The copy keeps every
+// other field of c, so it can stand in for c when parsing arguments,
+// showing help and completing flags.
+func (c *Cmd) inherit(ancestors []*Cmd) *Cmd {
+	var inherited []*CmdArg
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		inherited = append(inherited, ancestors[i].persistent...)
+	}
+	if len(inherited) == 0 {
+		return c
+	}
+	copied := c.snapshot()
+	merged := &copied
+	// the arguments are replaced rather than added to
+	merged.arglist = append([]*CmdArg(nil), c.arglist...)
+	merged.argmap = make(map[string]*CmdArg, len(c.argmap)+len(inherited))
+	for flag, arg := range c.argmap {
+		merged.argmap[flag] = arg
+	}
+	merged.argindex = make(map[string]int, len(c.argindex)+len(inherited))
+	for flag, index := range c.argindex {
+		merged.argindex[flag] = index
+	}
+	for _, arg := range inherited {
+		if _, ok := merged.argmap[arg.longFlag]; ok {
 			continue
 		}
-		return cmd, args[i:]
+		// keep only the flags that the command does not take
+		kept := *arg
+		kept.Aliases = nil
+		for _, alias := range arg.Aliases {
+			if _, ok := merged.argindex[alias]; !ok {
+				kept.Aliases = append(kept.Aliases, alias)
+			}
+		}
+		_, taken := merged.argindex[arg.flag]
+		if taken {
+			kept.flag = ""
+		}
+		if taken || len(kept.Aliases) != len(arg.Aliases) {
+			arg = &kept
+		}
+		merged.AddCmdArg(arg)
 	}
-	return cmd, nil
-}
-
-// Check to see if the string is a long argument param
-func is_long_arg(str string) bool {
-	return len(str) > 2 && str[:2] == "--"
+	return merged
 }
 
-// Check to see if the string is a short argument param
-// didn't check to see if the second char is "-"
-func is_short_arg(str string) bool {
-	return len(str) > 1 && str[:1] == "-"
+// ancestors returns c and the commands on path, which names a command, up
+// to its parent.
+func (c *Cmd) ancestors(path []string) []*Cmd {
+	cmds, _ := c.findPath(path)
+	if len(cmds) == 0 {
+		return []*Cmd{c}
+	}
+	return append([]*Cmd{c}, cmds[:len(cmds)-1]...)
 }
 
-/*
-Returns the index if arg matches either a Flag or LongFlag in the command's 'args'
-parameter.
-*/
-func (c Cmd) find_arg(arg string) int {
-	index := -1
-	is_long := is_long_arg(arg)
-	if !(is_long != is_short_arg(arg)) {
-		return index
+// Usage returns a one line synopsis of the command derived from its
+// arguments, e.g. "deploy [-f|--force] --env <string> <target>...".
+func (c *Cmd) Usage() string {
+	parts := []string{c.Name}
+	for _, arg := range c.visibleArgs() {
+		parts = append(parts, arg.usage())
 	}
+	return strings.Join(parts, " ")
+}
 
-	for i, argument := range c.arglist {
-		if is_long && argument.longFlag == arg {
-			return i
-		} else if argument.flag == arg {
-			return i
+// usage returns how the argument is shown in Usage.
+func (a *CmdArg) usage() string {
+	var s string
+	if a.positional {
+		s = "<" + a.longFlag + ">"
+	} else {
+		s = a.longFlag
+		if a.flag != "" {
+			s = a.flag + "|" + a.longFlag
+		}
+		if a.typ != BoolType && a.typ != CountType {
+			s += " <" + a.typ.String() + ">"
 		}
 	}
-
-	return index
+	if !a.required {
+		s = "[" + s + "]"
+	}
+	if a.canHaveMultiple || a.Rest || a.typ == CountType {
+		s += "..."
+	}
+	return s
 }
 
+// argGroup is a group of arguments shown under one heading in help.
+type argGroup struct {
+	name string
+	args []*CmdArg
+}
 
-func (c Cmd) find_positional(arg_mask []int) int {
-	index := -1
-	for i, argument := range c.arglist {
-		// is positional
-		if argument.positional {
-			// check to see if it already exists
-			if arg_mask[i] == 0 {
-				return i
-			} else {
-				if argument.canHaveMultiple {
-					return i
-				}
+// groupArgs groups args by their Group in order of appearance, with the
+// arguments without a group first under "Arguments".
+func groupArgs(args []*CmdArg) []argGroup {
+	groups := []argGroup{{name: "Arguments"}}
+	for _, arg := range args {
+		i := 0
+		if arg.Group != "" {
+			for i = 1; i < len(groups) && groups[i].name != arg.Group; i++ {
+			}
+			if i == len(groups) {
+				groups = append(groups, argGroup{name: arg.Group})
 			}
 		}
+		groups[i].args = append(groups[i].args, arg)
 	}
-	return index
+	if len(groups[0].args) == 0 {
+		groups = groups[1:]
+	}
+	return groups
 }
 
-// Do an initial pass to split up arguments that can be put together
-func (c Cmd) initial_pass(args []string) []string {
-	ret := make([]string, 0)
+// cmdCategory is a category of commands shown under one heading in help.
+type cmdCategory struct {
+	name string
+	cmds []*Cmd
+}
 
-	for _, arg := range args {
-		if is_short_arg(arg) && !is_long_arg(arg) && len(arg) > 2 {
-			without_dash := arg[1:]
-			for _, char := range without_dash {
-				ret = append(ret, "-"+string(char))
-			}
-		} else {
-			ret = append(ret, arg)
+// categorize groups cmds by their Category, sorted by name, with the
+// commands without a category first under "Commands".
+func categorize(cmds []*Cmd) []cmdCategory {
+	byName := make(map[string][]*Cmd)
+	var names []string
+	for _, cmd := range cmds {
+		if _, ok := byName[cmd.Category]; !ok && cmd.Category != "" {
+			names = append(names, cmd.Category)
 		}
+		byName[cmd.Category] = append(byName[cmd.Category], cmd)
 	}
-	return ret
+	sort.Strings(names)
+	var categories []cmdCategory
+	if len(byName[""]) > 0 {
+		categories = append(categories, cmdCategory{name: "Commands", cmds: byName[""]})
+	}
+	for _, name := range names {
+		categories = append(categories, cmdCategory{name: name, cmds: byName[name]})
+	}
+	return categories
 }
 
-// checks to see if an integer argument is a valid integer
-func validate_int(value string) bool {
-	_, err := strconv.Atoi(value)
-	return err == nil
+// visibleArgs returns the arguments that are not hidden.
+func (c *Cmd) visibleArgs() []*CmdArg {
+	var args []*CmdArg
+	for _, arg := range c.arglist {
+		if !arg.Hidden {
+			args = append(args, arg)
+		}
+	}
+	return args
 }
 
-// validates the arguments to make sure there are no repeats that aren't allowed, or if every
-// required argument exists
-func (c Cmd) validate_args(arg_mask []int, parsed []ParsedArg) error {
-	// iterate through every argument given with the command and check the count
-	// that each arg has in the counter. validate that the required commands exist,
-	// and that there aren't any arguments that shouldnt have multiples.
-	for _, arg := range parsed {
-		if arg.Typ != BoolType && arg.Value == "" {
-			return fmt.Errorf("Argument '%s' requires a value", arg.Key)
-		}
+// Children returns the subcommands of c, by Weight and name unless
+// OrderChildren is set.
+func (c *Cmd) Children() []*Cmd {
+	cmds := append(c.added(), c.provided()...)
+	sort.Sort(cmdSorter(cmds))
+	less := c.OrderChildren
+	if less == nil {
+		less = func(a, b *Cmd) bool { return a.Weight < b.Weight }
 	}
+	sort.SliceStable(cmds, func(i, j int) bool { return less(cmds[i], cmds[j]) })
+	return cmds
+}
 
-	for i, arg := range c.arglist {
-		if arg.required && !(arg_mask[i] > 0) {
-			return fmt.Errorf("%s is a required argument", arg.longFlag)
-		}
-		if !arg.canHaveMultiple && arg_mask[i] > 1 {
-			return fmt.Errorf("There cannot be multiple instances of %s", arg.longFlag)
+// cmdAdds counts the commands added, see OrderAdded.
+var cmdAdds uint64
+
+// OrderAdded orders commands by when they were added to their parent, as
+// Cmd.OrderChildren. Commands of providers come first.
+func OrderAdded(a, b *Cmd) bool {
+	return atomic.LoadUint64(&a.addSeq) < atomic.LoadUint64(&b.addSeq)
+}
+
+// SkipCmd can be returned by the function given to Walk to skip the
+// subcommands of the command visited.
+var SkipCmd = errors.New("skip this command")
+
+// Walk calls f for c and every command below it, depth first with
+// subcommands in the order of Children. path holds the names of the
+// commands from below c to the one visited, so it is empty for c and, for a
+// Shell's root, the words that run the command. Walk stops at the first
+// error f returns and returns it, except for SkipCmd.
+func (c *Cmd) Walk(f func(path []string, c *Cmd) error) error {
+	err := c.walk(nil, f)
+	if err == SkipCmd {
+		return nil
+	}
+	return err
+}
+
+func (c *Cmd) walk(path []string, f func(path []string, c *Cmd) error) error {
+	if err := f(path, c); err != nil {
+		return err
+	}
+	for _, child := range c.Children() {
+		err := child.walk(append(path[:len(path):len(path)], child.Name), f)
+		if err != nil && err != SkipCmd {
+			return err
 		}
 	}
 	return nil
 }
 
-// Parses args, returns keys to the values
-func (c Cmd) ParseArgs(args []string) ([]ParsedArg, error) {
-	ret := make([]ParsedArg, 0)
+// provided returns the subcommands of the providers that are not shadowed
+// by added ones. The providers are called once until refreshProviders, one
+// at a time and without holding cmdTree, so they may add commands themselves.
+func (c *Cmd) provided() []*Cmd {
+	cmdTree.RLock()
+	providers, cache := c.providers, c.providerCmds
+	cmdTree.RUnlock()
+	if cache == nil {
+		return nil
+	}
+	cache.mu.Lock()
+	if gen := atomic.LoadUint64(&providerGen); !cache.called || cache.gen != gen {
+		var cmds []*Cmd
+		for _, provider := range providers {
+			cmds = append(cmds, provider()...)
+		}
+		cache.called, cache.gen, cache.cmds = true, gen, cmds
+		// commands without a parent get c, once
+		cmdTree.Lock()
+		for _, cmd := range cmds {
+			if cmd.parent == nil {
+				cmd.parent = c
+			}
+		}
+		cmdTree.Unlock()
+	}
+	all := cache.cmds
+	cache.mu.Unlock()
 
-	if len(args) == 0 {
-		return nil, nil
+	var cmds []*Cmd
+	for _, cmd := range all {
+		if _, ok := c.child(cmd.Name); !ok {
+			cmds = append(cmds, cmd)
+		}
 	}
+	return cmds
+}
 
-	further_split := c.initial_pass(args)
+// Parent returns the command c was added to, or nil for a root command, or
+// one that was deleted. Commands of a provider that have none get the
+// first command to list them.
+func (c *Cmd) Parent() *Cmd {
+	cmdTree.RLock()
+	defer cmdTree.RUnlock()
+	return c.parent
+}
+
+// Path returns the names of c and its parents, from below the root command
+// down, e.g. []string{"net", "ping"}. For commands of a Shell, these are the
+// words that run c, so the path of the root command itself is empty.
+func (c *Cmd) Path() []string {
+	cmdTree.RLock()
+	defer cmdTree.RUnlock()
+	var path []string
+	for cmd := c; cmd.parent != nil; cmd = cmd.parent {
+		path = append([]string{cmd.Name}, path...)
+	}
+	return path
+}
+
+func (c *Cmd) hasSubcommand() bool {
+	n := len(c.added()) + len(c.provided())
+	if n > 1 {
+		return true
+	}
+	if _, ok := c.child("help"); !ok {
+		return n > 0
+	}
+	return false
+}
+
+// HelpText returns the computed help of the command and its subcommands.
+func (c *Cmd) HelpText() string {
+	return c.themedHelpText(PlainTheme)
+}
+
+// themedHelpText is HelpText styled with t.
+func (c *Cmd) themedHelpText(t *Theme) string {
+	if c.HelpTemplate != nil {
+		return c.templateHelpText(c.HelpTemplate, t)
+	}
+	return c.buildHelpText(t)
+}
+
+// invalidateIndexes drops the completion indexes. The caller must hold
+// cmdTree.
+func (c *Cmd) invalidateIndexes() {
+	c.childIndex = nil
+	c.flagIndex = nil
+}
+
+func (c *Cmd) buildHelpText(t *Theme) string {
+	var b bytes.Buffer
+	p := func(s ...interface{}) {
+		fmt.Fprintln(&b)
+		if len(s) > 0 {
+			fmt.Fprintln(&b, s...)
+		}
+	}
+	args := c.visibleArgs()
+	if len(args) > 0 {
+		p("Usage:", c.Usage())
+	}
+	if c.LongHelp != "" {
+		p(c.LongHelp)
+	} else if c.Help != "" {
+		p(c.Help)
+	} else if c.Name != "" {
+		p(c.Name, "has no help")
+	}
+	if c.Deprecated {
+		p(styled(t.Warning, c.deprecation()))
+	}
+	if disabled, reason := c.Disabled(); disabled {
+		p(styled(t.Warning, (&ErrCmdDisabled{Name: c.Name, Reason: reason}).Error()))
+	}
+	if len(args) > 0 {
+		for _, group := range groupArgs(args) {
+			p(styled(t.Heading, group.name+":"))
+			w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+			for _, arg := range group.args {
+				fmt.Fprintf(w, "\t%s\t%s\t\t\t%s\n", styled(t.Flag, arg.name()), arg.typ, arg.description())
+			}
+			w.Flush()
+		}
+	}
+	if len(c.Examples) > 0 {
+		p(styled(t.Heading, "Examples:"))
+		w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		for _, example := range c.Examples {
+			if example.Description == "" {
+				fmt.Fprintf(w, "\t%s\n", styled(t.Command, example.Line))
+				continue
+			}
+			fmt.Fprintf(w, "\t%s\t\t\t%s\n", styled(t.Command, example.Line), example.Description)
+		}
+		w.Flush()
+	}
+	if (len(args) > 0 || len(c.Examples) > 0) && !c.hasSubcommand() {
+		p()
+	}
+	if c.hasSubcommand() {
+		for _, category := range categorize(c.Children()) {
+			p(styled(t.Heading, category.name+":"))
+			w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+			for _, child := range category.cmds {
+				help := child.Help
+				if child.Deprecated {
+					help = strings.TrimSpace(help + " (deprecated)")
+				}
+				if disabled, reason := child.Disabled(); disabled && reason != "" {
+					help = strings.TrimSpace(help + " (disabled: " + reason + ")")
+				} else if disabled {
+					help = strings.TrimSpace(help + " (disabled)")
+				}
+				fmt.Fprintf(w, "\t%s\t\t\t%s\n", styled(t.Command, child.Name), help)
+			}
+			w.Flush()
+		}
+		p()
+	}
+	return b.String()
+}
+
+// MarkdownHelp returns a markdown document describing the command and
+// every command below it. Subtrees are rendered concurrently, which keeps
+// exporting large trees fast; the output order matches Children.
+func (c *Cmd) MarkdownHelp() string {
+	return c.markdownHelp(nil)
+}
+
+func (c *Cmd) markdownHelp(path []string) string {
+	if c.Name != "" {
+		path = append(path[:len(path):len(path)], c.Name)
+	}
+
+	children := c.Children()
+	docs := make([]string, len(children))
+	var wg sync.WaitGroup
+	for i, child := range children {
+		wg.Add(1)
+		go func(i int, child *Cmd) {
+			defer wg.Done()
+			docs[i] = child.markdownHelp(path)
+		}(i, child)
+	}
+
+	var b bytes.Buffer
+	if len(path) > 0 {
+		fmt.Fprintf(&b, "%s %s\n\n", strings.Repeat("#", len(path)), strings.Join(path, " "))
+		if len(c.Aliases) > 0 {
+			fmt.Fprintf(&b, "Aliases: %s\n\n", strings.Join(c.Aliases, ", "))
+		}
+		if c.LongHelp != "" {
+			fmt.Fprintf(&b, "%s\n\n", c.LongHelp)
+		} else if c.Help != "" {
+			fmt.Fprintf(&b, "%s\n\n", c.Help)
+		}
+		if len(c.Examples) > 0 {
+			b.WriteString("Examples:\n\n```\n")
+			for _, example := range c.Examples {
+				if example.Description != "" {
+					fmt.Fprintf(&b, "# %s\n", example.Description)
+				}
+				fmt.Fprintf(&b, "%s\n", example.Line)
+			}
+			b.WriteString("```\n\n")
+		}
+	}
+	wg.Wait()
+	for _, doc := range docs {
+		b.WriteString(doc)
+	}
+	return b.String()
+}
+
+// findChildCmd returns the subcommand with matching name or alias, ignoring
+// case if fold is true.
+func (c *Cmd) findChildCmd(name string, fold bool) *Cmd {
+	// find perfect matches first
+	if cmd, ok := c.child(name); ok {
+		return cmd
+	}
+
+	added := c.added()
+	if fold {
+		// sorted, so the match does not depend on map order
+		sort.Sort(cmdSorter(added))
+		for _, cmd := range added {
+			if strings.EqualFold(cmd.Name, name) {
+				return cmd
+			}
+		}
+	}
+
+	// find alias matching the name
+	for _, cmd := range added {
+		if has_name(cmd.Aliases, name, fold) {
+			return cmd
+		}
+	}
+
+	// ask the providers last
+	for _, cmd := range c.provided() {
+		if has_name([]string{cmd.Name}, name, fold) || has_name(cmd.Aliases, name, fold) {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+// has_name tells if names contains name, ignoring case if fold is true.
+func has_name(names []string, name string, fold bool) bool {
+	for _, n := range names {
+		if n == name || (fold && strings.EqualFold(n, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// findPath returns the commands named by the leading words of args, from
+// the subcommand of c down, and the number of words naming them.
+func (c *Cmd) findPath(args []string) ([]*Cmd, int) {
+	var path []*Cmd
+	parent := c
+	fold, sep := c.lookupSettings(false, "")
+	for n, arg := range args {
+		names := []string{arg}
+		if sep != "" && strings.Contains(arg, sep) && parent.findChildCmd(arg, fold) == nil {
+			names = strings.Split(arg, sep)
+		}
+		var cmds []*Cmd
+		for _, name := range names {
+			child := parent.findChildCmd(name, fold)
+			if child == nil {
+				return path, n
+			}
+			cmds = append(cmds, child)
+			parent = child
+			fold, sep = child.lookupSettings(fold, sep)
+		}
+		path = append(path, cmds...)
+	}
+	return path, len(args)
+}
+
+// lookupSettings returns whether to ignore case and the namespace
+// separator for the subcommands of c, given those c was found with.
+func (c *Cmd) lookupSettings(fold bool, sep string) (bool, string) {
+	if c.NamespaceSeparator != "" {
+		sep = c.NamespaceSeparator
+	}
+	return fold || c.IgnoreCase, sep
+}
+
+// FindCmd finds the matching Cmd for args.
+// It returns the Cmd and the remaining args.
+func (c *Cmd) FindCmd(args []string) (*Cmd, []string) {
+	path, n := c.findPath(args)
+	switch {
+	case len(args) == 0:
+		return nil, nil
+	case n == 0:
+		return nil, args
+	case n == len(args):
+		return path[len(path)-1], nil
+	}
+	return path[len(path)-1], args[n:]
+}
+
+// deprecation returns the warning for using a deprecated command.
+func (c *Cmd) deprecation() string {
+	if c.DeprecationMessage != "" {
+		return fmt.Sprintf("Command '%s' is deprecated, %s", c.Name, c.DeprecationMessage)
+	}
+	return fmt.Sprintf("Command '%s' is deprecated", c.Name)
+}
+
+// catches tells if NotFoundFunc handles args, which follow the command.
+func (c *Cmd) catches(args []string) bool {
+	return c.NotFoundFunc != nil && len(args) > 0 && !strings.HasPrefix(args[0], "-")
+}
+
+// Disable makes the command, and its subcommands, fail with
+// *ErrCmdDisabled instead of running until Enable is called, e.g. with
+// reason "requires login". Unlike DeleteCmd it stays in help, marked with
+// reason, and in completion. It is safe to call while the shell is running.
+func (c *Cmd) Disable(reason string) {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	c.disabled, c.disabledReason = true, reason
+}
+
+// Enable lets a command disabled with Disable run again.
+func (c *Cmd) Enable() {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	c.disabled, c.disabledReason = false, ""
+}
+
+// Disabled tells if the command is disabled, and the reason given to
+// Disable.
+func (c *Cmd) Disabled() (bool, string) {
+	cmdTree.RLock()
+	defer cmdTree.RUnlock()
+	return c.disabled, c.disabledReason
+}
+
+// ErrCmdDisabled is the error of running a command disabled with
+// Cmd.Disable.
+type ErrCmdDisabled struct {
+	// Name is the name of the disabled command, which may be a parent of
+	// the one run.
+	Name string
+	// Reason is the reason given to Disable.
+	Reason string
+}
+
+func (e *ErrCmdDisabled) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("Command '%s' is disabled, %s", e.Name, e.Reason)
+	}
+	return fmt.Sprintf("Command '%s' is disabled", e.Name)
+}
+
+// run calls ErrFunc or Func between PreRun and PostRun.
+func (c *Cmd) run(ctx *Context) {
+	if c.PreRun != nil {
+		if c.PreRun(ctx); ctx.err != nil {
+			return
+		}
+	}
+	if c.ErrFunc != nil {
+		if err := c.ErrFunc(ctx); err != nil {
+			ctx.Err(err)
+		}
+	} else {
+		c.Func(ctx)
+	}
+	if c.PostRun != nil {
+		c.PostRun(ctx)
+	}
+}
+
+// FindCmdStrict is FindCmd that fails with an *ErrCmdNotFound when args
+// don't start with a command name, or when they continue with a word that
+// is neither a subcommand nor an argument of the command found. The error
+// suggests commands with similar names.
+func (c *Cmd) FindCmdStrict(args []string) (*Cmd, []string, error) {
+	cmd, rest := c.FindCmd(args)
+	if cmd == nil {
+		if len(args) == 0 {
+			return nil, nil, &ErrCmdNotFound{}
+		}
+		return nil, rest, &ErrCmdNotFound{Name: args[0], Suggestions: c.suggest(args[0])}
+	}
+	if len(rest) > 0 && cmd.hasSubcommand() && !cmd.rawArgs && !is_short_arg(rest[0]) && !cmd.hasPositional() && cmd.NotFoundFunc == nil {
+		return nil, rest, &ErrCmdNotFound{Name: rest[0], Path: args[:len(args)-len(rest)], Suggestions: cmd.suggest(rest[0])}
+	}
+	return cmd, rest, nil
+}
+
+// hasPositional tells if the command has a positional argument.
+func (c *Cmd) hasPositional() bool {
+	for _, arg := range c.arglist {
+		if arg.positional {
+			return true
+		}
+	}
+	return false
+}
+
+// Example is a use of a command shown in its help.
+type Example struct {
+	// Line is the command line, e.g. "net ping -c 3 example.com".
+	Line string `json:"line" yaml:"line"`
+	// Description says what Line does, e.g. "ping three times".
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// ErrCmdNotFound is returned by FindCmdStrict for a name that matches no
+// command. errors.Is reports it as ErrUnknownCommand.
+type ErrCmdNotFound struct {
+	// Name is the unknown name.
+	Name string
+	// Path are the names of the commands found before it.
+	Path []string
+	// Suggestions are the names of similar commands, closest first.
+	Suggestions []string
+}
+
+func (e *ErrCmdNotFound) Error() string {
+	msg := fmt.Sprintf("Unknown command '%s'", e.Name)
+	if len(e.Path) > 0 {
+		msg += fmt.Sprintf(" in '%s'", strings.Join(e.Path, " "))
+	}
+	if len(e.Suggestions) > 0 {
+		quoted := make([]string, len(e.Suggestions))
+		for i, name := range e.Suggestions {
+			quoted[i] = "'" + name + "'"
+		}
+		msg += ", did you mean " + strings.Join(quoted, " or ") + "?"
+	}
+	return msg
+}
+
+func (e *ErrCmdNotFound) Is(target error) bool {
+	return target == ErrUnknownCommand
+}
+
+// Check to see if the string is a long argument param
+func is_long_arg(str string) bool {
+	return len(str) > 2 && str[:2] == "--"
+}
+
+// Check to see if the string is a short argument param
+// didn't check to see if the second char is "-"
+func is_short_arg(str string) bool {
+	return len(str) > 1 && str[:1] == "-"
+}
+
+/*
+Returns the index if arg matches either a Flag or LongFlag in the command's 'args'
+parameter.
+*/
+func (c *Cmd) find_arg(arg string) int {
+	if !is_short_arg(arg) {
+		return -1
+	}
+	if index, ok := c.argindex[arg]; ok {
+		return index
+	}
+	if c.IgnoreFlagCase && is_long_arg(arg) {
+		for i, argument := range c.arglist {
+			if argument.positional {
+				continue
+			}
+			for _, longFlag := range argument.longFlags() {
+				if strings.EqualFold(longFlag, arg) {
+					return i
+				}
+			}
+		}
+	}
+	return -1
+}
+
+/*
+Returns the index of the long flag that arg is a unique prefix of, such as
+"--verb" for "--verbose", and an error if arg is a prefix of several.
+*/
+func (c *Cmd) find_abbreviated(arg string) (int, error) {
+	index := -1
+	var candidates []string
+	if c.IgnoreFlagCase {
+		arg = strings.ToLower(arg)
+	}
+	for i, argument := range c.arglist {
+		// hidden and deprecated flags are only accepted in full
+		if argument.positional || argument.Hidden || argument.Deprecated {
+			continue
+		}
+		for _, longFlag := range argument.longFlags() {
+			if c.IgnoreFlagCase {
+				longFlag = strings.ToLower(longFlag)
+			}
+			if strings.HasPrefix(longFlag, arg) {
+				index = i
+				candidates = append(candidates, argument.longFlag)
+				break
+			}
+		}
+	}
+	if len(candidates) > 1 {
+		return -1, newParseError(ErrAmbiguousFlag, "Ambiguous flag %s, could be %s", arg, strings.Join(candidates, ", "))
+	}
+	return index, nil
+}
+
+/*
+Returns the index of the BoolType argument set explicitly by arg and its
+value, for "--flag=true", "--flag=false" and the negation "--no-flag". The
+index is -1 if arg is not of these forms.
+*/
+func (c *Cmd) find_bool(arg string) (int, bool, error) {
+	if !is_long_arg(arg) {
+		return -1, false, nil
+	}
+	if name, value, ok := strings.Cut(arg, "="); ok {
+		index := c.find_arg(name)
+		if index == -1 {
+			var err error
+			if index, err = c.find_abbreviated(name); err != nil {
+				return -1, false, err
+			}
+		}
+		if index == -1 || c.arglist[index].typ != BoolType {
+			return -1, false, nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return -1, false, newParseError(ErrInvalidValue, "Argument '%s' must be true or false, not %s", c.arglist[index].longFlag, value)
+		}
+		return index, b, nil
+	}
+	if strings.HasPrefix(arg, "--no-") && c.find_arg(arg) == -1 {
+		index := c.find_arg("--" + arg[len("--no-"):])
+		if index != -1 && c.arglist[index].typ == BoolType {
+			return index, false, nil
+		}
+	}
+	return -1, false, nil
+}
+
+/*
+Returns the index of the positional argument that takes the next positional
+value, with left values remaining including this one. An argument that can
+have multiple values takes more only when enough are left for the required
+positional arguments after it, so "cp <src>... <dst>" works.
+*/
+func (c *Cmd) find_positional(arg_mask []int, left int) int {
+	index := -1
+	for i, argument := range c.arglist {
+		// is positional
+		if argument.positional {
+			// check to see if it already exists
+			if arg_mask[i] == 0 {
+				return i
+			} else {
+				if (argument.canHaveMultiple || argument.Rest) && left > c.required_positionals_after(arg_mask, i) {
+					return i
+				}
+			}
+		}
+	}
+	return index
+}
+
+// counts the required positional arguments after index that have no value
+func (c *Cmd) required_positionals_after(arg_mask []int, index int) int {
+	n := 0
+	for i := index + 1; i < len(c.arglist); i++ {
+		if c.arglist[i].positional && c.arglist[i].required && arg_mask[i] == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// counts the tokens that are positional values, i.e. that are not flags or
+// their values
+func (c *Cmd) count_positionals(tokens []string) int {
+	n := 0
+	for k := 0; k < len(tokens); k++ {
+		token := tokens[k]
+		if token == endOfFlags {
+			return n + len(tokens) - k - 1
+		}
+		if !is_short_arg(token) || is_negative_number(token) {
+			n++
+			continue
+		}
+		index := c.find_arg(token)
+		if index == -1 && is_long_arg(token) {
+			index, _ = c.find_abbreviated(token)
+		}
+		if index != -1 && c.takes_value(c.arglist[index].longFlag) {
+			k++
+		}
+	}
+	return n
+}
+
+// checks to see if the flag belongs to an argument
+func (c *Cmd) has_flag(flag string) bool {
+	return c.find_arg(flag) != -1
+}
+
+// checks to see if the flag belongs to an argument that takes a value
+func (c *Cmd) takes_value(flag string) bool {
+	index := c.find_arg(flag)
+	if index == -1 {
+		return false
+	}
+	typ := c.arglist[index].typ
+	return typ != BoolType && typ != CountType
+}
+
+// Check to see if the string is a negative number such as "-5" or "-3.2"
+func is_negative_number(str string) bool {
+	if len(str) < 2 || str[0] != '-' || !(str[1] == '.' || (str[1] >= '0' && str[1] <= '9')) {
+		return false
+	}
+	_, err := strconv.ParseFloat(str, 64)
+	return err == nil
+}
+
+// checks to see if the next positional argument takes a number
+func (c *Cmd) numeric_positional_next(arg_mask []int, left int) bool {
+	index := c.find_positional(arg_mask, left)
+	if index == -1 {
+		return false
+	}
+	typ := c.arglist[index].typ
+	return typ == IntType || typ == FloatType
+}
+
+// checks to see if an integer argument is a valid integer
+func validate_int(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// validates the value of the argument at index and converts it to its type
+func (c *Cmd) parse_value(index int, value string) (interface{}, error) {
+	switch c.arglist[index].typ {
+	case IntSliceType, StringSliceType:
+		return c.parse_slice(index, value)
+	}
+	if err := c.check_choices(index, value); err != nil {
+		return nil, err
+	}
+	parsed, err := c.convert_value(index, value)
+	if err != nil {
+		return nil, err
+	}
+	switch n := parsed.(type) {
+	case int:
+		err = c.check_range(index, float64(n))
+	case float64:
+		err = c.check_range(index, n)
+	}
+	if err == nil && c.arglist[index].typ == StringType {
+		err = c.check_pattern(index, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if validator := c.arglist[index].Validator; validator != nil {
+		if err := validator(value); err != nil {
+			return nil, newParseError(ErrInvalidValue, "Argument '%s': %v", c.arglist[index].longFlag, err)
+		}
+	}
+	return parsed, nil
+}
+
+// splits the value of the slice argument at index on its delimiter and
+// validates every element
+func (c *Cmd) parse_slice(index int, value string) (interface{}, error) {
+	arg := c.arglist[index]
+	delimiter := arg.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	var ints []int
+	var strs []string
+	for _, elem := range strings.Split(value, delimiter) {
+		elem = strings.TrimSpace(elem)
+		if err := c.check_choices(index, elem); err != nil {
+			return nil, err
+		}
+		if arg.typ == IntSliceType {
+			i, err := strconv.Atoi(elem)
+			if err != nil {
+				return nil, newParseError(ErrInvalidInt, "String %s is not a valid integer for argument '%s'", elem, arg.longFlag)
+			}
+			if err := c.check_range(index, float64(i)); err != nil {
+				return nil, err
+			}
+			ints = append(ints, i)
+		} else {
+			if err := c.check_pattern(index, elem); err != nil {
+				return nil, err
+			}
+			strs = append(strs, elem)
+		}
+		if arg.Validator != nil {
+			if err := arg.Validator(elem); err != nil {
+				return nil, newParseError(ErrInvalidValue, "Argument '%s': %v", arg.longFlag, err)
+			}
+		}
+	}
+	if arg.typ == IntSliceType {
+		return ints, nil
+	}
+	return strs, nil
+}
+
+// checks that the value matches the pattern of the argument at index, if any
+func (c *Cmd) check_pattern(index int, value string) error {
+	arg := c.arglist[index]
+	if arg.Pattern == nil || arg.Pattern.MatchString(value) {
+		return nil
+	}
+	return newParseError(ErrInvalidValue, "Argument '%s' must match %s", arg.longFlag, arg.Pattern)
+}
+
+// checks that the number n is within the bounds of the argument at index
+func (c *Cmd) check_range(index int, n float64) error {
+	arg := c.arglist[index]
+	if (arg.Min != nil && n < *arg.Min) || (arg.Max != nil && n > *arg.Max) {
+		return newParseError(ErrInvalidValue, "%s must be %s", arg.longFlag, arg.bounds())
+	}
+	return nil
+}
+
+// checks that the value is one of the choices of the argument at index, if any
+func (c *Cmd) check_choices(index int, value string) error {
+	arg := c.arglist[index]
+	if len(arg.Choices) == 0 {
+		return nil
+	}
+	for _, choice := range arg.Choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return newParseError(ErrInvalidValue, "Argument '%s' must be one of %s", arg.longFlag, strings.Join(arg.Choices, ", "))
+}
+
+// defaultTimeLayouts are the layouts of TimeType arguments without Layouts.
+var defaultTimeLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// converts the value of the argument at index to its type
+func (c *Cmd) convert_value(index int, value string) (interface{}, error) {
+	switch c.arglist[index].typ {
+	case IntType:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, newParseError(ErrInvalidInt, "String %s is not a valid integer for argument '%d'", value, index)
+		}
+		return i, nil
+	case FloatType:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, newParseError(ErrInvalidValue, "String %s is not a valid float for argument '%d'", value, index)
+		}
+		return f, nil
+	case DurationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, newParseError(ErrInvalidValue, "String %s is not a valid duration for argument '%d'", value, index)
+		}
+		return d, nil
+	case URLType:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, newParseError(ErrInvalidValue, "String %s is not a valid URL for argument '%d'", value, index)
+		}
+		return u, nil
+	case IPType:
+		ip, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, newParseError(ErrInvalidValue, "String %s is not a valid IP address for argument '%d'", value, index)
+		}
+		return ip, nil
+	case SizeType:
+		size, err := parse_size(value)
+		if err != nil {
+			return nil, newParseError(ErrInvalidValue, "Argument '%s': %v", c.arglist[index].longFlag, err)
+		}
+		return size, nil
+	case JSONType:
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, newParseError(ErrInvalidValue, "String %s is not valid JSON for argument '%d': %v", value, index, err)
+		}
+		return v, nil
+	case TimeType:
+		layouts := c.arglist[index].Layouts
+		if len(layouts) == 0 {
+			layouts = defaultTimeLayouts
+		}
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+		return nil, newParseError(ErrInvalidValue, "String %s is not a valid time for argument '%d', use %s", value, index, strings.Join(layouts, " or "))
+	case FilePathType:
+		if err := check_path(value, c.arglist[index].PathCheck); err != nil {
+			return nil, newParseError(ErrInvalidValue, "Argument '%s': %v", c.arglist[index].longFlag, err)
+		}
+	case BoolType:
+		return true, nil
+	}
+	if custom, ok := lookupArgType(c.arglist[index].typ); ok {
+		v, err := custom.parse(value)
+		if err != nil {
+			return nil, newParseError(ErrInvalidValue, "String %s is not a valid %s for argument '%d': %v", value, custom.name, index, err)
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// validates the arguments to make sure there are no repeats that aren't allowed, or if every
+// required argument exists
+func (c *Cmd) validate_args(arg_mask []int, parsed ParsedArgs) error {
+	// iterate through every argument given with the command and check the count
+	// that each arg has in the counter. validate that the required commands exist,
+	// and that there aren't any arguments that shouldnt have multiples.
+	for _, arg := range parsed {
+		if arg.Typ != BoolType && arg.Value == "" {
+			return newParseError(ErrMissingValue, "Argument '%s' requires a value", arg.Key)
+		}
+	}
+
+	for i, arg := range c.arglist {
+		if arg.required && !(arg_mask[i] > 0) {
+			return &ErrMissingRequired{Arg: arg.longFlag}
+		}
+		if !arg.canHaveMultiple && !arg.Rest && arg.typ != CountType && arg_mask[i] > 1 {
+			return newParseError(ErrTooManyValues, "There cannot be multiple instances of %s", arg.longFlag)
+		}
+		if arg_mask[i] == 0 {
+			continue
+		}
+		for _, key := range arg.Requires {
+			index := c.find_key(key)
+			if index == -1 {
+				return fmt.Errorf("Argument '%s' requires unknown argument '%s'", arg.longFlag, key)
+			}
+			if arg_mask[index] == 0 {
+				return &ErrMissingRequired{Arg: key, RequiredBy: arg.longFlag}
+			}
+		}
+	}
+	return nil
+}
+
+// counts another occurrence of a CountType argument, the count is kept in its
+// first entry
+func (c *Cmd) count(parsed ParsedArgs, arg ParsedArg) ParsedArgs {
+	for i := range parsed {
+		if parsed[i].Index == arg.Index {
+			n := parsed[i].Parsed.(int) + 1
+			parsed[i].Parsed = n
+			parsed[i].Value = strconv.Itoa(n)
+			parsed[i].End = arg.End
+			return parsed
+		}
+	}
+	arg.Parsed = 1
+	arg.Value = "1"
+	return append(parsed, arg)
+}
+
+// returns a warning for each deprecated argument in parsed
+func (c *Cmd) deprecation_warnings(parsed ParsedArgs) []string {
+	var warnings []string
+	var warned []int
+next:
+	for _, p := range parsed {
+		if !c.arglist[p.Index].Deprecated {
+			continue
+		}
+		for _, index := range warned {
+			if index == p.Index {
+				continue next
+			}
+		}
+		warned = append(warned, p.Index)
+		warnings = append(warnings, c.arglist[p.Index].deprecation())
+	}
+	return warnings
+}
 
-	// checking so see which args currently exist for positionals
-	arg_mask := make([]int, len(c.arglist))
+// adds the default values of the arguments that were not given. defaults,
+// keyed by longFlag, take precedence over the arguments' own Default.
+func (c *Cmd) add_defaults(arg_mask []int, parsed ParsedArgs, defaults map[string][]string) (ParsedArgs, error) {
+	for i, arg := range c.arglist {
+		if arg_mask[i] > 0 {
+			continue
+		}
+		values, ok := defaults[arg.longFlag]
+		if !ok && arg.Default != "" {
+			values = []string{arg.Default}
+		}
+		for _, value := range values {
+			default_arg := ParsedArg{Index: i, Key: arg.longFlag, Typ: arg.typ}
+			switch arg.typ {
+			case BoolType:
+				if b, err := strconv.ParseBool(value); err != nil || !b {
+					continue
+				}
+				default_arg.Parsed = true
+			case CountType:
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return parsed, fmt.Errorf("Default %s is not a valid count for argument '%s'", value, arg.longFlag)
+				}
+				default_arg.Value = value
+				default_arg.Parsed = n
+			default:
+				converted, err := c.parse_value(i, value)
+				if err != nil {
+					return parsed, err
+				}
+				default_arg.Value = value
+				default_arg.Parsed = converted
+			}
+			parsed = append(parsed, default_arg)
+			arg_mask[i] += 1
+		}
+	}
+	return parsed, nil
+}
+
+// adds value, given at origin in the arguments, as the positional argument
+// at index
+func (c *Cmd) add_positional(parsed ParsedArgs, arg_mask []int, index int, value string, origin int) (ParsedArgs, error) {
+	converted, err := c.parse_value(index, value)
+	if err != nil {
+		return parsed, err
+	}
+	arg_mask[index] += 1
+	return append(parsed, ParsedArg{
+		Index:  index,
+		Key:    c.arglist[index].longFlag,
+		Typ:    c.arglist[index].typ,
+		Value:  value,
+		Parsed: converted,
+		Start:  origin,
+		End:    origin + 1,
+	}), nil
+}
+
+// reads the required SecretType arguments that were not given with prompt
+func (c *Cmd) prompt_secrets(arg_mask []int, parsed ParsedArgs, prompt func(arg *CmdArg) (string, error)) (ParsedArgs, error) {
+	if prompt == nil {
+		return parsed, nil
+	}
+	for i, arg := range c.arglist {
+		if arg.typ != SecretType || !arg.required || arg_mask[i] > 0 {
+			continue
+		}
+		value, err := prompt(arg)
+		if err != nil {
+			return parsed, err
+		}
+		parsed = append(parsed, ParsedArg{Index: i, Key: arg.longFlag, Typ: SecretType, Value: value, Parsed: value})
+		arg_mask[i] += 1
+	}
+	return parsed, nil
+}
+
+// returns a copy of args with the values of SecretType arguments replaced,
+// for logging
+func (c *Cmd) redact_secrets(args []string) []string {
+	ret := append([]string(nil), args...)
+	for i := 0; i < len(ret); i++ {
+		arg := ret[i]
+		if arg == endOfFlags {
+			break
+		}
+		if !is_short_arg(arg) || is_negative_number(arg) {
+			continue
+		}
+		if is_long_arg(arg) || len(arg) <= 2 {
+			index := c.find_arg(arg)
+			if index == -1 && is_long_arg(arg) {
+				index, _ = c.find_abbreviated(arg)
+			}
+			if index != -1 && c.takes_value(c.arglist[index].longFlag) && i+1 < len(ret) {
+				i++
+				if c.arglist[index].typ == SecretType {
+					ret[i] = redacted
+				}
+			}
+			continue
+		}
+		// grouped short flags, the first one taking a value takes the rest
+		// of the group or the next word, e.g. "-vpsecret" or "-vp secret"
+		for j, char := range arg[1:] {
+			index := c.find_arg("-" + string(char))
+			if index == -1 || !c.takes_value(c.arglist[index].longFlag) {
+				continue
+			}
+			secret := c.arglist[index].typ == SecretType
+			if rest := 1 + j + utf8.RuneLen(char); rest < len(arg) {
+				if secret {
+					ret[i] = arg[:rest] + redacted
+				}
+			} else if i+1 < len(ret) {
+				i++
+				if secret {
+					ret[i] = redacted
+				}
+			}
+			break
+		}
+	}
+	return ret
+}
+
+// redacted replaces secret values in logs.
+const redacted = "***"
+
+// Returns the index of the argument with the given longFlag
+func (c *Cmd) find_key(key string) int {
+	for i, arg := range c.arglist {
+		if arg.longFlag == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// tells if the argument at index is in parsed and, for a BoolType argument,
+// was not set to false
+func is_set(parsed ParsedArgs, index int) bool {
+	for _, p := range parsed {
+		if p.Index == index && p.Parsed != false {
+			return true
+		}
+	}
+	return false
+}
+
+// adds the arguments implied by the given ones that are missing
+func (c *Cmd) add_implied(arg_mask []int, parsed ParsedArgs) (ParsedArgs, error) {
+	for i := 0; i < len(c.arglist); i++ {
+		arg := c.arglist[i]
+		if arg_mask[i] == 0 || len(arg.Implies) == 0 || !is_set(parsed, i) {
+			continue
+		}
+		for _, key := range arg.Implies {
+			index := c.find_key(key)
+			if index == -1 || c.arglist[index].typ != BoolType {
+				return parsed, fmt.Errorf("Argument '%s' implies '%s' which is not a boolean argument", arg.longFlag, key)
+			}
+			if arg_mask[index] > 0 {
+				continue
+			}
+			parsed = append(parsed, ParsedArg{Index: index, Key: key, Typ: BoolType, Parsed: true})
+			arg_mask[index] += 1
+			// implied arguments can imply others in turn
+			if index < i {
+				i = index - 1
+				break
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// Parses args, returns keys to the values
+func (c *Cmd) ParseArgs(args []string) (ParsedArgs, error) {
+	return c.parseArgs(args, parseOptions{})
+}
+
+// ParseArgsLenient is ParseArgs that returns the arguments it does not
+// recognize instead of failing on them, e.g. for a command that forwards
+// unknown flags to another tool. Grouped short flags with an unknown flag
+// are returned as given.
+func (c *Cmd) ParseArgsLenient(args []string) (ParsedArgs, []string, error) {
+	var unknown []string
+	parsed, err := c.parseArgs(args, parseOptions{unknown: &unknown})
+	return parsed, unknown, err
+}
+
+// parseOptions changes how parseArgs parses.
+type parseOptions struct {
+	// defaults, keyed by longFlag, for the arguments not given
+	defaults map[string][]string
+	// prompt, if not nil, reads the required secrets not given
+	prompt func(arg *CmdArg) (string, error)
+	// unknown, if not nil, collects the unknown arguments instead of failing
+	unknown *[]string
+}
+
+// ParseArgs with opts
+func (c *Cmd) parseArgs(args []string, opts parseOptions) (ParsedArgs, error) {
+	defaults, prompt := opts.defaults, opts.prompt
+	ret := make(ParsedArgs, 0, len(args))
+
+	// do an initial pass to split up arguments that can be put together
+	t := getTokenizer()
+	defer t.release()
+	further_split := t.split(args, c.takes_value, c.has_flag)
+
+	// checking so see which args currently exist for positionals.
+	// commands with few args can count on the stack.
+	var mask_buf [32]int
+	var arg_mask []int
+	if len(c.arglist) <= len(mask_buf) {
+		arg_mask = mask_buf[:len(c.arglist)]
+	} else {
+		arg_mask = make([]int, len(c.arglist))
+	}
 
 	var temp_arg ParsedArg
 	// once an arg is found, set awaiting_value to true
 	awaiting_value := false
-	for _, arg := range further_split {
-		index := c.find_arg(arg)
+	// set after "--", everything that follows is positional
+	flags_ended := false
+	// origin of the last unknown argument, see parseOptions
+	last_unknown := -1
+	// positional values that are not yet taken, see find_positional
+	positionals_left := c.count_positionals(further_split)
+	for k, arg := range further_split {
+		if arg == endOfFlags && !awaiting_value && !flags_ended {
+			flags_ended = true
+			continue
+		}
+		index := -1
+		// a negative number is a value when one is expected
+		is_value := is_negative_number(arg) && (awaiting_value || c.numeric_positional_next(arg_mask, positionals_left))
+		if !flags_ended && !is_value {
+			bool_index, value, err := c.find_bool(arg)
+			if err != nil {
+				return ret, err
+			}
+			if bool_index != -1 {
+				ret = append(ret, ParsedArg{Index: bool_index, Key: c.arglist[bool_index].longFlag, Typ: BoolType, Parsed: value, Start: t.origin[k], End: t.origin[k] + 1})
+				arg_mask[bool_index] += 1
+				continue
+			}
+			index = c.find_arg(arg)
+			if index == -1 && is_long_arg(arg) {
+				var err error
+				if index, err = c.find_abbreviated(arg); err != nil {
+					return ret, err
+				}
+			}
+		}
 
 		// found a matching arg!
 		if index != -1 {
@@ -348,59 +2144,126 @@ func (c Cmd) ParseArgs(args []string) ([]ParsedArg, error) {
 				Index: index,
 				Key:   c.arglist[index].longFlag,
 				Typ:   c.arglist[index].typ,
+				Start: t.origin[k],
+				End:   t.origin[k] + 1,
 			}
-			if c.arglist[index].typ != BoolType {
-				awaiting_value = true
-			} else {
+			switch c.arglist[index].typ {
+			case BoolType:
+				temp_arg.Parsed = true
 				ret = append(ret, temp_arg)
 				arg_mask[index] += 1
+			case CountType:
+				ret = c.count(ret, temp_arg)
+				arg_mask[index] += 1
+			default:
+				awaiting_value = true
 			}
 			continue
 		}
 
 		// didn't find the arg, if awaiting_value is true then this value is parsed_arg.
 		if index == -1 && awaiting_value {
-			if temp_arg.Typ == IntType && !validate_int(arg) {
-				return ret, fmt.Errorf("String %s is not a valid integer for argument '%d'", arg, temp_arg.Index)
+			parsed, err := c.parse_value(temp_arg.Index, arg)
+			if err != nil {
+				return ret, err
 			}
 			temp_arg.Value = arg
+			temp_arg.Parsed = parsed
+			temp_arg.End = t.origin[k] + 1
 			ret = append(ret, temp_arg)
 			arg_mask[temp_arg.Index] += 1
 			awaiting_value = false
 			continue
 		}
 
-		// awaiting_value == false, so look for positional argument
-		index = c.find_positional(arg_mask)
+		// awaiting_value == false, so look for positional argument. unknown
+		// flags are not taken as positional when they are collected.
+		if opts.unknown == nil || flags_ended || is_value || !is_short_arg(arg) {
+			index = c.find_positional(arg_mask, positionals_left)
+		}
+
+		// a rest argument takes everything that's left
+		if index != -1 && c.arglist[index].Rest {
+			values, origin := t.unsplit(args, k)
+			for j, value := range values {
+				var err error
+				if ret, err = c.add_positional(ret, arg_mask, index, value, origin[j]); err != nil {
+					return ret, err
+				}
+			}
+			break
+		}
 
 		// there's a positional argument that can fit this value!
 		if index != -1 {
-			temp_arg = ParsedArg{
-				Index: index,
-				Key:   c.arglist[index].longFlag,
-				Typ:   c.arglist[index].typ,
-				Value: arg,
+			var err error
+			if ret, err = c.add_positional(ret, arg_mask, index, arg, t.origin[k]); err != nil {
+				return ret, err
 			}
-			arg_mask[index] += 1
-
-			if temp_arg.Typ == IntType && !validate_int(arg) {
-				return ret, fmt.Errorf("String %s is not a valid integer for argument '%d'", arg, temp_arg.Index)
+			positionals_left--
+			if !c.StopAtPositional || k+1 == len(further_split) {
+				continue
 			}
-			ret = append(ret, temp_arg)
+			// everything after the first positional is positional
+			rest, origin := t.unsplit(args, k+1)
+			for j, value := range rest {
+				if index = c.find_positional(arg_mask, len(rest)-j); index != -1 {
+					if ret, err = c.add_positional(ret, arg_mask, index, value, origin[j]); err != nil {
+						return ret, err
+					}
+				} else if opts.unknown != nil {
+					*opts.unknown = append(*opts.unknown, value)
+				} else {
+					return ret, newParseError(ErrUnknownFlag, "Invalid argument %s", value)
+				}
+			}
+			break
+		} else if opts.unknown != nil {
+			// grouped short flags are kept together as given
+			if t.origin[k] != last_unknown {
+				*opts.unknown = append(*opts.unknown, args[t.origin[k]])
+			}
+			last_unknown = t.origin[k]
 		} else {
-			return ret, fmt.Errorf("Invalid argument %s", arg)
+			return ret, newParseError(ErrUnknownFlag, "Invalid argument %s", arg)
 		}
 	}
 
 	if awaiting_value {
-		return ret, fmt.Errorf("There is a parameter missing a value")
+		return ret, newParseError(ErrMissingValue, "There is a parameter missing a value")
+	}
+
+	// defaults are added first so that they can imply other arguments
+	ret, err := c.add_defaults(arg_mask, ret, defaults)
+	if err != nil {
+		return ret, err
+	}
+	if ret, err = c.add_implied(arg_mask, ret); err != nil {
+		return ret, err
+	}
+	if ret, err = c.prompt_secrets(arg_mask, ret, prompt); err != nil {
+		return ret, err
 	}
 
-	err := c.validate_args(arg_mask, ret)
+	err = c.validate_args(arg_mask, ret)
 
 	return ret, err
 }
 
+// ParseArgsMap is ParseArgs with the arguments keyed by their long flag, or
+// name for positional arguments.
+func (c *Cmd) ParseArgsMap(args []string) (map[string][]ParsedArg, error) {
+	parsed, err := c.ParseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]ParsedArg, len(c.arglist))
+	for _, arg := range parsed {
+		ret[arg.Key] = append(ret[arg.Key], arg)
+	}
+	return ret, nil
+}
+
 type cmdSorter []*Cmd
 
 func (c cmdSorter) Len() int           { return len(c) }
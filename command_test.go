@@ -1,8 +1,16 @@
 package ishell_test
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
 	"github.com/ryupatterson/ishell"
 	"github.com/stretchr/testify/assert"
 )
@@ -33,23 +41,194 @@ func TestFindCmd(t *testing.T) {
 	cmd := newCmd("root", "")
 	cmd.AddCmd(newCmd("child1", ""))
 	cmd.AddCmd(newCmd("child2", ""))
-	res, err := cmd.FindCmd([]string{"child1"})
-	if err != nil {
+	res, args := cmd.FindCmd([]string{"child1"})
+	if res == nil {
 		t.Fatal("finding should work")
 	}
 	assert.Equal(t, res.Name, "child1")
+	assert.Empty(t, args)
 
-	res, err = cmd.FindCmd([]string{"child2"})
-	if err != nil {
+	res, args = cmd.FindCmd([]string{"child2", "arg"})
+	if res == nil {
 		t.Fatal("finding should work")
 	}
 	assert.Equal(t, res.Name, "child2")
+	assert.Equal(t, []string{"arg"}, args)
 
-	res, err = cmd.FindCmd([]string{"child3"})
-	if err == nil {
+	res, args = cmd.FindCmd([]string{"child3"})
+	if res != nil {
 		t.Fatal("should not find this child!")
 	}
+	assert.Equal(t, []string{"child3"}, args)
+
+	// FindCmdStrict returns an error instead of nil
+	res, args, err := cmd.FindCmdStrict([]string{"child2", "arg"})
+	assert.NoError(t, err)
+	assert.Equal(t, "child2", res.Name)
+	assert.Equal(t, []string{"arg"}, args)
+
+	res, args, err = cmd.FindCmdStrict([]string{"child3"})
+	assert.ErrorIs(t, err, ishell.ErrUnknownCommand)
+	assert.Nil(t, res)
+	assert.Equal(t, []string{"child3"}, args)
+}
+
+func TestHelpCategories(t *testing.T) {
+	cmd := newCmd("root", "help for root command")
+	cmd.AddCmd(&ishell.Cmd{Name: "ping", Help: "ping a host", Category: "Networking"})
+	cmd.AddCmd(&ishell.Cmd{Name: "df", Help: "show disk usage", Category: "Storage"})
+	cmd.AddCmd(&ishell.Cmd{Name: "dig", Help: "look up a name", Category: "Networking"})
+	cmd.AddCmd(newCmd("version", "show the version"))
+
+	expected := "\nhelp for root command\n" +
+		"\nCommands:\n  version      show the version\n" +
+		"\nNetworking:\n  dig       look up a name\n  ping      ping a host\n" +
+		"\nStorage:\n  df      show disk usage\n\n"
+	assert.Equal(t, expected, cmd.HelpText())
+}
+
+func TestHelpExamples(t *testing.T) {
+	cmd := newCmd("ping", "ping a host")
+	cmd.Examples = []ishell.Example{
+		{Line: "ping example.com"},
+		{Line: "ping -c 3 example.com", Description: "ping three times"},
+	}
+	expected := "\nping a host\n" +
+		"\nExamples:\n  ping example.com\n  ping -c 3 example.com      ping three times\n\n"
+	assert.Equal(t, expected, cmd.HelpText())
+
+	root := newCmd("", "")
+	root.AddCmd(cmd)
+	assert.Contains(t, root.MarkdownHelp(), "Examples:\n\n```\nping example.com\n# ping three times\nping -c 3 example.com\n```\n")
+}
+
+func TestFindCmdStrict(t *testing.T) {
+	cmd := newCmd("root", "")
+	vm := newCmd("vm", "")
+	vm.AddCmd(newCmd("list", ""))
+	cmd.AddCmd(vm)
+
+	res, rest, err := cmd.FindCmdStrict([]string{"vm", "list", "--all"})
+	assert.NoError(t, err)
+	assert.Equal(t, "list", res.Name)
+	assert.Equal(t, []string{"--all"}, rest)
+
+	_, _, err = cmd.FindCmdStrict([]string{"vm", "lsit"})
+	var notFound *ishell.ErrCmdNotFound
+	if assert.ErrorAs(t, err, &notFound) {
+		assert.Equal(t, "lsit", notFound.Name)
+		assert.Equal(t, []string{"vm"}, notFound.Path)
+	}
+	assert.EqualError(t, err, "Unknown command 'lsit' in 'vm', did you mean 'list'?")
+
+	res, _, err = cmd.FindCmdStrict([]string{"nope"})
+	assert.ErrorIs(t, err, ishell.ErrUnknownCommand)
+	assert.Nil(t, res)
+}
+
+func TestWalk(t *testing.T) {
+	cmd := newCmd("root", "")
+	vm := newCmd("vm", "")
+	vm.AddCmd(newCmd("list", ""))
+	vm.AddCmd(newCmd("delete", ""))
+	net := newCmd("net", "")
+	net.AddCmd(newCmd("ping", ""))
+	cmd.AddCmd(vm)
+	cmd.AddCmd(net)
+
+	var visited []string
+	assert.NoError(t, cmd.Walk(func(path []string, c *ishell.Cmd) error {
+		visited = append(visited, strings.Join(path, " "))
+		if c.Name == "net" {
+			return ishell.SkipCmd
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"", "net", "vm", "vm delete", "vm list"}, visited)
+
+	stop := errors.New("stop")
+	visited = nil
+	assert.Equal(t, stop, cmd.Walk(func(path []string, c *ishell.Cmd) error {
+		visited = append(visited, c.Name)
+		if c.Name == "delete" {
+			return stop
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"root", "net", "ping", "vm", "delete"}, visited)
+}
+
+func TestFindCmdNamespaces(t *testing.T) {
+	cmd := newCmd("root", "")
+	db := newCmd("db", "")
+	migrate := newCmd("migrate", "")
+	up := newCmd("up", "")
+	migrate.AddCmd(up)
+	db.AddCmd(migrate)
+	cmd.AddCmd(db)
+
+	res, _ := cmd.FindCmd([]string{"db.migrate.up"})
+	assert.Nil(t, res)
+
+	cmd.NamespaceSeparator = "."
+	res, rest := cmd.FindCmd([]string{"db.migrate.up", "1.2"})
+	assert.Equal(t, up, res)
+	assert.Equal(t, []string{"1.2"}, rest)
+
+	res, rest = cmd.FindCmd([]string{"db", "migrate.up"})
+	assert.Equal(t, up, res)
+	assert.Nil(t, rest)
+
+	// all parts must name commands
+	res, rest = cmd.FindCmd([]string{"db", "migrate.down"})
+	assert.Equal(t, db, res)
+	assert.Equal(t, []string{"migrate.down"}, rest)
+}
+
+func TestFindCmdSuggestions(t *testing.T) {
+	cmd := newCmd("root", "")
+	vm := newCmd("vm", "")
+	vm.AddCmd(newCmd("list", ""))
+	vm.AddCmd(newCmd("lint", ""))
+	vm.AddCmd(newCmd("start", ""))
+	cmd.AddCmd(vm)
+
+	// closest first, a swap is one edit
+	_, _, err := cmd.FindCmdStrict([]string{"vm", "lsit"})
+	var notFound *ishell.ErrCmdNotFound
+	if assert.ErrorAs(t, err, &notFound) {
+		assert.Equal(t, []string{"list", "lint"}, notFound.Suggestions)
+	}
+	assert.EqualError(t, err, "Unknown command 'lsit' in 'vm', did you mean 'list' or 'lint'?")
+
+	_, _, err = cmd.FindCmdStrict([]string{"VN"})
+	assert.EqualError(t, err, "Unknown command 'VN', did you mean 'vm'?")
+
+	_, _, err = cmd.FindCmdStrict([]string{"vm", "x"})
+	assert.EqualError(t, err, "Unknown command 'x' in 'vm'")
+}
+
+func TestFindCmdIgnoreCase(t *testing.T) {
+	cmd := newCmd("root", "")
+	vm := newCmd("vm", "")
+	list := newCmd("list", "")
+	list.Aliases = []string{"ls"}
+	vm.AddCmd(list)
+	cmd.AddCmd(vm)
+
+	res, _ := cmd.FindCmd([]string{"VM", "list"})
 	assert.Nil(t, res)
+
+	cmd.IgnoreCase = true
+	res, rest := cmd.FindCmd([]string{"VM", "LS", "Arg"})
+	assert.Equal(t, list, res)
+	assert.Equal(t, []string{"Arg"}, rest)
+
+	// exact matches win
+	upper := newCmd("VM", "")
+	cmd.AddCmd(upper)
+	res, _ = cmd.FindCmd([]string{"VM"})
+	assert.Equal(t, upper, res)
 }
 
 func TestFindAlias(t *testing.T) {
@@ -86,6 +265,142 @@ func TestHelpText(t *testing.T) {
 	assert.Equal(t, res, expected)
 }
 
+func TestHelpTextInvalidation(t *testing.T) {
+	cmd := newCmd("root", "help for root command")
+	assert.Equal(t, "\nhelp for root command\n", cmd.HelpText())
+
+	cmd.AddCmd(newCmd("child1", "help for child1 command"))
+	cmd.AddCmd(newCmd("child2", "help for child2 command"))
+	expected := "\nhelp for root command\n\nCommands:\n  child1      help for child1 command\n  child2      help for child2 command\n\n"
+	assert.Equal(t, expected, cmd.HelpText(), "adding a command must refresh help")
+
+	cmd.Help = "new help"
+	cmd.DeleteCmd("child1")
+	cmd.DeleteCmd("child2")
+	assert.Equal(t, "\nnew help\n", cmd.HelpText(), "help must follow edits")
+
+	child := newCmd("child", "old child help")
+	cmd.AddCmd(child)
+	assert.Contains(t, cmd.HelpText(), "old child help")
+	child.Help = "new child help"
+	child.Deprecated = true
+	assert.Contains(t, cmd.HelpText(), "new child help (deprecated)", "help must follow edits of children")
+
+	arg, _ := ishell.NewArg("--force", ishell.BoolType, ishell.WithHelp("old arg help"))
+	cmd.AddCmdArg(arg)
+	assert.Contains(t, cmd.HelpText(), "old arg help")
+	arg.Help = "new arg help"
+	assert.Contains(t, cmd.HelpText(), "new arg help", "help must follow edits of args")
+}
+
+func TestDeleteCmdPath(t *testing.T) {
+	root := newCmd("root", "")
+	net := newCmd("net", "")
+	net.Aliases = []string{"n"}
+	ping := newCmd("ping", "")
+	ping.Aliases = []string{"p"}
+	net.AddCmd(ping)
+	net.AddCmd(newCmd("trace", ""))
+	root.AddCmd(net)
+
+	assert.False(t, root.DeleteCmd(), "empty path")
+	assert.False(t, root.DeleteCmd("net", "nope"), "unknown command")
+	assert.False(t, root.DeleteCmd("nope", "ping"), "unknown parent")
+	assert.True(t, root.DeleteCmd("n", "p"), "path of aliases")
+	assert.Len(t, net.Children(), 1)
+
+	assert.True(t, root.DeleteCmd("net", "trace"))
+	assert.Empty(t, net.Children())
+	assert.True(t, root.DeleteCmd("n"), "top level alias")
+	assert.Empty(t, root.Children())
+	assert.False(t, root.DeleteCmd("net"), "already deleted")
+}
+
+func TestValidate(t *testing.T) {
+	root := newCmd("root", "")
+	list := newCmd("list", "")
+	list.Aliases = []string{"ls", "l"}
+	load := newCmd("load", "")
+	load.Aliases = []string{"l"}
+	root.AddCmd(list)
+	root.AddCmd(load)
+	root.AddCmd(newCmd("ls", ""))
+	assert.NoError(t, newCmd("root", "").Validate())
+
+	err := root.Validate()
+	var conflict *ishell.ErrNameConflict
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "Name 'ls' is used by commands 'list' and 'ls'\nName 'l' is used by commands 'list' and 'load'", err.Error())
+
+	net := newCmd("net", "")
+	net.IgnoreCase = true
+	ping := newCmd("ping", "")
+	ping.Aliases = []string{"p"}
+	net.AddCmd(ping)
+	net.AddCmd(newCmd("P", ""))
+	root = newCmd("root", "")
+	root.AddCmd(net)
+	assert.EqualError(t, root.Validate(), "Name 'P' is used by commands 'P' and 'ping' in 'net'")
+}
+
+func TestAddCmdE(t *testing.T) {
+	root := newCmd("root", "")
+	first := newCmd("status", "first")
+	assert.NoError(t, root.AddCmdE(first))
+	err := root.AddCmdE(newCmd("status", "second"))
+	assert.ErrorIs(t, err, ishell.ErrCmdExists)
+	assert.EqualError(t, err, "Command 'status': command already exists")
+	assert.Same(t, first, root.Children()[0])
+
+	second := newCmd("status", "second")
+	assert.Same(t, first, root.ReplaceCmd(second))
+	assert.Same(t, second, root.Children()[0])
+	assert.Nil(t, root.ReplaceCmd(newCmd("other", "")))
+}
+
+func TestCmdPath(t *testing.T) {
+	root := newCmd("", "")
+	net := newCmd("net", "")
+	ping := newCmd("ping", "")
+	dig := newCmd("dig", "")
+	net.AddCmd(ping)
+	root.AddCmd(net)
+	root.AddCmdProvider(func() []*ishell.Cmd {
+		return []*ishell.Cmd{ping, dig}
+	})
+
+	assert.Nil(t, root.Parent())
+	assert.Empty(t, root.Path())
+	assert.Same(t, net, ping.Parent())
+	assert.Equal(t, []string{"net", "ping"}, ping.Path())
+
+	// listing a provider's commands sets the parent of those without one
+	root.Children()
+	assert.Same(t, root, dig.Parent())
+	assert.Same(t, net, ping.Parent())
+	assert.Equal(t, []string{"net", "ping"}, ping.Path())
+
+	// replacing a subcommand clears its parent
+	net.AddCmd(newCmd("ping", ""))
+	assert.Nil(t, ping.Parent())
+	net.ReplaceCmd(ping)
+	assert.Same(t, net, ping.Parent())
+
+	assert.True(t, root.DeleteCmd("net"))
+	assert.Nil(t, net.Parent())
+	assert.Equal(t, []string{"ping"}, ping.Path(), "net is a root now")
+}
+
+func TestMarkdownHelp(t *testing.T) {
+	cmd := newCmd("", "")
+	child := newCmd("net", "network commands")
+	child.AddCmd(newCmd("ping", "ping a host"))
+	cmd.AddCmd(child)
+	cmd.AddCmd(newCmd("exit", "exit the program"))
+	expected := "# exit\n\nexit the program\n\n# net\n\nnetwork commands\n\n## net ping\n\nping a host\n\n"
+	assert.Equal(t, expected, cmd.MarkdownHelp())
+}
+
 func TestChildrenSortedAlphabetically(t *testing.T) {
 	cmd := newCmd("root", "help for root command")
 	cmd.AddCmd(newCmd("child2", "help for child1 command"))
@@ -95,6 +410,45 @@ func TestChildrenSortedAlphabetically(t *testing.T) {
 	assert.Equal(t, children[1].Name, "child2", "must be second")
 }
 
+func TestChildrenOrder(t *testing.T) {
+	names := func(cmds []*ishell.Cmd) []string {
+		var names []string
+		for _, cmd := range cmds {
+			names = append(names, cmd.Name)
+		}
+		return names
+	}
+	cmd := newCmd("root", "")
+	for i, name := range []string{"status", "init", "deploy", "configure"} {
+		child := newCmd(name, "")
+		child.Weight = []int{3, 0, 2, 1}[i]
+		cmd.AddCmd(child)
+	}
+	assert.Equal(t, []string{"init", "configure", "deploy", "status"}, names(cmd.Children()))
+	assert.Regexp(t, `(?s)init.*configure.*deploy.*status`, cmd.HelpText())
+
+	cmd = newCmd("root", "")
+	cmd.OrderChildren = ishell.OrderAdded
+	for _, name := range []string{"status", "init", "deploy"} {
+		cmd.AddCmd(newCmd(name, ""))
+	}
+	assert.Equal(t, []string{"status", "init", "deploy"}, names(cmd.Children()))
+
+	cmd.OrderChildren = func(a, b *ishell.Cmd) bool { return len(a.Name) < len(b.Name) }
+	assert.Equal(t, []string{"init", "deploy", "status"}, names(cmd.Children()))
+	assert.Regexp(t, `(?s)init.*deploy.*status`, cmd.HelpText())
+
+	// help follows changes of the order after it was shown
+	cmd = newCmd("root", "")
+	a, b := newCmd("aaa", ""), newCmd("bbb", "")
+	cmd.AddCmd(a)
+	cmd.AddCmd(b)
+	assert.Regexp(t, `(?s)aaa.*bbb`, cmd.HelpText())
+	b.Weight = -1
+	assert.Equal(t, []string{"bbb", "aaa"}, names(cmd.Children()))
+	assert.Regexp(t, `(?s)bbb.*aaa`, cmd.HelpText())
+}
+
 // test creation of new cmd args
 func TestCmdArgs(t *testing.T) {
 	_, err := ishell.NewCmdArg("-x", "--test-1", ishell.IntType, false, true)
@@ -112,7 +466,7 @@ func TestCmdArgs(t *testing.T) {
 	assert.Error(t, err, "Longflag illegal char, test must err")
 
 	// test typ param
-	_, err = ishell.NewCmdArg("-x", "--test_3", 3, false, false)
+	_, err = ishell.NewCmdArg("-x", "--test_3", -1, false, false)
 	assert.Error(t, err, "Illegal typ value, test must err")
 
 	// test positional
@@ -192,6 +546,864 @@ func TestCmdArgsParsing(t *testing.T) {
 	assert.Error(t, err, "Process should error due to a missing required arg")
 }
 
+func TestLongFlagParsing(t *testing.T) {
+	arg1, _ := ishell.NewCmdArg("-x", "--test1", ishell.IntType, false, true)
+	arg2, _ := ishell.NewCmdArg("", "test2", ishell.StringType, false, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg1)
+	cmd.AddCmdArg(arg2)
+
+	parsed, err := cmd.ParseArgs([]string{"--test1", "5", "test2"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(parsed))
+		assert.Equal(t, "--test1", parsed[0].Key)
+		assert.Equal(t, "5", parsed[0].Value)
+		assert.Equal(t, "test2", parsed[1].Key)
+		assert.Equal(t, "test2", parsed[1].Value, "positional keys must not match as flags")
+	}
+}
+
+func TestFloatParsing(t *testing.T) {
+	arg, _ := ishell.NewCmdArg("-t", "--threshold", ishell.FloatType, false, true)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg)
+
+	parsed, err := cmd.ParseArgs([]string{"-t", "0.75"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0.75", parsed[0].Value)
+		assert.Equal(t, 0.75, parsed[0].Float())
+	}
+	_, err = cmd.ParseArgs([]string{"-t", "high"})
+	assert.Error(t, err, "must reject invalid floats")
+}
+
+func TestDurationParsing(t *testing.T) {
+	arg, _ := ishell.NewCmdArg("-t", "--timeout", ishell.DurationType, false, true)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg)
+
+	parsed, err := cmd.ParseArgs([]string{"--timeout", "5m"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5*time.Minute, parsed[0].Duration())
+	}
+	_, err = cmd.ParseArgs([]string{"-t", "5"})
+	assert.Error(t, err, "durations need a unit")
+}
+
+func TestFilePathParsing(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0600)
+
+	arg, _ := ishell.NewCmdArg("", "path", ishell.FilePathType, false, true)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg)
+	_, err := cmd.ParseArgs([]string{filepath.Join(dir, "missing")})
+	assert.NoError(t, err, "paths are not checked by default")
+
+	arg.PathCheck = ishell.PathIsFile | ishell.PathReadable | ishell.PathWritable
+	parsed, err := cmd.ParseArgs([]string{file})
+	if assert.NoError(t, err) {
+		assert.Equal(t, file, parsed[0].Parsed)
+	}
+	_, err = cmd.ParseArgs([]string{filepath.Join(dir, "missing")})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "file does not exist")
+	}
+	_, err = cmd.ParseArgs([]string{dir})
+	assert.Error(t, err, "a directory is not a file")
+
+	arg.PathCheck = ishell.PathIsDir | ishell.PathWritable
+	_, err = cmd.ParseArgs([]string{dir})
+	assert.NoError(t, err)
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1, "checks must not create files")
+
+	readOnly := filepath.Join(dir, "read-only")
+	os.WriteFile(readOnly, nil, 0400)
+	arg.PathCheck = ishell.PathWritable
+	_, err = cmd.ParseArgs([]string{readOnly})
+	if os.Geteuid() != 0 {
+		assert.Error(t, err, "read-only files are not writable")
+	}
+}
+
+func TestChoices(t *testing.T) {
+	arg, _ := ishell.NewCmdArg("-f", "--format", ishell.StringType, false, false)
+	arg.Choices = []string{"json", "yaml", "table"}
+	cmd := ishell.Cmd{Name: "root", Help: "root help"}
+	cmd.AddCmdArg(arg)
+
+	_, err := cmd.ParseArgs([]string{"-f", "yaml"})
+	assert.NoError(t, err)
+	_, err = cmd.ParseArgs([]string{"-f", "xml"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "json, yaml, table")
+	}
+	assert.Contains(t, cmd.HelpText(), "-f, --format")
+	assert.Contains(t, cmd.HelpText(), "one of json, yaml, table")
+}
+
+func TestValidator(t *testing.T) {
+	arg, _ := ishell.NewCmdArg("-p", "--port", ishell.IntType, false, false)
+	arg.Validator = func(value string) error {
+		if port, _ := strconv.Atoi(value); port < 1 || port > 65535 {
+			return fmt.Errorf("port %s out of range", value)
+		}
+		return nil
+	}
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg)
+
+	_, err := cmd.ParseArgs([]string{"-p", "8080"})
+	assert.NoError(t, err)
+	_, err = cmd.ParseArgs([]string{"-p", "70000"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "out of range")
+	}
+	_, err = cmd.ParseArgs([]string{"-p", "http"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not a valid integer", "type is validated first")
+	}
+}
+
+func TestEndOfFlags(t *testing.T) {
+	arg1, _ := ishell.NewCmdArg("-v", "--verbose", ishell.BoolType, false, false)
+	arg2, _ := ishell.NewCmdArg("", "args", ishell.StringType, true, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg1)
+	cmd.AddCmdArg(arg2)
+
+	parsed, err := cmd.ParseArgs([]string{"-v", "--", "-v", "-la", "--"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, len(parsed))
+		assert.Equal(t, "--verbose", parsed[0].Key)
+		for i, value := range []string{"-v", "-la", "--"} {
+			assert.Equal(t, "args", parsed[i+1].Key)
+			assert.Equal(t, value, parsed[i+1].Value)
+		}
+	}
+
+	// "--" as the value of a flag doesn't end the flags.
+	arg3, _ := ishell.NewCmdArg("-l", "--long", ishell.BoolType, false, false)
+	arg4, _ := ishell.NewCmdArg("-s", "--sep", ishell.StringType, false, false)
+	cmd.AddCmdArg(arg3)
+	cmd.AddCmdArg(arg4)
+	parsed, err = cmd.ParseArgs([]string{"-s", "--", "-vl", "x"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "--", parsed.GetString("--sep"))
+		assert.True(t, parsed.GetBool("--verbose"))
+		assert.True(t, parsed.GetBool("--long"))
+		assert.Equal(t, []string{"x"}, parsed.Values("args"))
+	}
+}
+
+func TestNegativeNumbers(t *testing.T) {
+	arg1, _ := ishell.NewCmdArg("-o", "--offset", ishell.IntType, false, false)
+	arg2, _ := ishell.NewCmdArg("-5", "--five", ishell.BoolType, false, false)
+	arg3, _ := ishell.NewCmdArg("", "delta", ishell.FloatType, false, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg1)
+	cmd.AddCmdArg(arg2)
+	cmd.AddCmdArg(arg3)
+
+	parsed, err := cmd.ParseArgs([]string{"-o", "-5", "-3.2"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(parsed))
+		assert.Equal(t, "-5", parsed[0].Value)
+		assert.Equal(t, -3.2, parsed[1].Float())
+	}
+
+	parsed, err = cmd.ParseArgs([]string{"-o", "-12", "-5"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "-12", parsed[0].Value)
+		assert.Equal(t, -5.0, parsed[1].Float(), "numeric positionals take negative numbers")
+	}
+
+	// digits group only when they are all declared short flags.
+	one, _ := ishell.NewCmdArg("-1", "--one", ishell.BoolType, false, false)
+	two, _ := ishell.NewCmdArg("-2", "--two", ishell.BoolType, false, false)
+	offset, _ := ishell.NewCmdArg("-o", "--offset", ishell.IntType, false, false)
+	cmd = ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(one)
+	cmd.AddCmdArg(two)
+	cmd.AddCmdArg(offset)
+	parsed, err = cmd.ParseArgs([]string{"-12"})
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.GetBool("--one"))
+		assert.True(t, parsed.GetBool("--two"))
+	}
+	parsed, err = cmd.ParseArgs([]string{"-o", "-12"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, -12, parsed.GetInt("--offset"))
+	}
+	parsed, err = cmd.ParseArgs([]string{"-o", "-13"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, -13, parsed.GetInt("--offset"))
+	}
+}
+
+func TestParsedArgsAccessors(t *testing.T) {
+	arg1, _ := ishell.NewCmdArg("-n", "--count", ishell.IntType, false, false)
+	arg2, _ := ishell.NewCmdArg("-v", "--verbose", ishell.BoolType, false, false)
+	arg3, _ := ishell.NewCmdArg("", "names", ishell.StringType, true, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg1)
+	cmd.AddCmdArg(arg2)
+	cmd.AddCmdArg(arg3)
+
+	parsed, err := cmd.ParseArgs([]string{"a", "-n", "3", "b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, parsed.GetInt("--count"))
+		assert.False(t, parsed.GetBool("--verbose"))
+		assert.False(t, parsed.Has("--verbose"))
+		assert.True(t, parsed.Has("names"))
+		assert.Equal(t, "a", parsed.GetString("names"))
+		assert.Equal(t, 2, len(parsed.GetAll("names")))
+	}
+}
+
+func TestParsedArgsUnmarshal(t *testing.T) {
+	arg1, _ := ishell.NewCmdArg("-n", "--count", ishell.IntType, false, false)
+	arg2, _ := ishell.NewCmdArg("-v", "--verbose", ishell.BoolType, false, false)
+	arg3, _ := ishell.NewCmdArg("-t", "--timeout", ishell.DurationType, false, false)
+	arg4, _ := ishell.NewCmdArg("", "names", ishell.StringType, true, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg1)
+	cmd.AddCmdArg(arg2)
+	cmd.AddCmdArg(arg3)
+	cmd.AddCmdArg(arg4)
+
+	var opts struct {
+		Count   int64         `ishell:"--count"`
+		Verbose bool          `ishell:"--verbose"`
+		Timeout time.Duration `ishell:"--timeout"`
+		Names   []string      `ishell:"names"`
+		Other   string
+	}
+	opts.Other = "kept"
+	parsed, err := cmd.ParseArgs([]string{"a", "-vn", "3", "b", "-t", "2s"})
+	if assert.NoError(t, err) && assert.NoError(t, parsed.Unmarshal(&opts)) {
+		assert.Equal(t, int64(3), opts.Count)
+		assert.True(t, opts.Verbose)
+		assert.Equal(t, 2*time.Second, opts.Timeout)
+		assert.Equal(t, []string{"a", "b"}, opts.Names)
+		assert.Equal(t, "kept", opts.Other)
+	}
+	assert.Error(t, parsed.Unmarshal(opts), "must require a pointer")
+}
+
+func TestRequiresImplies(t *testing.T) {
+	user, _ := ishell.NewCmdArg("-u", "--user", ishell.StringType, false, false)
+	password, _ := ishell.NewCmdArg("-p", "--password", ishell.StringType, false, false)
+	password.Requires = []string{"--user"}
+	debug, _ := ishell.NewCmdArg("-d", "--debug", ishell.BoolType, false, false)
+	debug.Implies = []string{"--verbose"}
+	verbose, _ := ishell.NewCmdArg("-v", "--verbose", ishell.BoolType, false, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(user)
+	cmd.AddCmdArg(password)
+	cmd.AddCmdArg(debug)
+	cmd.AddCmdArg(verbose)
+
+	_, err := cmd.ParseArgs([]string{"-p", "secret"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "Argument '--password' requires '--user'", err.Error())
+	}
+	_, err = cmd.ParseArgs([]string{"-p", "secret", "-u", "admin"})
+	assert.NoError(t, err)
+
+	parsed, err := cmd.ParseArgs([]string{"-d"})
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.GetBool("--verbose"))
+	}
+	parsed, err = cmd.ParseArgs([]string{"-dv"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(parsed), "given arguments are not implied again")
+	}
+}
+
+func TestCountFlags(t *testing.T) {
+	verbose, _ := ishell.NewCmdArg("-v", "--verbose", ishell.CountType, false, false)
+	quiet, _ := ishell.NewCmdArg("-q", "--quiet", ishell.BoolType, false, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(verbose)
+	cmd.AddCmdArg(quiet)
+
+	parsed, err := cmd.ParseArgs([]string{"-vvq", "--verbose"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(parsed))
+		assert.Equal(t, 3, parsed[0].Count())
+		assert.Equal(t, 3, parsed.GetInt("--verbose"))
+	}
+	_, err = ishell.NewCmdArg("", "level", ishell.CountType, false, false)
+	assert.Error(t, err, "counters cannot be positional")
+}
+
+func TestParsedArgsValues(t *testing.T) {
+	tag, _ := ishell.NewCmdArg("-t", "--tag", ishell.StringType, true, false)
+	port, _ := ishell.NewCmdArg("-p", "--port", ishell.IntType, true, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(tag)
+	cmd.AddCmdArg(port)
+
+	parsed, err := cmd.ParseArgs([]string{"--tag", "a", "-p", "80", "--tag", "b", "-p", "443"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a", "b"}, parsed.Values("--tag"))
+		assert.Equal(t, []int{80, 443}, parsed.IntValues("--port"))
+		assert.Nil(t, parsed.Values("--other"))
+	}
+}
+
+func TestArgHelp(t *testing.T) {
+	format, _ := ishell.NewCmdArg("-f", "--format", ishell.StringType, false, true)
+	format.Help = "output format"
+	path, _ := ishell.NewCmdArg("", "path", ishell.FilePathType, false, false)
+	cmd := ishell.Cmd{Name: "root", Help: "root help"}
+	cmd.AddCmdArg(format)
+	cmd.AddCmdArg(path)
+
+	expected := "\nUsage: root -f|--format <string> [<path>]\n\nroot help\n\nArguments:\n" +
+		"  -f, --format  string      output format (required)\n" +
+		"  <path>        path        \n\n"
+	assert.Equal(t, expected, cmd.HelpText())
+}
+
+func TestUsage(t *testing.T) {
+	force, _ := ishell.NewCmdArg("-f", "--force", ishell.BoolType, false, false)
+	env, _ := ishell.NewCmdArg("", "--env", ishell.StringType, false, true)
+	target, _ := ishell.NewCmdArg("", "target", ishell.StringType, true, true)
+	cmd := ishell.Cmd{Name: "deploy"}
+	assert.Equal(t, "deploy", cmd.Usage())
+	cmd.AddCmdArg(force)
+	cmd.AddCmdArg(env)
+	cmd.AddCmdArg(target)
+	assert.Equal(t, "deploy [-f|--force] --env <string> <target>...", cmd.Usage())
+}
+
+func TestNewArg(t *testing.T) {
+	env, err := ishell.NewArg("--env", ishell.StringType,
+		ishell.WithShort("-e"), ishell.Required(), ishell.WithHelp("target environment"),
+		ishell.WithChoices("dev", "prod"), ishell.WithDefault("dev"))
+	assert.NoError(t, err)
+	target, err := ishell.NewArg("target", ishell.StringType, ishell.Multiple())
+	assert.NoError(t, err)
+	cmd := ishell.Cmd{Name: "deploy"}
+	cmd.AddCmdArg(env)
+	cmd.AddCmdArg(target)
+	assert.Equal(t, "deploy -e|--env <string> [<target>]...", cmd.Usage())
+
+	parsed, err := cmd.ParseArgs([]string{"a", "b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a", "b"}, parsed.Values("target"))
+		assert.Equal(t, "dev", parsed.GetString("--env"), "default must satisfy required")
+	}
+	parsed, err = cmd.ParseArgs(nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "dev", parsed.GetString("--env"))
+	}
+
+	_, err = ishell.NewArg("--port", ishell.IntType, ishell.WithDefault("http"))
+	assert.Error(t, err, "default must be valid")
+	_, err = ishell.NewArg("--port", ishell.IntType, ishell.WithShort("port"))
+	assert.Error(t, err, "short flag must be valid")
+}
+
+// hexType is registered once, as a type name cannot be registered again.
+var hexType, hexTypeErr = ishell.RegisterArgType("hex", func(value string) (interface{}, error) {
+	return strconv.ParseUint(value, 16, 64)
+})
+
+func TestRegisterArgType(t *testing.T) {
+	assert.NoError(t, hexTypeErr)
+	assert.Equal(t, "hex", hexType.String())
+	_, err := ishell.RegisterArgType("hex", nil)
+	assert.Error(t, err, "registered names cannot be reused")
+	_, err = ishell.RegisterArgType("int", nil)
+	assert.Error(t, err, "built-in names cannot be reused")
+	arg, err := ishell.NewCmdArg("-a", "--address", hexType, false, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(arg)
+
+	parsed, err := cmd.ParseArgs([]string{"-a", "ff"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(255), parsed[0].Parsed)
+	}
+	_, err = cmd.ParseArgs([]string{"-a", "zz"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not a valid hex")
+	}
+	_, err = ishell.NewCmdArg("-b", "--other", -1, false, false)
+	assert.Error(t, err, "unregistered types are invalid")
+}
+
+func TestParseArgsMap(t *testing.T) {
+	tag, _ := ishell.NewCmdArg("-t", "--tag", ishell.StringType, true, false)
+	name, _ := ishell.NewCmdArg("", "name", ishell.StringType, false, true)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(tag)
+	cmd.AddCmdArg(name)
+
+	parsed, err := cmd.ParseArgsMap([]string{"-t", "a", "x", "-t", "b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(parsed))
+		assert.Equal(t, "x", parsed["name"][0].Value)
+		assert.Equal(t, 2, len(parsed["--tag"]))
+	}
+	_, err = cmd.ParseArgsMap([]string{"-t"})
+	assert.Error(t, err)
+}
+
+func TestAttachedShortFlagValues(t *testing.T) {
+	verbose, _ := ishell.NewCmdArg("-v", "--verbose", ishell.BoolType, false, false)
+	count, _ := ishell.NewCmdArg("-n", "--count", ishell.IntType, false, false)
+	output, _ := ishell.NewCmdArg("-o", "--output", ishell.StringType, false, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(verbose)
+	cmd.AddCmdArg(count)
+	cmd.AddCmdArg(output)
+
+	parsed, err := cmd.ParseArgs([]string{"-n5", "-vofile.txt"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, parsed.GetInt("--count"))
+		assert.True(t, parsed.GetBool("--verbose"))
+		assert.Equal(t, "file.txt", parsed.GetString("--output"))
+	}
+	parsed, err = cmd.ParseArgs([]string{"-n-5"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, -5, parsed.GetInt("--count"))
+	}
+}
+
+func TestAbbreviatedLongFlags(t *testing.T) {
+	verbose, _ := ishell.NewCmdArg("", "--verbose", ishell.BoolType, false, false)
+	version, _ := ishell.NewCmdArg("", "--version", ishell.BoolType, false, false)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(verbose)
+	cmd.AddCmdArg(version)
+
+	parsed, err := cmd.ParseArgs([]string{"--verb"})
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.GetBool("--verbose"))
+	}
+	_, err = cmd.ParseArgs([]string{"--ver"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "Ambiguous flag --ver, could be --verbose, --version", err.Error())
+	}
+	_, err = cmd.ParseArgs([]string{"--debug"})
+	assert.Error(t, err)
+
+	// hidden and deprecated flags are not abbreviated.
+	verbatim, _ := ishell.NewCmdArg("", "--verbatim", ishell.BoolType, false, false)
+	verbatim.Hidden = true
+	vertical, _ := ishell.NewCmdArg("", "--vertical", ishell.BoolType, false, false)
+	vertical.Deprecated = true
+	cmd.AddCmdArg(verbatim)
+	cmd.AddCmdArg(vertical)
+	parsed, err = cmd.ParseArgs([]string{"--verb"})
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.GetBool("--verbose"))
+	}
+	_, err = cmd.ParseArgs([]string{"--vert"})
+	assert.Error(t, err)
+	parsed, err = cmd.ParseArgs([]string{"--verbatim", "--vertical"})
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.GetBool("--verbatim"))
+		assert.True(t, parsed.GetBool("--vertical"))
+	}
+}
+
+func TestRestArgs(t *testing.T) {
+	verbose, _ := ishell.NewArg("--verbose", ishell.BoolType, ishell.WithShort("-v"))
+	program, _ := ishell.NewArg("program", ishell.StringType, ishell.Required())
+	args, _ := ishell.NewArg("args", ishell.StringType, ishell.Rest())
+	cmd := ishell.Cmd{Name: "run"}
+	cmd.AddCmdArg(verbose)
+	cmd.AddCmdArg(program)
+	cmd.AddCmdArg(args)
+	assert.Equal(t, "run [-v|--verbose] <program> [<args>]...", cmd.Usage())
+
+	parsed, err := cmd.ParseArgs([]string{"-v", "ls", "-la", "--color", "-v", "--", "dir"})
+	if assert.NoError(t, err) {
+		assert.True(t, parsed.GetBool("--verbose"))
+		assert.Equal(t, "ls", parsed.GetString("program"))
+		assert.Equal(t, []string{"-la", "--color", "-v", "--", "dir"}, parsed.Values("args"))
+	}
+	parsed, err = cmd.ParseArgs([]string{"ls"})
+	if assert.NoError(t, err) {
+		assert.False(t, parsed.Has("args"))
+	}
+}
+
+func TestOptionalPositionals(t *testing.T) {
+	name, _ := ishell.NewArg("name", ishell.StringType, ishell.Required())
+	revision, _ := ishell.NewArg("revision", ishell.StringType, ishell.WithDefault("HEAD"))
+	cmd := ishell.Cmd{Name: "show"}
+	assert.NoError(t, cmd.AddCmdArg(name))
+	assert.NoError(t, cmd.AddCmdArg(revision))
+	assert.Equal(t, "show <name> [<revision>]", cmd.Usage())
+
+	parsed, err := cmd.ParseArgs([]string{"main.go"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "HEAD", parsed.GetString("revision"))
+	}
+	parsed, err = cmd.ParseArgs([]string{"main.go", "v1"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "v1", parsed.GetString("revision"))
+	}
+
+	path, _ := ishell.NewArg("path", ishell.StringType, ishell.Required())
+	assert.Error(t, cmd.AddCmdArg(path), "required after optional")
+	rest, _ := ishell.NewArg("rest", ishell.StringType, ishell.Rest())
+	assert.NoError(t, cmd.AddCmdArg(rest))
+	extra, _ := ishell.NewArg("extra", ishell.StringType)
+	assert.Error(t, cmd.AddCmdArg(extra), "nothing can follow a rest argument")
+}
+
+func TestParseErrors(t *testing.T) {
+	count, _ := ishell.NewArg("--count", ishell.IntType, ishell.WithShort("-n"), ishell.Required())
+	name, _ := ishell.NewArg("--name", ishell.StringType)
+	cmd := ishell.Cmd{Name: "root"}
+	cmd.AddCmdArg(count)
+	cmd.AddCmdArg(name)
+
+	for _, test := range []struct {
+		args []string
+		err  error
+	}{
+		{[]string{"-n", "x"}, ishell.ErrInvalidInt},
+		{[]string{"-n", "1", "extra"}, ishell.ErrUnknownFlag},
+		{[]string{"-n", "1", "--name"}, ishell.ErrMissingValue},
+		{[]string{"-n", "1", "-n", "2"}, ishell.ErrTooManyValues},
+	} {
+		_, err := cmd.ParseArgs(test.args)
+		assert.True(t, errors.Is(err, test.err), "%v: %v", test.args, err)
+		assert.True(t, ishell.IsParseError(err))
+	}
+
+	_, err := cmd.ParseArgs([]string{"--name", "x"})
+	var missing *ishell.ErrMissingRequired
+	if assert.True(t, errors.As(err, &missing)) {
+		assert.Equal(t, "--count", missing.Arg)
+		assert.Equal(t, "--count is a required argument", err.Error())
+	}
+
+	// a command run without arguments is still checked
+	called := false
+	cmd.Func = func(c *ishell.Context) { called = true }
+	shell, _ := newTestShell()
+	shell.AddCmd(&cmd)
+	err = shell.Process("root")
+	if assert.True(t, errors.As(err, &missing)) {
+		assert.Equal(t, "--count", missing.Arg)
+	}
+	assert.False(t, called)
+}
+
+func TestSliceArgs(t *testing.T) {
+	ports, _ := ishell.NewArg("--ports", ishell.IntSliceType, ishell.Multiple())
+	tags, _ := ishell.NewArg("--tags", ishell.StringSliceType, ishell.WithDelimiter(":"), ishell.WithChoices("a", "b", "c"))
+	cmd := ishell.Cmd{Name: "scan"}
+	cmd.AddCmdArg(ports)
+	cmd.AddCmdArg(tags)
+
+	parsed, err := cmd.ParseArgs([]string{"--ports", "80, 443", "--ports", "8080", "--tags", "a:c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{80, 443, 8080}, parsed.GetIntSlice("--ports"))
+	assert.Equal(t, []string{"a", "c"}, parsed.GetStringSlice("--tags"))
+
+	var opts struct {
+		Ports []int    `ishell:"--ports"`
+		Tags  []string `ishell:"--tags"`
+	}
+	assert.NoError(t, parsed.Unmarshal(&opts))
+	assert.Equal(t, []int{80, 443, 8080}, opts.Ports)
+	assert.Equal(t, []string{"a", "c"}, opts.Tags)
+
+	_, err = cmd.ParseArgs([]string{"--ports", "80,http"})
+	assert.ErrorIs(t, err, ishell.ErrInvalidInt)
+	_, err = cmd.ParseArgs([]string{"--tags", "a:d"})
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+}
+
+func TestArgRange(t *testing.T) {
+	port, _ := ishell.NewArg("--port", ishell.IntType, ishell.WithRange(1, 65535))
+	ratio, _ := ishell.NewArg("--ratio", ishell.FloatType, ishell.WithMax(1))
+	cmd := ishell.Cmd{Name: "serve"}
+	cmd.AddCmdArg(port)
+	cmd.AddCmdArg(ratio)
+
+	parsed, err := cmd.ParseArgs([]string{"--port", "8080", "--ratio", "0.5"})
+	assert.NoError(t, err)
+	assert.Equal(t, 8080, parsed.GetInt("--port"))
+
+	_, err = cmd.ParseArgs([]string{"--port", "0"})
+	assert.EqualError(t, err, "--port must be between 1 and 65535")
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+	_, err = cmd.ParseArgs([]string{"--ratio", "1.5"})
+	assert.EqualError(t, err, "--ratio must be at most 1")
+	assert.Contains(t, cmd.HelpText(), "(between 1 and 65535)")
+
+	_, err = ishell.NewArg("--port", ishell.IntType, ishell.WithRange(1, 10), ishell.WithDefault("20"))
+	assert.Error(t, err)
+}
+
+func TestArgPattern(t *testing.T) {
+	sha, _ := ishell.NewArg("sha", ishell.StringType, ishell.WithPattern(regexp.MustCompile(`^[0-9a-f]{7,40}$`)))
+	cmd := ishell.Cmd{Name: "show"}
+	cmd.AddCmdArg(sha)
+
+	parsed, err := cmd.ParseArgs([]string{"9a7123e"})
+	assert.NoError(t, err)
+	assert.Equal(t, "9a7123e", parsed.GetString("sha"))
+
+	_, err = cmd.ParseArgs([]string{"HEAD"})
+	assert.EqualError(t, err, "Argument 'sha' must match ^[0-9a-f]{7,40}$")
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+	assert.Contains(t, cmd.HelpText(), "(matches ^[0-9a-f]{7,40}$)")
+}
+
+func TestURLAndIPArgs(t *testing.T) {
+	endpoint, _ := ishell.NewArg("--endpoint", ishell.URLType)
+	addr, _ := ishell.NewArg("addr", ishell.IPType)
+	cmd := ishell.Cmd{Name: "connect"}
+	cmd.AddCmdArg(endpoint)
+	cmd.AddCmdArg(addr)
+
+	parsed, err := cmd.ParseArgs([]string{"--endpoint", "HTTPS://example.com/api", "2001:DB8::0:1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/api", parsed.GetURL("--endpoint").String())
+	assert.Equal(t, "2001:db8::1", parsed.GetIP("addr").String())
+
+	_, err = cmd.ParseArgs([]string{"--endpoint", "example.com"})
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+	_, err = cmd.ParseArgs([]string{"10.0.0.256"})
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+}
+
+func TestExplicitBoolArgs(t *testing.T) {
+	color, _ := ishell.NewArg("--color", ishell.BoolType, ishell.WithDefault("true"), ishell.WithShort("-c"))
+	cache, _ := ishell.NewArg("--cache", ishell.BoolType)
+	cmd := ishell.Cmd{Name: "build"}
+	cmd.AddCmdArg(color)
+	cmd.AddCmdArg(cache)
+
+	parsed, err := cmd.ParseArgs([]string{"--cache"})
+	assert.NoError(t, err)
+	assert.True(t, parsed.GetBool("--color"))
+
+	parsed, err = cmd.ParseArgs([]string{"--no-color", "--cache=false"})
+	assert.NoError(t, err)
+	assert.True(t, parsed.Has("--color"))
+	assert.False(t, parsed.GetBool("--color"))
+	assert.False(t, parsed.GetBool("--cache"))
+
+	parsed, err = cmd.ParseArgs([]string{"--col=false", "--cache=true"})
+	assert.NoError(t, err)
+	assert.False(t, parsed.GetBool("--color"))
+	assert.True(t, parsed.GetBool("--cache"))
+
+	_, err = cmd.ParseArgs([]string{"--cache=maybe"})
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+	_, err = cmd.ParseArgs([]string{"--no-cach"})
+	assert.ErrorIs(t, err, ishell.ErrUnknownFlag)
+}
+
+func TestTimeArgs(t *testing.T) {
+	since, _ := ishell.NewArg("--since", ishell.TimeType)
+	at, _ := ishell.NewArg("--at", ishell.TimeType, ishell.WithLayouts("15:04"))
+	cmd := ishell.Cmd{Name: "log"}
+	cmd.AddCmdArg(since)
+	cmd.AddCmdArg(at)
+
+	parsed, err := cmd.ParseArgs([]string{"--since", "2024-03-01", "--at", "09:30"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), parsed.GetTime("--since"))
+	assert.Equal(t, 9, parsed.GetTime("--at").Hour())
+
+	parsed, err = cmd.ParseArgs([]string{"--since", "2024-03-01T12:00:00Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, 12, parsed.GetTime("--since").Hour())
+
+	_, err = cmd.ParseArgs([]string{"--at", "2024-03-01"})
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+}
+
+func TestIgnoreFlagCase(t *testing.T) {
+	force, _ := ishell.NewArg("--force", ishell.BoolType)
+	name, _ := ishell.NewArg("--name", ishell.StringType)
+	cmd := ishell.Cmd{Name: "delete"}
+	cmd.AddCmdArg(force)
+	cmd.AddCmdArg(name)
+
+	_, err := cmd.ParseArgs([]string{"--Force"})
+	assert.ErrorIs(t, err, ishell.ErrUnknownFlag)
+
+	cmd.IgnoreFlagCase = true
+	parsed, err := cmd.ParseArgs([]string{"--FORCE", "--NA", "x"})
+	assert.NoError(t, err)
+	assert.True(t, parsed.GetBool("--force"))
+	assert.Equal(t, "x", parsed.GetString("--name"))
+}
+
+func TestParseArgsLenient(t *testing.T) {
+	verbose, _ := ishell.NewArg("--verbose", ishell.BoolType, ishell.WithShort("-v"))
+	image, _ := ishell.NewArg("image", ishell.StringType)
+	cmd := ishell.Cmd{Name: "run"}
+	cmd.AddCmdArg(verbose)
+	cmd.AddCmdArg(image)
+
+	parsed, unknown, err := cmd.ParseArgsLenient([]string{"-v", "--rm", "alpine", "-it", "--", "sh"})
+	assert.NoError(t, err)
+	assert.True(t, parsed.GetBool("--verbose"))
+	assert.Equal(t, "alpine", parsed.GetString("image"))
+	assert.Equal(t, []string{"--rm", "-it", "sh"}, unknown)
+
+	_, err = cmd.ParseArgs([]string{"--rm", "alpine"})
+	assert.ErrorIs(t, err, ishell.ErrUnknownFlag)
+}
+
+func TestStopAtPositional(t *testing.T) {
+	verbose, _ := ishell.NewArg("--verbose", ishell.BoolType, ishell.WithShort("-v"))
+	binary, _ := ishell.NewArg("binary", ishell.StringType, ishell.Required())
+	binaryArgs, _ := ishell.NewArg("args", ishell.StringType, ishell.Multiple())
+	cmd := ishell.Cmd{Name: "run", StopAtPositional: true}
+	cmd.AddCmdArg(verbose)
+	cmd.AddCmdArg(binary)
+	cmd.AddCmdArg(binaryArgs)
+
+	parsed, err := cmd.ParseArgs([]string{"-v", "ls", "-la", "--verbose", "/tmp"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(parsed.GetAll("--verbose")))
+	assert.Equal(t, "ls", parsed.GetString("binary"))
+	assert.Equal(t, []string{"-la", "--verbose", "/tmp"}, parsed.Values("args"))
+}
+
+func TestLongFlagAliases(t *testing.T) {
+	color, _ := ishell.NewArg("--color", ishell.StringType, ishell.WithAliases("--colour"))
+	cmd := ishell.Cmd{Name: "paint"}
+	assert.NoError(t, cmd.AddCmdArg(color))
+
+	parsed, err := cmd.ParseArgs([]string{"--colour", "red"})
+	assert.NoError(t, err)
+	assert.Equal(t, "--color", parsed[0].Key)
+	assert.Equal(t, "red", parsed.GetString("--color"))
+
+	parsed, err = cmd.ParseArgs([]string{"--colo", "blue"})
+	assert.NoError(t, err, "an abbreviation of both names is not ambiguous")
+	assert.Equal(t, "blue", parsed.GetString("--color"))
+	assert.Contains(t, cmd.HelpText(), "--color, --colour")
+
+	bad, _ := ishell.NewArg("--size", ishell.IntType, ishell.WithAliases("-s"))
+	assert.Error(t, cmd.AddCmdArg(bad))
+
+	// aliases cannot take the flags of other arguments
+	for _, alias := range []string{"--color", "--colour", "--hue"} {
+		hue, _ := ishell.NewArg("--hue", ishell.StringType, ishell.WithAliases(alias))
+		assert.Error(t, cmd.AddCmdArg(hue), alias)
+	}
+	parsed, err = cmd.ParseArgs([]string{"--color", "green"})
+	assert.NoError(t, err)
+	assert.Equal(t, "green", parsed.GetString("--color"))
+}
+
+func TestParsedArgSpans(t *testing.T) {
+	verbose, _ := ishell.NewArg("--verbose", ishell.CountType, ishell.WithShort("-v"))
+	quiet, _ := ishell.NewArg("--quiet", ishell.BoolType, ishell.WithShort("-q"))
+	name, _ := ishell.NewArg("--name", ishell.StringType, ishell.WithShort("-n"), ishell.Multiple())
+	level, _ := ishell.NewArg("--level", ishell.IntType, ishell.WithDefault("1"))
+	files, _ := ishell.NewArg("files", ishell.StringType, ishell.Rest())
+	cmd := ishell.Cmd{Name: "run"}
+	for _, arg := range []*ishell.CmdArg{verbose, quiet, name, level, files} {
+		cmd.AddCmdArg(arg)
+	}
+
+	args := []string{"-vq", "--name", "x", "-v", "-nfoo", "a", "-b"}
+	parsed, err := cmd.ParseArgs(args)
+	assert.NoError(t, err)
+	spans := map[string][][2]int{}
+	for _, arg := range parsed {
+		spans[arg.Key] = append(spans[arg.Key], [2]int{arg.Start, arg.End})
+	}
+	assert.Equal(t, [][2]int{{0, 4}}, spans["--verbose"])
+	assert.Equal(t, [][2]int{{0, 1}}, spans["--quiet"])
+	assert.Equal(t, [][2]int{{1, 3}, {4, 5}}, spans["--name"])
+	assert.Equal(t, [][2]int{{0, 0}}, spans["--level"])
+	assert.Equal(t, [][2]int{{5, 6}, {6, 7}}, spans["files"])
+}
+
+func TestJSONArgs(t *testing.T) {
+	spec, _ := ishell.NewArg("spec", ishell.JSONType)
+	cmd := ishell.Cmd{Name: "apply"}
+	cmd.AddCmdArg(spec)
+
+	parsed, err := cmd.ParseArgs([]string{`{"name": "web", "replicas": 3}`})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "web", "replicas": 3.0}, parsed[0].Parsed)
+	var dst struct {
+		Name     string
+		Replicas int
+	}
+	assert.NoError(t, parsed.DecodeJSON("spec", &dst))
+	assert.Equal(t, 3, dst.Replicas)
+
+	_, err = cmd.ParseArgs([]string{`{"name": `})
+	assert.ErrorIs(t, err, ishell.ErrInvalidValue)
+}
+
+func TestSizeArgs(t *testing.T) {
+	size, _ := ishell.NewArg("--size", ishell.SizeType, ishell.Multiple())
+	cmd := ishell.Cmd{Name: "alloc"}
+	cmd.AddCmdArg(size)
+
+	parsed, err := cmd.ParseArgs([]string{"--size", "512K", "--size", "10MB", "--size", "2GiB", "--size", "1.5g", "--size", "100"})
+	assert.NoError(t, err)
+	var sizes []int64
+	for _, arg := range parsed {
+		sizes = append(sizes, arg.Size())
+	}
+	assert.Equal(t, []int64{512 << 10, 10e6, 2 << 30, 3 << 29, 100}, sizes)
+
+	for _, value := range []string{"10XB", "MB", "-1K", "99999P"} {
+		_, err = cmd.ParseArgs([]string{"--size", value})
+		assert.ErrorIs(t, err, ishell.ErrInvalidValue, value)
+	}
+}
+
+func TestArgGroups(t *testing.T) {
+	host, _ := ishell.NewArg("--host", ishell.StringType, ishell.WithGroup("Connection options"))
+	format, _ := ishell.NewArg("--format", ishell.StringType, ishell.WithGroup("Output options"))
+	port, _ := ishell.NewArg("--port", ishell.IntType, ishell.WithGroup("Connection options"))
+	name, _ := ishell.NewArg("name", ishell.StringType)
+	cmd := ishell.Cmd{Name: "connect", Help: "connect to a server"}
+	cmd.AddCmdArg(host)
+	cmd.AddCmdArg(format)
+	cmd.AddCmdArg(port)
+	cmd.AddCmdArg(name)
+
+	expected := "\nUsage: connect [--host <string>] [--format <string>] [--port <int>] [<name>]\n" +
+		"\nconnect to a server\n" +
+		"\nArguments:\n  <name>  string      \n" +
+		"\nConnection options:\n  --host  string      \n  --port  int         \n" +
+		"\nOutput options:\n  --format  string      \n\n"
+	assert.Equal(t, expected, cmd.HelpText())
+}
+
+func TestHiddenArgs(t *testing.T) {
+	debug, _ := ishell.NewCmdArg("", "--trace", ishell.BoolType, false, false)
+	debug.Hidden = true
+	cmd := ishell.Cmd{Name: "root", Help: "root help"}
+	cmd.AddCmdArg(debug)
+
+	_, err := cmd.ParseArgs([]string{"--trace"})
+	assert.NoError(t, err)
+	assert.NotContains(t, cmd.HelpText(), "--trace")
+	assert.NotContains(t, cmd.HelpText(), "Arguments:")
+}
+
 func TestPositionalCmdArgsParsing(t *testing.T) {
 	arg1_type := ishell.StringType
 	arg2_type := ishell.StringType
@@ -260,7 +1472,7 @@ func TestPositionalCmdArgsParsing(t *testing.T) {
 }
 
 // test canHaveMultiple with positionals
-// it doesn't work well if there are multiple positional args
+// an optional positional after one that can have multiple values gets none
 func TestPositionalCmdArgsParsing2(t *testing.T) {
 	arg1_type := ishell.StringType
 	arg2_type := ishell.StringType
@@ -299,4 +1511,86 @@ func TestPositionalCmdArgsParsing2(t *testing.T) {
 		assert.Equal(t, arg1_type, parsed1[idx].Typ, fmt.Sprintf("PositionalCmdArgsParsing:Test1 Typ %d != %d", arg1_type, parsed1[idx].Typ))
 		assert.Equal(t, "test1", parsed1[idx].Value, fmt.Sprintf("PositionalCmdArgsParsing:Test1 Value %s != %s", "test1", parsed1[idx].Value))
 	}
-}
\ No newline at end of file
+}
+func TestMultiplePositionalsReserveRequired(t *testing.T) {
+	src, _ := ishell.NewArg("src", ishell.StringType, ishell.Required(), ishell.Multiple())
+	dst, _ := ishell.NewArg("dst", ishell.StringType, ishell.Required())
+	force, _ := ishell.NewArg("--mode", ishell.StringType, ishell.WithShort("-m"))
+	cmd := ishell.Cmd{Name: "cp"}
+	cmd.AddCmdArg(src)
+	cmd.AddCmdArg(dst)
+	cmd.AddCmdArg(force)
+
+	parsed, err := cmd.ParseArgs([]string{"a", "-m", "644", "b", "c", "/tmp"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, parsed.Values("src"))
+	assert.Equal(t, "/tmp", parsed.GetString("dst"))
+	assert.Equal(t, "644", parsed.GetString("--mode"))
+
+	_, err = cmd.ParseArgs([]string{"a"})
+	var missing *ishell.ErrMissingRequired
+	assert.ErrorAs(t, err, &missing)
+}
+
+func newBenchCmd(b *testing.B) *ishell.Cmd {
+	cmd := &ishell.Cmd{Name: "bench"}
+	for _, a := range []struct {
+		flag, long string
+		typ        ishell.ArgType
+	}{
+		{"-a", "--alpha", ishell.BoolType},
+		{"-b", "--beta", ishell.BoolType},
+		{"-c", "--gamma", ishell.BoolType},
+		{"-n", "--number", ishell.IntType},
+		{"-s", "--string", ishell.StringType},
+	} {
+		arg, err := ishell.NewCmdArg(a.flag, a.long, a.typ, false, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		cmd.AddCmdArg(arg)
+	}
+	return cmd
+}
+
+func BenchmarkParseArgsGroupedFlags(b *testing.B) {
+	cmd := newBenchCmd(b)
+	args := []string{"-abc", "-n", "42", "-s", "value"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cmd.ParseArgs(args); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseArgsManyArgs(b *testing.B) {
+	cmd := &ishell.Cmd{Name: "bench"}
+	args := make([]string, 0, 300)
+	for i := 0; i < 150; i++ {
+		long := fmt.Sprintf("--option-%03d", i)
+		arg, err := ishell.NewCmdArg("", long, ishell.StringType, false, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		cmd.AddCmdArg(arg)
+		args = append(args, long, "value")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cmd.ParseArgs(args); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPrefixIndexCopies(t *testing.T) {
+	index := ishell.NewPrefixIndex([]string{"list", "load", "ls", "move"})
+	words := index.WithPrefix("l")
+	assert.Equal(t, []string{"list", "load", "ls"}, words)
+	_ = append(words[:1], "x", "y", "z")
+	assert.Equal(t, []string{"list", "load", "ls"}, index.WithPrefix("l"))
+	assert.Equal(t, []string{"move"}, index.WithPrefix("m"))
+}
@@ -0,0 +1,177 @@
+// Package cobra converts a github.com/spf13/cobra command tree into ishell
+// commands, so an existing CLI can gain an interactive mode:
+//
+//	shell := ishell.New()
+//	if err := cobra.AddCommands(shell, rootCmd); err != nil {
+//		log.Fatal(err)
+//	}
+//	shell.Run()
+//
+// The flags of the cobra commands become arguments of the ishell commands,
+// for help, completion and validation, while running a command executes it
+// through cobra with the words typed, so its hooks and argument validators
+// still apply. The cobra commands must not be executed concurrently.
+package cobra
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ryupatterson/ishell"
+	spf13 "github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// AddCommands adds the subcommands of root to shell as top level commands.
+// The persistent flags of root are taken by all of them.
+func AddCommands(shell *ishell.Shell, root *spf13.Command) error {
+	for _, cmd := range root.Commands() {
+		if skip(cmd) {
+			continue
+		}
+		converted, err := Convert(cmd)
+		if err != nil {
+			return err
+		}
+		shell.AddCmd(converted)
+	}
+	return nil
+}
+
+// Convert returns cmd and its subcommands as an ishell command, taking the
+// flags cmd inherits from its parents too.
+func Convert(cmd *spf13.Command) (*ishell.Cmd, error) {
+	converted, err := convert(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var flagErr error
+	cmd.InheritedFlags().VisitAll(func(f *pflag.Flag) {
+		if flagErr == nil {
+			flagErr = addFlag(converted, f, true)
+		}
+	})
+	return converted, flagErr
+}
+
+func convert(cmd *spf13.Command) (*ishell.Cmd, error) {
+	converted := &ishell.Cmd{
+		Name:               cmd.Name(),
+		Aliases:            cmd.Aliases,
+		Help:               cmd.Short,
+		LongHelp:           cmd.Long,
+		Deprecated:         cmd.Deprecated != "",
+		DeprecationMessage: cmd.Deprecated,
+		Category:           groupTitle(cmd),
+	}
+	if cmd.Runnable() {
+		converted.ErrFunc = func(c *ishell.Context) error {
+			return execute(cmd, c)
+		}
+		args, _ := ishell.NewArg("args", ishell.StringType, ishell.Multiple())
+		if err := converted.AddCmdArg(args); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	cmd.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if err == nil {
+			err = addFlag(converted, f, false)
+		}
+	})
+	cmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if err == nil {
+			err = addFlag(converted, f, true)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range cmd.Commands() {
+		if skip(child) {
+			continue
+		}
+		sub, err := convert(child)
+		if err != nil {
+			return nil, err
+		}
+		converted.AddCmd(sub)
+	}
+	return converted, nil
+}
+
+// skip tells if cmd is left out of the shell: hidden commands, and the
+// help and completion commands cobra adds.
+func skip(cmd *spf13.Command) bool {
+	return cmd.Hidden || cmd.Name() == "help" || cmd.Name() == "completion"
+}
+
+// groupTitle returns the title of the group cmd is listed under in the help
+// of its parent.
+func groupTitle(cmd *spf13.Command) string {
+	if cmd.GroupID == "" || !cmd.HasParent() {
+		return ""
+	}
+	for _, group := range cmd.Parent().Groups() {
+		if group.ID == cmd.GroupID {
+			return strings.TrimSuffix(group.Title, ":")
+		}
+	}
+	return ""
+}
+
+// addFlag adds f to cmd as an argument, persistent if it is taken by the
+// subcommands too.
+func addFlag(cmd *ishell.Cmd, f *pflag.Flag, persistent bool) error {
+	if f.Name == "help" {
+		return nil
+	}
+	typ, multiple := argType(f.Value.Type())
+	opts := []ishell.ArgOption{ishell.WithHelp(f.Usage)}
+	if len(f.Shorthand) == 1 {
+		opts = append(opts, ishell.WithShort("-"+f.Shorthand))
+	}
+	if multiple {
+		opts = append(opts, ishell.Multiple())
+	}
+	if required := f.Annotations[spf13.BashCompOneRequiredFlag]; len(required) > 0 && required[0] == "true" {
+		opts = append(opts, ishell.Required())
+	}
+	arg, err := ishell.NewArg("--"+f.Name, typ, opts...)
+	if err != nil {
+		return fmt.Errorf("flag '%s' of '%s': %v", f.Name, cmd.Name, err)
+	}
+	arg.Hidden = f.Hidden
+	if persistent {
+		return cmd.AddPersistentCmdArg(arg)
+	}
+	return cmd.AddCmdArg(arg)
+}
+
+// argType returns the type of argument for a pflag value type, and whether
+// the flag can be given more than once.
+func argType(typ string) (ishell.ArgType, bool) {
+	switch typ {
+	case "bool":
+		return ishell.BoolType, false
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return ishell.IntType, false
+	case "float32", "float64":
+		return ishell.FloatType, false
+	case "duration":
+		return ishell.DurationType, false
+	case "count":
+		return ishell.CountType, false
+	case "ip":
+		return ishell.IPType, false
+	case "intSlice":
+		return ishell.IntSliceType, true
+	case "stringSlice":
+		return ishell.StringSliceType, true
+	case "stringArray":
+		return ishell.StringType, true
+	}
+	return ishell.StringType, false
+}
@@ -0,0 +1,78 @@
+package cobra_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ryupatterson/ishell"
+	"github.com/ryupatterson/ishell/compat/cobra"
+	spf13 "github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRootCmd() *spf13.Command {
+	root := &spf13.Command{Use: "app"}
+	root.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
+	root.AddGroup(&spf13.Group{ID: "net", Title: "Networking:"})
+
+	var count int
+	var tags []string
+	ping := &spf13.Command{
+		Use:     "ping <host>",
+		Short:   "ping a host",
+		Aliases: []string{"p"},
+		GroupID: "net",
+		Args:    spf13.ExactArgs(1),
+		Run: func(cmd *spf13.Command, args []string) {
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			cmd.Println("ping", args[0], count, strings.Join(tags, ","), verbose)
+		},
+	}
+	ping.Flags().IntVarP(&count, "count", "c", 1, "number of pings")
+	ping.Flags().StringSliceVar(&tags, "tag", nil, "tags")
+	ping.Flags().String("zone", "", "zone")
+	ping.MarkFlagRequired("zone")
+	root.AddCommand(ping, &spf13.Command{Use: "secret", Hidden: true, Run: func(*spf13.Command, []string) {}})
+	return root
+}
+
+func TestAddCommands(t *testing.T) {
+	var out, cliOut bytes.Buffer
+	shell := ishell.New()
+	shell.SetOut(&out)
+	root := newRootCmd()
+	root.SetOut(&cliOut)
+	assert.NoError(t, cobra.AddCommands(shell, root))
+
+	assert.NoError(t, shell.Process("p", "8.8.8.8", "-c", "3", "--tag", "a,b", "-v", "--zone", "eu"))
+	// flags are reset between runs
+	assert.NoError(t, shell.Process("ping", "1.1.1.1", "--zone", "eu"))
+	assert.Equal(t, "ping 8.8.8.8 3 a,b true\nping 1.1.1.1 1  false\n", out.String())
+
+	// the root command is left as it was
+	assert.Same(t, &cliOut, root.OutOrStdout())
+	assert.Equal(t, os.Stderr, root.ErrOrStderr())
+	assert.False(t, root.SilenceErrors)
+	assert.False(t, root.SilenceUsage)
+
+	// validated by ishell and cobra
+	assert.Error(t, shell.Process("ping", "1.1.1.1"))
+	assert.Error(t, shell.Process("ping", "--zone", "eu"))
+
+	help := shell.HelpText()
+	assert.Contains(t, help, "Networking")
+	assert.Contains(t, help, "ping a host")
+	assert.NotContains(t, help, "secret")
+}
+
+func TestConvert(t *testing.T) {
+	root := newRootCmd()
+	ping, _, _ := root.Find([]string{"ping"})
+	cmd, err := cobra.Convert(ping)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", cmd.Name)
+	assert.Equal(t, []string{"p"}, cmd.Aliases)
+	assert.Equal(t, "ping [<args>]... [-c|--count <int>] [--tag <strings>]... --zone <string> [-v|--verbose]", cmd.Usage())
+}
@@ -0,0 +1,57 @@
+package cobra
+
+import (
+	"strings"
+
+	"github.com/ryupatterson/ishell"
+	spf13 "github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// execute runs cmd through its root command with the words of c, printing
+// through c. Errors are returned for the shell to show rather than printed
+// by cobra. The output and silencing of the root command are restored
+// afterwards, unset writers to os.Stdout and os.Stderr.
+func execute(cmd *spf13.Command, c *ishell.Context) error {
+	var path []string
+	for p := cmd; p.HasParent(); p = p.Parent() {
+		path = append([]string{p.Name()}, path...)
+	}
+	// cobra keeps flag values between executions
+	for p := cmd; p != nil; p = p.Parent() {
+		resetFlags(p.Flags())
+		resetFlags(p.PersistentFlags())
+	}
+
+	root := cmd.Root()
+	out, errOut := root.OutOrStdout(), root.ErrOrStderr()
+	silenceErrors, silenceUsage := root.SilenceErrors, root.SilenceUsage
+	defer func() {
+		root.SetOut(out)
+		root.SetErr(errOut)
+		root.SilenceErrors, root.SilenceUsage = silenceErrors, silenceUsage
+	}()
+	root.SetArgs(append(path, c.Args...))
+	root.SetOut(c.Writer())
+	root.SetErr(c.Writer())
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+	_, err := root.ExecuteContextC(c.Context())
+	return err
+}
+
+// resetFlags sets the flags of set back to their defaults.
+func resetFlags(set *pflag.FlagSet) {
+	set.VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			var values []string
+			if def := strings.Trim(f.DefValue, "[]"); def != "" {
+				values = strings.Split(def, ",")
+			}
+			slice.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
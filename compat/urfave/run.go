@@ -0,0 +1,61 @@
+package urfave
+
+import (
+	"strings"
+
+	"github.com/ryupatterson/ishell"
+	"github.com/urfave/cli/v2"
+)
+
+// run runs the command of app named by path with the words of c, printing
+// through c. cli stops parsing flags at the first argument and takes the
+// global flags before the command, so the words are reordered as
+//
+//	app <global flags> <path> <command flags> <args>
+//
+// Errors are returned for the shell to show rather than exiting.
+func run(app *cli.App, path []string, c *ishell.Context) error {
+	global := make(map[string]bool)
+	for _, flag := range app.Flags {
+		if names := flag.Names(); len(names) > 0 {
+			global[longFlag(names[0])] = true
+		}
+	}
+
+	// the words of each flag by their start, grouped short flags share one
+	owner := make(map[int]ishell.ParsedArg)
+	for _, arg := range c.ParsedArgs {
+		if arg.End > arg.Start && arg.Key != "args" {
+			if _, ok := owner[arg.Start]; !ok {
+				owner[arg.Start] = arg
+			}
+		}
+	}
+	var globals, locals, args []string
+	for i := 0; i < len(c.Args); i++ {
+		arg, ok := owner[i]
+		switch {
+		case !ok:
+			args = append(args, c.Args[i])
+			continue
+		case global[arg.Key]:
+			globals = append(globals, c.Args[arg.Start:arg.End]...)
+		default:
+			locals = append(locals, c.Args[arg.Start:arg.End]...)
+		}
+		i = arg.End - 1
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		locals = append(locals, "--")
+	}
+
+	argv := append([]string{app.Name}, globals...)
+	argv = append(argv, path...)
+	argv = append(argv, locals...)
+	argv = append(argv, args...)
+
+	app.Writer = c.Writer()
+	app.ErrWriter = c.Writer()
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	return app.RunContext(c.Context(), argv)
+}
@@ -0,0 +1,172 @@
+// Package urfave converts the commands and flags of a
+// github.com/urfave/cli/v2 application into ishell commands, so an
+// existing CLI can gain an interactive mode:
+//
+//	shell := ishell.New()
+//	if err := urfave.AddCommands(shell, app); err != nil {
+//		log.Fatal(err)
+//	}
+//	shell.Run()
+//
+// The flags become arguments of the ishell commands, for help, completion
+// and validation, while running a command runs the application with the
+// words typed, so its Before and After hooks still apply. The global flags
+// of the application are taken by every command. The application must not
+// be run concurrently.
+package urfave
+
+import (
+	"fmt"
+
+	"github.com/ryupatterson/ishell"
+	"github.com/urfave/cli/v2"
+)
+
+// AddCommands adds the commands of app to shell as top level commands.
+func AddCommands(shell *ishell.Shell, app *cli.App) error {
+	for _, cmd := range app.Commands {
+		if skip(cmd) {
+			continue
+		}
+		converted, err := Convert(app, cmd)
+		if err != nil {
+			return err
+		}
+		shell.AddCmd(converted)
+	}
+	return nil
+}
+
+// Convert returns cmd, a command of app, and its subcommands as an ishell
+// command taking the global flags of app too.
+func Convert(app *cli.App, cmd *cli.Command) (*ishell.Cmd, error) {
+	converted, err := convert(app, cmd, []string{cmd.Name})
+	if err != nil {
+		return nil, err
+	}
+	for _, flag := range app.Flags {
+		if err := addFlag(converted, flag, true); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// convert converts cmd, found in app by the command names in path.
+func convert(app *cli.App, cmd *cli.Command, path []string) (*ishell.Cmd, error) {
+	converted := &ishell.Cmd{
+		Name:     cmd.Name,
+		Aliases:  cmd.Aliases,
+		Help:     cmd.Usage,
+		LongHelp: cmd.Description,
+		Category: cmd.Category,
+	}
+	if cmd.Action != nil {
+		converted.ErrFunc = func(c *ishell.Context) error {
+			return run(app, path, c)
+		}
+		opts := []ishell.ArgOption{ishell.Multiple()}
+		if cmd.SkipFlagParsing {
+			opts = append(opts, ishell.Rest())
+		}
+		args, _ := ishell.NewArg("args", ishell.StringType, opts...)
+		if err := converted.AddCmdArg(args); err != nil {
+			return nil, err
+		}
+	}
+	if !cmd.SkipFlagParsing {
+		for _, flag := range cmd.Flags {
+			if err := addFlag(converted, flag, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, child := range cmd.Subcommands {
+		if skip(child) {
+			continue
+		}
+		sub, err := convert(app, child, append(path[:len(path):len(path)], child.Name))
+		if err != nil {
+			return nil, err
+		}
+		converted.AddCmd(sub)
+	}
+	return converted, nil
+}
+
+// skip tells if cmd is left out of the shell: hidden commands, and the help
+// command cli adds.
+func skip(cmd *cli.Command) bool {
+	return cmd.Hidden || cmd.Name == "help"
+}
+
+// addFlag adds flag to cmd as an argument, persistent for the global flags
+// of the application.
+func addFlag(cmd *ishell.Cmd, flag cli.Flag, persistent bool) error {
+	names := flag.Names()
+	if len(names) == 0 || names[0] == "help" {
+		return nil
+	}
+	typ, multiple := argType(flag)
+	var opts []ishell.ArgOption
+	var aliases []string
+	for _, name := range names[1:] {
+		if len(name) == 1 {
+			opts = append(opts, ishell.WithShort("-"+name))
+		} else {
+			aliases = append(aliases, "--"+name)
+		}
+	}
+	if len(aliases) > 0 {
+		opts = append(opts, ishell.WithAliases(aliases...))
+	}
+	if doc, ok := flag.(cli.DocGenerationFlag); ok {
+		opts = append(opts, ishell.WithHelp(doc.GetUsage()))
+	}
+	if category, ok := flag.(cli.CategorizableFlag); ok && category.GetCategory() != "" {
+		opts = append(opts, ishell.WithGroup(category.GetCategory()))
+	}
+	if required, ok := flag.(cli.RequiredFlag); ok && required.IsRequired() {
+		opts = append(opts, ishell.Required())
+	}
+	if multiple {
+		opts = append(opts, ishell.Multiple())
+	}
+	arg, err := ishell.NewArg(longFlag(names[0]), typ, opts...)
+	if err != nil {
+		return fmt.Errorf("flag '%s' of '%s': %v", names[0], cmd.Name, err)
+	}
+	if visible, ok := flag.(cli.VisibleFlag); ok {
+		arg.Hidden = !visible.IsVisible()
+	}
+	if persistent {
+		return cmd.AddPersistentCmdArg(arg)
+	}
+	return cmd.AddCmdArg(arg)
+}
+
+// longFlag returns the long flag of an argument for the flag name.
+func longFlag(name string) string {
+	return "--" + name
+}
+
+// argType returns the type of argument for flag, and whether the flag can
+// be given more than once.
+func argType(flag cli.Flag) (ishell.ArgType, bool) {
+	switch flag.(type) {
+	case *cli.BoolFlag:
+		return ishell.BoolType, false
+	case *cli.IntFlag, *cli.Int64Flag, *cli.UintFlag, *cli.Uint64Flag:
+		return ishell.IntType, false
+	case *cli.Float64Flag:
+		return ishell.FloatType, false
+	case *cli.DurationFlag:
+		return ishell.DurationType, false
+	case *cli.PathFlag:
+		return ishell.FilePathType, false
+	case *cli.StringSliceFlag, *cli.IntSliceFlag, *cli.Int64SliceFlag,
+		*cli.UintSliceFlag, *cli.Uint64SliceFlag, *cli.Float64SliceFlag:
+		return ishell.StringType, true
+	}
+	return ishell.StringType, false
+}
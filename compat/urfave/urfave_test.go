@@ -0,0 +1,70 @@
+package urfave_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ryupatterson/ishell"
+	"github.com/ryupatterson/ishell/compat/urfave"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func newApp() *cli.App {
+	return &cli.App{
+		Name:  "app",
+		Flags: []cli.Flag{&cli.BoolFlag{Name: "verbose", Aliases: []string{"v"}, Usage: "verbose output"}},
+		Commands: []*cli.Command{
+			{
+				Name:     "ping",
+				Aliases:  []string{"p"},
+				Usage:    "ping a host",
+				Category: "Networking",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "count", Aliases: []string{"c"}, Value: 1, Usage: "number of pings"},
+					&cli.StringSliceFlag{Name: "tag"},
+					&cli.StringFlag{Name: "zone", Required: true},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return cli.Exit("ping takes one host", 2)
+					}
+					fmt.Fprintln(c.App.Writer, "ping", c.Args().First(), c.Int("count"),
+						strings.Join(c.StringSlice("tag"), ","), c.Bool("verbose"), c.String("zone"))
+					return nil
+				},
+			},
+			{Name: "secret", Hidden: true, Action: func(*cli.Context) error { return nil }},
+		},
+	}
+}
+
+func TestAddCommands(t *testing.T) {
+	var out bytes.Buffer
+	shell := ishell.New()
+	shell.SetOut(&out)
+	assert.NoError(t, urfave.AddCommands(shell, newApp()))
+
+	// flags after the host and global flags after the command
+	assert.NoError(t, shell.Process("p", "8.8.8.8", "-c", "3", "--tag", "a", "--tag", "b", "-v", "--zone", "eu"))
+	assert.NoError(t, shell.Process("ping", "--zone", "us", "1.1.1.1"))
+	assert.Equal(t, "ping 8.8.8.8 3 a,b true eu\nping 1.1.1.1 1  false us\n", out.String())
+
+	assert.Error(t, shell.Process("ping", "1.1.1.1"))
+	assert.EqualError(t, shell.Process("ping", "--zone", "eu"), "ping takes one host")
+
+	help := shell.HelpText()
+	assert.Contains(t, help, "Networking")
+	assert.Contains(t, help, "ping a host")
+	assert.NotContains(t, help, "secret")
+}
+
+func TestConvert(t *testing.T) {
+	app := newApp()
+	cmd, err := urfave.Convert(app, app.Commands[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p"}, cmd.Aliases)
+	assert.Equal(t, "ping [<args>]... [-c|--count <int>] [--tag <string>]... --zone <string> [-v|--verbose]", cmd.Usage())
+}
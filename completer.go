@@ -1,14 +1,39 @@
 package ishell
 
 import (
+	"sort"
 	"strings"
-
-	"github.com/flynn-archive/go-shlex"
+	"sync/atomic"
 )
 
 type iCompleter struct {
 	cmd      *Cmd
 	disabled func() bool
+	stats    *completionStats
+	// scope, if not nil, returns the words to complete after as typed at
+	// the top level, see Cmd.Subshell.
+	scope func(words []string) []string
+	// tags, if not nil, returns the tags the completion of command names
+	// is restricted to, see Shell.SetCompletionTags.
+	tags func() []string
+}
+
+// completionStats counts how often completion could use an existing
+// prefix index, reported by the debug command.
+type completionStats struct {
+	hits   int64
+	misses int64
+}
+
+func (s *completionStats) record(hit bool) {
+	if s == nil {
+		return
+	}
+	if hit {
+		atomic.AddInt64(&s.hits, 1)
+	} else {
+		atomic.AddInt64(&s.misses, 1)
+	}
 }
 
 func (ic iCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
@@ -16,7 +41,7 @@ func (ic iCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
 		return nil, len(line)
 	}
 	var words []string
-	if w, err := shlex.Split(string(line)); err == nil {
+	if w, err := SplitArgs(string(line)); err == nil {
 		words = w
 	} else {
 		// fall back
@@ -45,9 +70,17 @@ func (ic iCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
 }
 
 func (ic iCompleter) getWords(prefix string, w []string) (s []string) {
+	if ic.scope != nil {
+		w = ic.scope(w)
+	}
+	if names, ok := ic.cmd.completeNamespace(prefix, w); ok {
+		return names
+	}
 	cmd, args := ic.cmd.FindCmd(w)
 	if cmd == nil {
 		cmd, args = ic.cmd, w
+	} else {
+		cmd = cmd.inherit(ic.cmd.ancestors(w[:len(w)-len(args)]))
 	}
 	if cmd.CompleterWithPrefix != nil {
 		return cmd.CompleterWithPrefix(prefix, args)
@@ -55,8 +88,138 @@ func (ic iCompleter) getWords(prefix string, w []string) (s []string) {
 	if cmd.Completer != nil {
 		return cmd.Completer(args)
 	}
-	for k := range cmd.children {
-		s = append(s, k)
+	if values, ok := cmd.completeValue(prefix, args); ok {
+		return values
+	}
+	if strings.HasPrefix(prefix, "-") && len(cmd.arglist) > 0 {
+		flags, hit := cmd.completeFlags(prefix)
+		ic.stats.record(hit)
+		return flags
+	}
+	names, hit := cmd.completeChildren(prefix)
+	ic.stats.record(hit)
+	if ic.tags != nil {
+		if tags := ic.tags(); len(tags) > 0 {
+			matches := cmd.taggedChildren(tags)
+			var tagged []string
+			for _, name := range names {
+				if matches[name] {
+					tagged = append(tagged, name)
+				}
+			}
+			names = tagged
+		}
+	}
+	return names
+}
+
+// prefixIndex is a sorted list of words that supports prefix lookups in
+// logarithmic time, keeping completion fast for very large command trees.
+type prefixIndex []string
+
+func newPrefixIndex(words []string) prefixIndex {
+	sort.Strings(words)
+	return prefixIndex(words)
+}
+
+// withPrefix returns a copy of the words that start with prefix.
+func (p prefixIndex) withPrefix(prefix string) []string {
+	i := sort.SearchStrings(p, prefix)
+	n := sort.Search(len(p)-i, func(j int) bool {
+		return !strings.HasPrefix(p[i+j], prefix)
+	})
+	return append([]string(nil), p[i:i+n]...)
+}
+
+// completeChildren returns the names of subcommands starting with prefix,
+// and whether the index of them was already built.
+func (c *Cmd) completeChildren(prefix string) ([]string, bool) {
+	cmdTree.Lock()
+	hit := c.childIndex != nil
+	if !hit {
+		names := make([]string, 0, len(c.children))
+		for name := range c.children {
+			names = append(names, name)
+		}
+		c.childIndex = newPrefixIndex(names)
+	}
+	// the index is replaced, never modified, so it can be read unlocked
+	index, provided := c.childIndex, len(c.providers) > 0
+	cmdTree.Unlock()
+	if !provided {
+		return index.withPrefix(prefix), hit
+	}
+	names := index.withPrefix(prefix)
+	for _, cmd := range c.provided() {
+		if strings.HasPrefix(cmd.Name, prefix) {
+			names = append(names, cmd.Name)
+		}
+	}
+	return names, hit
+}
+
+// completeNamespace completes prefix as subcommands joined by the namespace
+// separator, e.g. "net.pi" to "net.ping", if the words w name commands and
+// prefix names their subcommands up to its last separator.
+func (c *Cmd) completeNamespace(prefix string, w []string) ([]string, bool) {
+	path, n := c.findPath(w)
+	if n != len(w) {
+		return nil, false
+	}
+	parent := c
+	fold, sep := c.lookupSettings(false, "")
+	for _, cmd := range path {
+		parent = cmd
+		fold, sep = cmd.lookupSettings(fold, sep)
+	}
+	i := strings.LastIndex(prefix, sep)
+	if sep == "" || i < 0 {
+		return nil, false
+	}
+	for _, name := range strings.Split(prefix[:i], sep) {
+		if parent = parent.findChildCmd(name, fold); parent == nil {
+			return nil, false
+		}
+	}
+	head := prefix[:i+len(sep)]
+	children, _ := parent.completeChildren(prefix[len(head):])
+	names := make([]string, len(children))
+	for j, name := range children {
+		names[j] = head + name
+	}
+	return names, true
+}
+
+// completeValue returns the values for the flag that args end with, if it
+// takes a value with a Completer or Choices.
+func (c *Cmd) completeValue(prefix string, args []string) ([]string, bool) {
+	if len(args) == 0 || !c.takes_value(args[len(args)-1]) {
+		return nil, false
+	}
+	arg := c.arglist[c.find_arg(args[len(args)-1])]
+	if arg.Completer != nil {
+		return arg.Completer(prefix), true
+	}
+	if len(arg.Choices) > 0 {
+		return arg.Choices, true
+	}
+	return nil, false
+}
+
+// completeFlags returns the flags and long flags starting with prefix, and
+// whether the index of them was already built.
+func (c *Cmd) completeFlags(prefix string) ([]string, bool) {
+	cmdTree.Lock()
+	defer cmdTree.Unlock()
+	hit := c.flagIndex != nil
+	if !hit {
+		flags := make([]string, 0, len(c.argindex))
+		for flag, index := range c.argindex {
+			if !c.arglist[index].Hidden {
+				flags = append(flags, flag)
+			}
+		}
+		c.flagIndex = newPrefixIndex(flags)
 	}
-	return
+	return c.flagIndex.withPrefix(prefix), hit
 }
@@ -0,0 +1,341 @@
+package ishell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// configKey is a key registered with a ConfigStore.
+type configKey struct {
+	name string
+	typ  ArgType
+	def  string
+	help string
+	// helpFunc, if not nil, builds the help when it is shown
+	helpFunc func() string
+	onChange func(value string) error
+}
+
+// ConfigStore holds typed configuration values of the shell and the
+// application, optionally persisted to a file. Keys must be registered
+// before they can be set.
+type ConfigStore struct {
+	keys map[string]*configKey
+	// values set explicitly, including values loaded for keys that are
+	// not registered yet.
+	values map[string]string
+	path   string
+	shell  *Shell
+	sync.Mutex
+}
+
+func newConfigStore(s *Shell) *ConfigStore {
+	return &ConfigStore{
+		keys:   make(map[string]*configKey),
+		values: make(map[string]string),
+		shell:  s,
+	}
+}
+
+// validateConfigValue checks that value is valid for typ.
+func validateConfigValue(typ ArgType, value string) error {
+	switch typ {
+	case IntType:
+		if !validate_int(value) {
+			return fmt.Errorf("%s is not a valid integer", value)
+		}
+	case FloatType:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%s is not a valid float", value)
+		}
+	case DurationType:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s is not a valid duration", value)
+		}
+	case BoolType:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s is not a valid boolean", value)
+		}
+	}
+	return nil
+}
+
+// Register adds key with its type, default value and help. onChange, if
+// not nil, is called with the value whenever it changes, and right away
+// if a value for key was loaded from the config file.
+func (c *ConfigStore) Register(key string, typ ArgType, def string, help string, onChange func(value string) error) error {
+	if err := validateConfigValue(typ, def); err != nil {
+		return fmt.Errorf("default of %s: %v", key, err)
+	}
+	c.Lock()
+	if _, ok := c.keys[key]; ok {
+		c.Unlock()
+		return fmt.Errorf("config key %s is already registered", key)
+	}
+	c.keys[key] = &configKey{name: key, typ: typ, def: def, help: help, onChange: onChange}
+	value, loaded := c.values[key]
+	c.Unlock()
+
+	if !loaded {
+		return nil
+	}
+	if err := validateConfigValue(typ, value); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	if onChange != nil {
+		return onChange(value)
+	}
+	return nil
+}
+
+// Get returns the value of key, or its default if it isn't set. ok is
+// false if key is not registered.
+func (c *ConfigStore) Get(key string) (value string, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	k, ok := c.keys[key]
+	if !ok {
+		return "", false
+	}
+	if value, set := c.values[key]; set {
+		return value, true
+	}
+	return k.def, true
+}
+
+// GetInt returns the value of an IntType key, 0 if it is not registered.
+func (c *ConfigStore) GetInt(key string) int {
+	value, _ := c.Get(key)
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+// GetBool returns the value of a BoolType key, false if it is not
+// registered.
+func (c *ConfigStore) GetBool(key string) bool {
+	value, _ := c.Get(key)
+	b, _ := strconv.ParseBool(value)
+	return b
+}
+
+// Set validates and sets the value of key and saves the store if it is
+// backed by a file.
+func (c *ConfigStore) Set(key string, value string) error {
+	c.Lock()
+	k, ok := c.keys[key]
+	c.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown config key %s", key)
+	}
+	if err := validateConfigValue(k.typ, value); err != nil {
+		return err
+	}
+	if k.onChange != nil {
+		if err := k.onChange(value); err != nil {
+			return err
+		}
+	}
+	c.Lock()
+	c.values[key] = value
+	c.Unlock()
+	return c.Save()
+}
+
+// Help returns the help of key.
+func (c *ConfigStore) Help(key string) string {
+	c.Lock()
+	k, ok := c.keys[key]
+	if !ok {
+		c.Unlock()
+		return ""
+	}
+	help, helpFunc := k.help, k.helpFunc
+	c.Unlock()
+	if helpFunc != nil {
+		return helpFunc()
+	}
+	return help
+}
+
+// setHelpFunc has the help of key built by help when it is shown, for keys
+// whose help changes after they are registered.
+func (c *ConfigStore) setHelpFunc(key string, help func() string) {
+	c.Lock()
+	defer c.Unlock()
+	if k, ok := c.keys[key]; ok {
+		k.helpFunc = help
+	}
+}
+
+// Keys returns the registered keys in alphabetical order.
+func (c *ConfigStore) Keys() []string {
+	c.Lock()
+	defer c.Unlock()
+	keys := make([]string, 0, len(c.keys))
+	for key := range c.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Load reads values from the JSON file at path and makes it the file the
+// store is saved to. A missing file is not an error. It returns
+// ErrRestricted if the shell is restricted with RestrictFiles.
+func (c *ConfigStore) Load(path string) error {
+	if err := c.shell.checkRestricted(RestrictFiles); err != nil {
+		return err
+	}
+	c.setPath(path)
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for key, value := range values {
+		c.Lock()
+		k, registered := c.keys[key]
+		c.Unlock()
+		if registered {
+			if err := validateConfigValue(k.typ, value); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, key, err)
+			}
+			if k.onChange != nil {
+				if err := k.onChange(value); err != nil {
+					return fmt.Errorf("%s: %s: %v", path, key, err)
+				}
+			}
+		}
+		c.Lock()
+		c.values[key] = value
+		c.Unlock()
+	}
+	return nil
+}
+
+// setPath sets the file the store is saved to, none if path is empty.
+func (c *ConfigStore) setPath(path string) {
+	c.Lock()
+	defer c.Unlock()
+	c.path = path
+}
+
+// Save writes the values that were set to the store's file, if any.
+func (c *ConfigStore) Save() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(c.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, b, 0600)
+}
+
+// Config returns the configuration store of the shell.
+func (s *Shell) Config() *ConfigStore {
+	return s.config
+}
+
+// EnableConfig loads the configuration from the JSON file at path and adds
+// the "config" command to get and set values at runtime. Changes are saved
+// to path. An empty path keeps the configuration in memory only.
+func (s *Shell) EnableConfig(path string) error {
+	cmd := &Cmd{
+		Name: "config",
+		Help: "get and set configuration",
+	}
+	cmd.AddCmd(&Cmd{
+		Name:     "get",
+		Help:     "show the value of a key",
+		LongHelp: "usage: config get <key>",
+		Func: func(c *Context) {
+			if len(c.Args) != 1 {
+				c.Err(errors.New("usage: config get <key>"))
+				return
+			}
+			value, ok := s.config.Get(c.Args[0])
+			if !ok {
+				c.Err(fmt.Errorf("unknown config key %s", c.Args[0]))
+				return
+			}
+			c.Println(value)
+		},
+		rawArgs: true,
+	})
+	cmd.AddCmd(&Cmd{
+		Name:     "set",
+		Help:     "set the value of a key",
+		LongHelp: "usage: config set <key> <value>",
+		Func: func(c *Context) {
+			if len(c.Args) != 2 {
+				c.Err(errors.New("usage: config set <key> <value>"))
+				return
+			}
+			c.Err(s.config.Set(c.Args[0], c.Args[1]))
+		},
+		rawArgs: true,
+	})
+	cmd.AddCmd(&Cmd{
+		Name: "list",
+		Help: "list all keys and their values",
+		Func: func(c *Context) {
+			w := tabwriter.NewWriter(c.Writer(), 0, 4, 2, ' ', 0)
+			for _, key := range s.config.Keys() {
+				value, _ := s.config.Get(key)
+				fmt.Fprintf(w, "%s\t%s\t%s\n", key, value, s.config.Help(key))
+			}
+			c.Err(w.Flush())
+		},
+	})
+	s.AddCmd(cmd)
+	if path == "" {
+		return nil
+	}
+	return s.config.Load(path)
+}
+
+// registerShellConfig registers the config keys of the shell's own
+// features.
+func registerShellConfig(s *Shell) {
+	s.config.Register("history.size", IntType, "500", "number of history entries kept", func(value string) error {
+		conf := s.reader.getConfig().Clone()
+		conf.HistoryLimit, _ = strconv.Atoi(value)
+		s.reader.setConfig(conf)
+		return nil
+	})
+	s.config.Register("editing.mode", StringType, "emacs", "line editing mode, emacs or vi", func(value string) error {
+		if value != "emacs" && value != "vi" {
+			return fmt.Errorf("editing mode must be emacs or vi")
+		}
+		conf := s.reader.getConfig().Clone()
+		conf.VimMode = value == "vi"
+		s.reader.setConfig(conf)
+		return nil
+	})
+	s.config.Register("theme", StringType, DefaultTheme.Name, "output theme", s.SetThemeByName)
+	s.config.setHelpFunc("theme", func() string {
+		return "output theme, one of " + strings.Join(Themes(), ", ")
+	})
+	s.config.Register("output.buffer", IntType, "0", "bytes of output to buffer, 0 to disable", func(value string) error {
+		size, _ := strconv.Atoi(value)
+		s.BufferOutput(size)
+		return nil
+	})
+}
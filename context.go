@@ -1,10 +1,19 @@
 package ishell
 
+import (
+	"context"
+	"io"
+)
+
 // Context is an ishell context. It embeds ishell.Actions.
 type Context struct {
 	contextValues
 	progressBar ProgressBar
 	err         error
+	shell       *Shell
+	ctx         context.Context
+	// the input that ran the NotFound handler, see Shell.NotFoundLine.
+	line string
 
 	// Args is command arguments.
 	Args []string
@@ -13,7 +22,11 @@ type Context struct {
 	RawArgs []string
 
 	// Parsed Args is command arguments with proper types
-	ParsedArgs []ParsedArg
+	ParsedArgs ParsedArgs
+
+	// User is the authenticated user, see Shell.SetAuthenticator. It is
+	// empty if no authenticator is set.
+	User string
 
 	// Cmd is the currently executing command. This is empty for NotFound and Interrupt.
 	Cmd Cmd
@@ -21,17 +34,90 @@ type Context struct {
 	Actions
 }
 
+// Errorln prints an error message, see OutputActions.Errorln.
+func (c *Context) Errorln(val ...interface{}) {
+	errorln(c.Actions, val...)
+}
+
+// Warnln prints a warning, see OutputActions.Warnln.
+func (c *Context) Warnln(val ...interface{}) {
+	warnln(c.Actions, val...)
+}
+
+// Flush writes out buffered output, see OutputActions.Flush. It is a
+// no-op if the Actions of c don't buffer output.
+func (c *Context) Flush() error {
+	if o, ok := c.Actions.(OutputActions); ok {
+		return o.Flush()
+	}
+	return nil
+}
+
 // Err informs ishell that an error occurred in the current
 // function.
 func (c *Context) Err(err error) {
 	c.err = err
 }
 
+// Context returns the context of the command, which is cancelled when the
+// command's Timeout expires. Long running commands should pass it on, e.g.
+// to network calls, or return when it is done.
+func (c *Context) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// OnCommit stages f until the transaction in progress is committed, see
+// Shell.Begin. Without a transaction f runs right away and its error is
+// reported as the command's error.
+func (c *Context) OnCommit(f func() error) {
+	if tx := c.shell.currentTransaction(); tx != nil {
+		tx.Lock()
+		tx.staged = append(tx.staged, f)
+		tx.Unlock()
+		return
+	}
+	if err := f(); err != nil {
+		c.Err(err)
+	}
+}
+
+// OnRollback registers f to undo the effects of the command if the
+// transaction in progress is rolled back. It returns false, and does not
+// register f, if there is no transaction.
+func (c *Context) OnRollback(f func() error) bool {
+	tx := c.shell.currentTransaction()
+	if tx == nil {
+		return false
+	}
+	tx.Lock()
+	tx.compensations = append(tx.compensations, f)
+	tx.Unlock()
+	return true
+}
+
 // ProgressBar returns the progress bar for the current shell context.
 func (c *Context) ProgressBar() ProgressBar {
 	return c.progressBar
 }
 
+// Writer returns an io.Writer that prints through the context's Actions,
+// e.g. for a tabwriter or the output of another library.
+func (c *Context) Writer() io.Writer {
+	return actionsWriter{c.Actions}
+}
+
+type actionsWriter struct {
+	Actions
+}
+
+func (w actionsWriter) Write(p []byte) (int, error) {
+	w.Print(string(p))
+	return len(p), nil
+}
+
 // contextValues is the map for values in the context.
 type contextValues map[string]interface{}
 
@@ -0,0 +1,57 @@
+package ishell
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// CrashReport describes a command that panicked.
+type CrashReport struct {
+	// Time the panic was recovered.
+	Time time.Time
+	// Line is the input that triggered the panic, with the values of
+	// secret arguments redacted.
+	Line []string
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// String formats the report for logs or bug reports.
+func (r *CrashReport) String() string {
+	return fmt.Sprintf("%s: panic: %v\ninput: %s\n\n%s",
+		r.Time.Format(time.RFC3339), r.Value, strings.Join(r.Line, " "), r.Stack)
+}
+
+// SetCrashHandler sets a function that receives a report whenever a command
+// panics, e.g. to save it to a file. Panics are recovered either way: the
+// command fails with a short error and the shell keeps running.
+func (s *Shell) SetCrashHandler(f func(r *CrashReport)) {
+	s.crashHandler = f
+}
+
+// call runs f with c, recovering a panic into an error and a crash report
+// of line.
+func (s *Shell) call(f func(*Context), c *Context, line []string) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		report := &CrashReport{
+			Time:  time.Now(),
+			Line:  append([]string(nil), s.redactSecrets(line)...),
+			Value: v,
+			Stack: debug.Stack(),
+		}
+		if s.crashHandler != nil {
+			s.crashHandler(report)
+		}
+		err = fmt.Errorf("command crashed: %v", v)
+	}()
+	f(c)
+	return c.err
+}
@@ -0,0 +1,184 @@
+package ishell
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// AddDebugCmd adds the "debug" command group for diagnosing the program
+// embedding the shell: pprof profiles, goroutine dumps, garbage collector
+// and shell statistics.
+func (s *Shell) AddDebugCmd() {
+	cmd := &Cmd{
+		Name: "debug",
+		Help: "diagnose the running program",
+	}
+	pprofCmd := &Cmd{
+		Name:     "pprof",
+		Help:     "write a pprof profile to a file",
+		LongHelp: "usage: debug pprof <profile> <file> [seconds]\n\nprofile is cpu or one of the runtime profiles (heap, allocs, goroutine,\nthreadcreate, block, mutex). The cpu profile runs in the background\nfor seconds (default 30).",
+		Func: func(c *Context) {
+			if err := s.checkRestricted(RestrictFiles); err != nil {
+				c.Err(err)
+				return
+			}
+			debugPprofFunc(s, c)
+		},
+	}
+	profileArg, _ := NewCmdArg("", "profile", StringType, false, true)
+	fileArg, _ := NewCmdArg("", "file", StringType, false, true)
+	secondsArg, _ := NewCmdArg("", "seconds", IntType, false, false)
+	pprofCmd.AddCmdArg(profileArg)
+	pprofCmd.AddCmdArg(fileArg)
+	pprofCmd.AddCmdArg(secondsArg)
+	cmd.AddCmd(pprofCmd)
+	cmd.AddCmd(&Cmd{
+		Name: "goroutines",
+		Help: "dump the stacks of all goroutines",
+		Func: func(c *Context) {
+			c.Err(pprof.Lookup("goroutine").WriteTo(c.Writer(), 2))
+		},
+	})
+	cmd.AddCmd(&Cmd{
+		Name: "gc",
+		Help: "show garbage collector and memory statistics",
+		Func: debugGCFunc,
+	})
+	cmd.AddCmd(&Cmd{
+		Name: "stats",
+		Help: "show shell statistics",
+		Func: func(c *Context) {
+			debugStatsFunc(s, c)
+		},
+	})
+	s.AddCmd(cmd)
+}
+
+func debugPprofFunc(s *Shell, c *Context) {
+	var name, path, secondsValue string
+	for _, arg := range c.ParsedArgs {
+		switch arg.Key {
+		case "profile":
+			name = arg.Value
+		case "file":
+			path = arg.Value
+		case "seconds":
+			secondsValue = arg.Value
+		}
+	}
+	if name != "cpu" && pprof.Lookup(name) == nil {
+		c.Err(fmt.Errorf("unknown profile %s", name))
+		return
+	}
+	seconds := 30
+	if secondsValue != "" {
+		var err error
+		seconds, err = strconv.Atoi(secondsValue)
+		if err != nil || seconds <= 0 {
+			c.Err(fmt.Errorf("invalid seconds %s", secondsValue))
+			return
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		c.Err(err)
+		return
+	}
+
+	if name != "cpu" {
+		err := pprof.Lookup(name).WriteTo(f, 0)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		c.Err(err)
+		return
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		c.Err(err)
+		return
+	}
+	// the profile runs in the background, not to block the shell.
+	c.Printf("profiling cpu for %ds\n", seconds)
+	go func() {
+		time.Sleep(time.Duration(seconds) * time.Second)
+		pprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			fmt.Fprintln(s.backgroundWriter(), styled(s.Theme().Error, "Error: "+err.Error()))
+			return
+		}
+		fmt.Fprintln(s.backgroundWriter(), "profile written to", path)
+	}()
+}
+
+func debugGCFunc(c *Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+
+	w := tabwriter.NewWriter(c.Writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "goroutines\t%d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "heap alloc\t%d\n", mem.HeapAlloc)
+	fmt.Fprintf(w, "heap sys\t%d\n", mem.HeapSys)
+	fmt.Fprintf(w, "heap objects\t%d\n", mem.HeapObjects)
+	fmt.Fprintf(w, "total alloc\t%d\n", mem.TotalAlloc)
+	fmt.Fprintf(w, "num gc\t%d\n", gc.NumGC)
+	fmt.Fprintf(w, "last gc\t%s\n", gc.LastGC.Format(time.RFC3339))
+	fmt.Fprintf(w, "pause total\t%s\n", gc.PauseTotal)
+	if len(gc.Pause) > 0 {
+		fmt.Fprintf(w, "last pause\t%s\n", gc.Pause[0])
+	}
+	c.Err(w.Flush())
+}
+
+func debugStatsFunc(s *Shell, c *Context) {
+	hits := atomic.LoadInt64(&s.completionStats.hits)
+	misses := atomic.LoadInt64(&s.completionStats.misses)
+	rate := 0.0
+	if hits+misses > 0 {
+		rate = float64(hits) / float64(hits+misses) * 100
+	}
+	commands := 0
+	s.Walk(func(path []string, cmd *Cmd) error {
+		commands++
+		return nil
+	})
+
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+
+	config := s.reader.getConfig()
+	w := tabwriter.NewWriter(c.Writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "active\t%t\n", s.Active())
+	fmt.Fprintf(w, "sessions\t%d\n", atomic.LoadInt64(&s.sessions))
+	fmt.Fprintf(w, "commands\t%d\n", commands)
+	fmt.Fprintf(w, "history file\t%s\n", config.HistoryFile)
+	fmt.Fprintf(w, "history size\t%d\n", historySize(config.HistoryFile))
+	fmt.Fprintf(w, "history limit\t%d\n", config.HistoryLimit)
+	fmt.Fprintf(w, "completions\t%d\n", hits+misses)
+	fmt.Fprintf(w, "completion cache hit rate\t%.1f%%\n", rate)
+	fmt.Fprintf(w, "num gc\t%d\n", gc.NumGC)
+	fmt.Fprintf(w, "gc pause total\t%s\n", gc.PauseTotal)
+	c.Err(w.Flush())
+}
+
+// historySize returns the number of entries in the history file.
+func historySize(path string) int {
+	if path == "" {
+		return 0
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(b, []byte("\n"))
+}
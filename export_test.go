@@ -0,0 +1,48 @@
+package ishell
+
+// Complete returns the words the shell's completer offers for line with the
+// cursor at its end.
+func (s *Shell) Complete(line string) []string {
+	if !s.customCompleter {
+		s.initCompleters()
+	}
+	runes := []rune(line)
+	suffixes, n := s.reader.getConfig().AutoComplete.Do(runes, len(runes))
+	words := make([]string, len(suffixes))
+	for i, suffix := range suffixes {
+		words[i] = string(runes[len(runes)-n:]) + string(suffix)
+	}
+	return words
+}
+
+// HistoryPath returns the history file of the shell.
+func (s *Shell) HistoryPath() string {
+	return s.reader.getConfig().HistoryFile
+}
+
+// Prompt returns the prompt shown for the next input.
+func (s *Shell) Prompt() string {
+	return s.reader.rlPrompt()
+}
+
+// AddHistory adds input to the history as if it was typed.
+func (s *Shell) AddHistory(input string) error {
+	line, err := SplitArgs(input)
+	if err != nil {
+		return err
+	}
+	s.inputLine = input
+	s.addHistory(line)
+	return nil
+}
+
+// PrefixIndex exposes prefixIndex.
+type PrefixIndex = prefixIndex
+
+func NewPrefixIndex(words []string) PrefixIndex {
+	return newPrefixIndex(words)
+}
+
+func (p prefixIndex) WithPrefix(prefix string) []string {
+	return p.withPrefix(prefix)
+}
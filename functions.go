@@ -1,14 +1,16 @@
 package ishell
 
-import (
-	"os"
-)
+import "os"
 
 func exitFunc(c *Context) {
 	c.Stop()
 }
 
-func helpFunc(c *Context) {
+func helpFunc(s *Shell, c *Context) {
+	if tag := c.ParsedArgs.GetString("--tag"); tag != "" {
+		s.helpTagFunc(c, tag)
+		return
+	}
 	c.Println(c.HelpText())
 }
 
@@ -25,11 +27,16 @@ func addDefaultFuncs(s *Shell) {
 		Help: "exit the program",
 		Func: exitFunc,
 	})
-	s.AddCmd(&Cmd{
+	help := &Cmd{
 		Name: "help",
 		Help: "display help",
-		Func: helpFunc,
-	})
+		Func: func(c *Context) {
+			helpFunc(s, c)
+		},
+	}
+	tag, _ := NewArg("--tag", StringType, WithShort("-t"), WithHelp("list the commands with this tag"))
+	help.AddCmdArg(tag)
+	s.AddCmd(help)
 	s.AddCmd(&Cmd{
 		Name: "clear",
 		Help: "clear the screen",
@@ -0,0 +1,68 @@
+package ishell
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// HelpData is the data a help template is executed with, see
+// Cmd.HelpTemplate and Shell.SetHelpTemplate, e.g.
+//
+//	{{.Cmd.Name}} - {{.Cmd.Help}}
+//	Usage: {{.Usage}}
+//	{{range .Args}}  {{.Name}}  {{.Help}}
+//	{{end}}{{range .Children}}  {{.Name}}  {{.Help}}
+//	{{end}}
+type HelpData struct {
+	// Cmd is the command help is shown for.
+	Cmd *Cmd
+	// Usage is the synopsis of the command, see Cmd.Usage.
+	Usage string
+	// Args are the arguments of the command that are not hidden.
+	Args []ArgSpec
+	// Children are the subcommands of the command, in help order.
+	Children []*Cmd
+	// Default is the help in the default layout, for templates that only
+	// add to it.
+	Default string
+}
+
+// SetHelpTemplate sets the template rendering the help of commands without
+// a HelpTemplate of their own, e.g. to brand or restructure it. A nil tmpl
+// restores the default layout.
+func (s *Shell) SetHelpTemplate(tmpl *template.Template) {
+	s.themeMutex.Lock()
+	defer s.themeMutex.Unlock()
+	s.helpTemplate = tmpl
+}
+
+// helpText returns the help of cmd rendered by the shell's template, if
+// cmd has no template of its own, or styled with the shell's theme.
+func (s *Shell) helpText(cmd *Cmd) string {
+	s.themeMutex.RLock()
+	tmpl := s.helpTemplate
+	s.themeMutex.RUnlock()
+	if tmpl != nil && cmd.HelpTemplate == nil {
+		return cmd.templateHelpText(tmpl, s.Theme())
+	}
+	return cmd.themedHelpText(s.Theme())
+}
+
+// templateHelpText returns the help of c rendered by tmpl, or the error of
+// executing it.
+func (c *Cmd) templateHelpText(tmpl *template.Template, t *Theme) string {
+	data := HelpData{
+		Cmd:      c,
+		Usage:    c.Usage(),
+		Children: c.Children(),
+		Default:  c.buildHelpText(t),
+	}
+	for _, arg := range c.visibleArgs() {
+		data.Args = append(data.Args, arg.spec())
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "help template: " + err.Error()
+	}
+	return b.String()
+}
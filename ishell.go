@@ -7,20 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/abiosoft/readline"
 	"github.com/fatih/color"
-	shlex "github.com/flynn-archive/go-shlex"
 )
 
 const (
@@ -28,8 +28,18 @@ const (
 	defaultMultiPrompt = "... "
 )
 
+// ErrUnknownCommand is the error of input that matches no command when no
+// generic handler is set.
+var ErrUnknownCommand = errors.New("incorrect input, try 'help'")
+
+// ErrCmdExists is the error of AddCmdE for a command name already in use.
+var ErrCmdExists = errors.New("command already exists")
+
+// ErrSubcommandRequired is the error of running a command with
+// RequireSubcommand set without a subcommand.
+var ErrSubcommandRequired = errors.New("subcommand required")
+
 var (
-	errNoHandler          = errors.New("incorrect input, try 'help'")
 	errNoInterruptHandler = errors.New("no interrupt handler")
 	strMultiChoice        = " ❯"
 	strMultiChoiceWin     = " >"
@@ -49,16 +59,52 @@ type Shell struct {
 	writer            io.Writer
 	active            bool
 	activeMutex       sync.RWMutex
-	ignoreCase        bool
 	customCompleter   bool
 	multiChoiceActive bool
 	haltChan          chan struct{}
 	historyFile       string
+	autoSaveHistory   bool
+	inputLine         string
 	autoHelp          bool
+	autoCorrect       bool
+	version           *string
+	helpTemplate      *template.Template
 	rawArgs           []string
 	progressBar       ProgressBar
 	pager             string
 	pagerArgs         []string
+	outBuf            *syncWriter
+	outWriter         io.Writer
+	captureLimit      int64
+	captureSpill      bool
+	inputLimit        *rateLimiter
+	outputLimit       *rateLimiter
+	commandSlots      chan struct{}
+	completionStats   completionStats
+	sessions          int64
+	inputPolicy       *InputPolicy
+	scheduler         *scheduler
+	plugins           pluginSet
+	tx                *transaction
+	txMutex           sync.Mutex
+	config            *ConfigStore
+	theme             *Theme
+	errorHandler      func(*Context, error)
+	crashHandler      func(*CrashReport)
+	middleware        []func(next func(*Context)) func(*Context)
+	deprecationsShown sync.Map
+	argDefaults       argDefaults
+	scopes            scopeStack
+	completionTags    tagFilter
+	tasks             taskList
+	themeMutex        sync.RWMutex
+	restriction       Restriction
+	authenticator     Authenticator
+	maxAuthAttempts   int
+	authFailures      int
+	user              string
+	userStore         UserStore
+	auditLog          *AuditLog
 	contextValues
 	Actions
 }
@@ -69,34 +115,47 @@ func New() *Shell {
 }
 
 // NewWithConfig creates a new shell with custom readline config.
+// The terminal is not touched until the shell first reads input.
 func NewWithConfig(conf *readline.Config) *Shell {
-	rl, err := readline.NewEx(conf)
-	if err != nil {
-		log.Println("Shell or operating system not supported.")
-		log.Fatal(err)
-	}
-
-	return NewWithReadline(rl)
+	return newShell(conf, nil)
 }
 
 // NewWithReadline creates a new shell with a custom readline instance.
 func NewWithReadline(rl *readline.Instance) *Shell {
+	return newShell(rl.Config, rl)
+}
+
+func newShell(conf *readline.Config, rl *readline.Instance) *Shell {
+	stdout := conf.Stdout
+	if stdout == nil {
+		stdout = readline.Stdout
+	}
+	// history is added once the input is split, see addHistory.
+	autoSaveHistory := !conf.DisableAutoSaveHistory
+	conf.DisableAutoSaveHistory = true
 	shell := &Shell{
 		rootCmd: &Cmd{},
 		reader: &shellReader{
 			scanner:     rl,
-			prompt:      rl.Config.Prompt,
+			config:      conf,
+			prompt:      conf.Prompt,
 			multiPrompt: defaultMultiPrompt,
 			showPrompt:  true,
-			buf:         &bytes.Buffer{},
+			buf:         &printBuffer{},
 			completer:   readline.NewPrefixCompleter(),
 		},
-		writer:   rl.Config.Stdout,
-		autoHelp: true,
+		writer:          stdout,
+		outWriter:       stdout,
+		autoHelp:        true,
+		theme:           DefaultTheme,
+		autoSaveHistory: autoSaveHistory,
 	}
 	shell.Actions = &shellActionsImpl{Shell: shell}
+	shell.config = newConfigStore(shell)
+	shell.scheduler = &scheduler{shell: shell, jobs: make(map[int]*scheduledJob)}
 	shell.progressBar = newProgressBar(shell)
 	addDefaultFuncs(shell)
+	registerShellConfig(shell)
 	return shell
 }
 
@@ -148,7 +207,14 @@ func (s *Shell) stop() {
 // Unlike `Stop`, a closed shell cannot be restarted.
 func (s *Shell) Close() {
 	s.stop()
-	s.reader.scanner.Close()
+	if err := s.saveUser(); err != nil {
+		s.printError(err)
+	}
+	if err := s.auditLog.Close(); err != nil {
+		s.printError(err)
+	}
+	s.flush()
+	s.reader.close()
 }
 
 func (s *Shell) prepareRun() {
@@ -161,15 +227,24 @@ func (s *Shell) prepareRun() {
 	s.activeMutex.Lock()
 	s.active = true
 	s.activeMutex.Unlock()
+	atomic.AddInt64(&s.sessions, 1)
 
 	s.haltChan = make(chan struct{})
 }
 
 func (s *Shell) run() {
+	if s.checkAuthenticated() != nil {
+		if err := s.Authenticate(); err != nil {
+			s.printError(err)
+			s.stop()
+			return
+		}
+	}
 shell:
 	for s.Active() {
 		var line []string
 		var err error
+		refreshProviders()
 		read := make(chan struct{})
 		go func() {
 			line, err = s.read()
@@ -188,11 +263,11 @@ shell:
 				break
 			}
 			if err := handleEOF(s); err != nil {
-				s.Println("Error:", err)
+				s.printError(err)
 				continue
 			}
 		} else if err != nil && err != readline.ErrInterrupt {
-			s.Println("Error:", err)
+			s.printError(err)
 			continue
 		}
 
@@ -208,11 +283,20 @@ shell:
 				// no input line
 				continue
 			}
+			s.addHistory(line)
+			var ok bool
+			if line, ok = s.scopeInput(line); !ok || s.enterSubshell(line) {
+				continue
+			}
+			s.inputLimit.wait(1)
 
-			err = handleInput(s, line)
+			if err := handleInputLine(s, s.Actions, line, s.inputLine); err != nil {
+				s.reportError(s.Actions, line, err)
+			}
+			continue
 		}
 		if err != nil {
-			s.Println("Error:", err)
+			s.printError(err)
 		}
 	}
 }
@@ -226,22 +310,83 @@ func (s *Shell) Active() bool {
 
 // Process runs shell using args in a non-interactive mode.
 func (s *Shell) Process(args ...string) error {
+	defer s.flush()
+	refreshProviders()
 	return handleInput(s, args)
 }
 
 func handleInput(s *Shell, line []string) error {
-	handled, err := s.handleCommand(line)
+	return handleInputWith(s, s.Actions, line)
+}
+
+// handleInputWith is handleInput with the commands performing actions
+// through actions instead of the shell's own.
+func handleInputWith(s *Shell, actions Actions, line []string) error {
+	return handleInputLine(s, actions, line, joinArgs(line))
+}
+
+// handleInputLine is handleInputWith for line split from input as typed.
+func handleInputLine(s *Shell, actions Actions, line []string, input string) error {
+	if err := s.checkAuthenticated(); err != nil {
+		return err
+	}
+	line, err := s.inputPolicy.apply(line)
+	if err != nil {
+		return err
+	}
+	if s.inputPolicy != nil {
+		input = s.inputPolicy.sanitize(input)
+	}
+
+	err = dispatchInput(s, actions, line, input)
+	if auditErr := s.auditLog.Record(s.user, s.redactSecrets(line), err); auditErr != nil {
+		s.printError(fmt.Errorf("audit log: %v", auditErr))
+	}
+	return err
+}
+
+// dispatchInput runs the command matching line, or the generic handler
+// with input.
+func dispatchInput(s *Shell, actions Actions, line []string, input string) error {
+	if s.version != nil && len(line) == 1 && line[0] == "--version" {
+		actions.Print(versionText(*s.version))
+		return nil
+	}
+	handled, err := s.handleCommand(actions, line)
 	if handled || err != nil {
 		return err
 	}
 
 	// Generic handler
 	if s.generic == nil {
-		return errNoHandler
+		return s.unknownCommand(actions, line)
 	}
 	c := newContext(s, nil, line, nil)
-	s.generic(c)
-	return c.err
+	c.Actions = actions
+	c.line = input
+	return s.call(s.wrap(s.generic), c, line)
+}
+
+// unknownCommand handles line not starting with a command name. It runs
+// the single command with a similar name if AutoCorrect is on, otherwise it
+// fails with ErrUnknownCommand, as an *ErrCmdNotFound when there are
+// similar names to suggest.
+func (s *Shell) unknownCommand(actions Actions, line []string) error {
+	if len(line) == 0 {
+		return ErrUnknownCommand
+	}
+	suggestions := s.rootCmd.suggest(line[0])
+	if s.autoCorrect && len(suggestions) == 1 {
+		actions.Printf("Running '%s'\n", suggestions[0])
+		corrected := append([]string{suggestions[0]}, line[1:]...)
+		if handled, err := s.handleCommand(actions, corrected); handled || err != nil {
+			return err
+		}
+	}
+	if len(suggestions) == 0 {
+		return ErrUnknownCommand
+	}
+	return &ErrCmdNotFound{Name: line[0], Suggestions: suggestions}
 }
 
 func handleInterrupt(s *Shell, line []string) error {
@@ -260,33 +405,141 @@ func handleEOF(s *Shell) error {
 	return c.err
 }
 
-func (s *Shell) handleCommand(str []string) (bool, error) {
-	if s.ignoreCase {
-		for i := range str {
-			str[i] = strings.ToLower(str[i])
+// usageError is a parse error shown along with the usage of the command.
+type usageError struct {
+	err   error
+	usage string
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error() + "\nUsage: " + e.usage
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// redactSecrets returns line with the values of secret arguments replaced.
+func (s *Shell) redactSecrets(line []string) []string {
+	cmd, args := s.rootCmd.FindCmd(line)
+	if cmd == nil || cmd.rawArgs || len(args) == 0 {
+		return line
+	}
+	n := len(line) - len(args)
+	parser := cmd.inherit(s.rootCmd.ancestors(line[:n]))
+	return append(line[:n:n], parser.redact_secrets(args)...)
+}
+
+// addHistory adds the input just read, split into line, to the history.
+// If line has secret values, the line is added with them redacted.
+func (s *Shell) addHistory(line []string) {
+	if !s.autoSaveHistory {
+		return
+	}
+	scoped := s.inScope(line)
+	redacted := s.redactSecrets(scoped)[len(scoped)-len(line):]
+	scanner := s.reader.instance()
+	for i := range line {
+		if redacted[i] != line[i] {
+			scanner.SaveHistory(joinArgs(redacted))
+			return
 		}
 	}
+	for _, input := range strings.Split(s.inputLine, "\n") {
+		scanner.SaveHistory(input)
+	}
+}
+
+func (s *Shell) handleCommand(actions Actions, str []string) (bool, error) {
 	cmd, args := s.rootCmd.FindCmd(str)
 	if cmd == nil {
 		return false, nil
 	}
 	// trigger help if func is not registered or auto help is true
-	if cmd.Func == nil || (s.autoHelp && len(args) == 1 && args[0] == "help") {
-		s.Println(cmd.HelpText())
+	help := s.autoHelp && len(args) == 1 && args[0] == "help"
+	// cmd with the persistent flags of its parents, for parsing and help
+	parser := cmd.inherit(s.rootCmd.ancestors(str[:len(str)-len(args)]))
+	if !help {
+		for _, c := range append(s.rootCmd.ancestors(str[:len(str)-len(args)]), cmd) {
+			if disabled, reason := c.Disabled(); disabled {
+				return true, &ErrCmdDisabled{Name: c.Name, Reason: reason}
+			}
+		}
+	}
+	if !help && cmd.catches(args) {
+		c := newContext(s, cmd, args, nil)
+		c.Actions = actions
+		return true, s.call(s.wrap(cmd.NotFoundFunc), c, str)
+	}
+	if cmd.Version != "" && len(args) == 1 && args[0] == "--version" {
+		actions.Println(cmd.Name, "version", cmd.Version)
+		return true, nil
+	}
+	if cmd.RequireSubcommand && !help {
+		actions.Println(s.helpText(parser))
+		if len(args) > 0 && !is_short_arg(args[0]) {
+			return true, &ErrCmdNotFound{Name: args[0], Path: str[:len(str)-len(args)], Suggestions: cmd.suggest(args[0])}
+		}
+		return true, fmt.Errorf("Command '%s': %w", cmd.Name, ErrSubcommandRequired)
+	}
+	if (cmd.Func == nil && cmd.ErrFunc == nil) || help {
+		actions.Println(s.helpText(parser))
 		return true, nil
 	}
 
-	parsed, err := cmd.ParseArgs(args)
-	if err != nil {
-		return false, err
+	var parsed ParsedArgs
+	if !cmd.rawArgs {
+		var err error
+		var prompt func(arg *CmdArg) (string, error)
+		if s.Active() {
+			prompt = func(arg *CmdArg) (string, error) {
+				actions.Print(strings.TrimLeft(arg.longFlag, "-") + ": ")
+				return actions.ReadPasswordErr()
+			}
+		}
+		if parsed, err = parser.parseArgs(args, parseOptions{defaults: s.argDefaultsFor(str, args), prompt: prompt}); err != nil {
+			return false, &usageError{err: err, usage: parser.Usage()}
+		}
+		for _, warning := range parser.deprecation_warnings(parsed) {
+			warnln(actions, warning)
+		}
+	}
+
+	if cmd.Deprecated {
+		if _, warned := s.deprecationsShown.LoadOrStore(cmd, true); !warned {
+			warnln(actions, cmd.deprecation())
+		}
 	}
 
 	c := newContext(s, cmd, args, parsed)
-	cmd.Func(c)
-	return true, c.err
+	c.Actions = actions
+	if cmd.Async {
+		t := s.startTask(s.wrap(cmd.run), c, str, cmd.Timeout)
+		actions.Printf("[%d] started\n", t.ID)
+		return true, nil
+	}
+	if cmd.Timeout > 0 {
+		return true, s.callWithTimeout(s.wrap(cmd.run), c, str, cmd.Timeout)
+	}
+	return true, s.call(s.wrap(cmd.run), c, str)
+}
+
+// Flush writes out output buffered by BufferOutput. It is a no-op when
+// output is not buffered.
+func (s *Shell) Flush() error {
+	return s.flush()
+}
+
+// flush writes out buffered output, see BufferOutput.
+func (s *Shell) flush() error {
+	if s.outBuf == nil {
+		return nil
+	}
+	return s.outBuf.Flush()
 }
 
 func (s *Shell) readLine() (line string, err error) {
+	s.flush()
 	consumer := make(chan lineString)
 	defer close(consumer)
 	go s.reader.readLine(consumer)
@@ -314,11 +567,12 @@ func (s *Shell) read() ([]string, error) {
 		return strings.HasSuffix(strings.TrimSpace(line), "\\")
 	})
 
+	s.inputLine = lines
 	s.rawArgs = strings.Fields(lines)
 
 	if heredoc {
 		s := strings.SplitN(lines, "<<", 2)
-		args, err1 := shlex.Split(s[0])
+		args, err1 := SplitArgs(s[0])
 
 		arg := strings.TrimSuffix(strings.SplitN(s[1], "\n", 2)[1], eof)
 		args = append(args, arg)
@@ -330,7 +584,7 @@ func (s *Shell) read() ([]string, error) {
 
 	lines = strings.Replace(lines, "\\\n", " \n", -1)
 
-	args, err1 := shlex.Split(lines)
+	args, err1 := SplitArgs(lines)
 	if err1 != nil {
 		return args, err1
 	}
@@ -365,13 +619,19 @@ func (s *Shell) readMultiLinesFunc(f func(string) bool) (string, error) {
 }
 
 func (s *Shell) initCompleters() {
-	s.setCompleter(iCompleter{cmd: s.rootCmd, disabled: func() bool { return s.multiChoiceActive }})
+	s.setCompleter(iCompleter{
+		cmd:      s.rootCmd,
+		disabled: func() bool { return s.multiChoiceActive },
+		scope:    s.inScope,
+		tags:     s.getCompletionTags,
+		stats:    &s.completionStats,
+	})
 }
 
 func (s *Shell) setCompleter(completer readline.AutoCompleter) {
-	config := s.reader.scanner.Config.Clone()
+	config := s.reader.getConfig().Clone()
 	config.AutoComplete = completer
-	s.reader.scanner.SetConfig(config)
+	s.reader.setConfig(config)
 }
 
 // CustomCompleter allows use of custom implementation of readline.Autocompleter.
@@ -381,14 +641,56 @@ func (s *Shell) CustomCompleter(completer readline.AutoCompleter) {
 }
 
 // AddCmd adds a new command handler.
-// This only adds top level commands.
+// This only adds top level commands. Commands can be added and deleted
+// while the shell runs, e.g. from another command or a goroutine.
 func (s *Shell) AddCmd(cmd *Cmd) {
 	s.rootCmd.AddCmd(cmd)
 }
 
-// DeleteCmd deletes a top level command.
-func (s *Shell) DeleteCmd(name string) {
-	s.rootCmd.DeleteCmd(name)
+// AddCmdE adds a top level command, failing with ErrCmdExists if there is
+// one with the same name. See Cmd.AddCmdE.
+func (s *Shell) AddCmdE(cmd *Cmd) error {
+	return s.rootCmd.AddCmdE(cmd)
+}
+
+// ReplaceCmd adds a top level command in place of the one with the same
+// name, if any, and returns that one or nil.
+func (s *Shell) ReplaceCmd(cmd *Cmd) *Cmd {
+	return s.rootCmd.ReplaceCmd(cmd)
+}
+
+// Walk calls f for every command of the shell, depth first, with the words
+// that run it as path. See Cmd.Walk.
+func (s *Shell) Walk(f func(path []string, c *Cmd) error) error {
+	return s.rootCmd.Walk(func(path []string, c *Cmd) error {
+		if len(path) == 0 {
+			return nil
+		}
+		return f(path, c)
+	})
+}
+
+// AddCmdProvider adds a function returning top level commands. This way
+// commands can be discovered at prompt time, e.g. from the schema of a
+// remote API. The shell calls provider when it first needs the commands
+// after each prompt, Process or RefreshCmds, and keeps them until then, so
+// a lookup, completion or help sees the same commands throughout. The
+// providers of a command are not called concurrently. Commands added with
+// AddCmd take precedence.
+func (s *Shell) AddCmdProvider(provider func() []*Cmd) {
+	s.rootCmd.AddCmdProvider(provider)
+}
+
+// RefreshCmds has the command providers called again when their commands
+// are next needed, see AddCmdProvider.
+func (s *Shell) RefreshCmds() {
+	refreshProviders()
+}
+
+// DeleteCmd deletes the command named by path, e.g. DeleteCmd("vm") or
+// DeleteCmd("net", "ping"), and tells if there was one. See Cmd.DeleteCmd.
+func (s *Shell) DeleteCmd(path ...string) bool {
+	return s.rootCmd.DeleteCmd(path...)
 }
 
 // NotFound adds a generic function for all inputs.
@@ -398,6 +700,17 @@ func (s *Shell) NotFound(f func(*Context)) {
 	s.generic = f
 }
 
+// NotFoundLine is NotFound with the input line as typed, keeping its
+// quoting and spacing, e.g. to evaluate expressions or forward lines to a
+// remote device. For Process, it is the args joined and quoted as needed.
+// The words are in Context.Args. It is a function of its own so that
+// NotFound keeps taking func(*Context).
+func (s *Shell) NotFoundLine(f func(c *Context, line string)) {
+	s.NotFound(func(c *Context) {
+		f(c, c.line)
+	})
+}
+
 // AutoHelp sets if ishell should trigger help message if
 // a command's arg is "help". Defaults to true.
 //
@@ -407,6 +720,15 @@ func (s *Shell) AutoHelp(enable bool) {
 	s.autoHelp = enable
 }
 
+// AutoCorrect sets if ishell should run the command with the closest name
+// when the input starts with an unknown one, if there is only one such
+// command, e.g. "stauts" for "status". Defaults to false, failing with a
+// "did you mean" error instead. It has no effect when a generic handler is
+// set with NotFound.
+func (s *Shell) AutoCorrect(enable bool) {
+	s.autoCorrect = enable
+}
+
 // Interrupt adds a function to handle keyboard interrupt (Ctrl-c).
 // count is the number of consecutive times that Ctrl-c has been pressed.
 // i.e. any input apart from Ctrl-c resets count to 0.
@@ -414,6 +736,55 @@ func (s *Shell) Interrupt(f func(c *Context, count int, input string)) {
 	s.interrupt = f
 }
 
+// SetErrorHandler sets a function to present the errors of commands:
+// parse errors, unknown commands (errors.Is ErrUnknownCommand) and errors
+// set with Context.Err. c is the context of the failed command; for
+// unknown commands its Cmd is empty and Args holds the whole input. This
+// overrides the default one line message. Errors of Process are returned
+// to the caller instead.
+func (s *Shell) SetErrorHandler(f func(c *Context, err error)) {
+	s.errorHandler = f
+}
+
+// Use adds middleware that wraps every command run by the shell, including
+// the generic handler, e.g. for timing, logging or permission checks. The
+// middleware calls next to run the command, or skips it. Middleware added
+// first is outermost.
+//
+//	shell.Use(func(next func(*ishell.Context)) func(*ishell.Context) {
+//		return func(c *ishell.Context) {
+//			start := time.Now()
+//			next(c)
+//			log.Println(c.Cmd.Name, time.Since(start))
+//		}
+//	})
+func (s *Shell) Use(middleware func(next func(*Context)) func(*Context)) {
+	s.middleware = append(s.middleware, middleware)
+}
+
+// wrap returns f wrapped in the middleware of the shell.
+func (s *Shell) wrap(f func(*Context)) func(*Context) {
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		f = s.middleware[i](f)
+	}
+	return f
+}
+
+// reportError presents err of the command line through actions.
+func (s *Shell) reportError(actions Actions, line []string, err error) {
+	if s.errorHandler == nil {
+		errorln(actions, err)
+		return
+	}
+	cmd, args := s.rootCmd.FindCmd(line)
+	if cmd == nil {
+		args = line
+	}
+	c := newContext(s, cmd, args, nil)
+	c.Actions = actions
+	s.errorHandler(c, err)
+}
+
 // EOF adds a function to handle End of File input (Ctrl-d).
 // This overrides the default behaviour which terminates the shell.
 func (s *Shell) EOF(f func(c *Context)) {
@@ -422,13 +793,17 @@ func (s *Shell) EOF(f func(c *Context)) {
 
 // SetHistoryPath sets where readlines history file location. Use an empty
 // string to disable history file. It is empty by default.
+// If the shell is restricted with RestrictFiles, it prints ErrRestricted
+// and the history path is left unchanged.
 func (s *Shell) SetHistoryPath(path string) {
+	if err := s.checkRestricted(RestrictFiles); err != nil {
+		s.printError(err)
+		return
+	}
 	// Using scanner.SetHistoryPath doesn't initialize things properly and
 	// history file is never written. Simpler to just create a new readline
 	// Instance.
-	config := s.reader.scanner.Config.Clone()
-	config.HistoryFile = path
-	s.reader.scanner, _ = readline.NewEx(config)
+	s.reader.setHistoryPath(path)
 }
 
 // SetHomeHistoryPath is a convenience method that sets the history path
@@ -455,9 +830,66 @@ func (s *Shell) SetHomeHistoryPath(path string) {
 
 // SetOut sets the writer to write outputs to.
 func (s *Shell) SetOut(writer io.Writer) {
+	s.outWriter = writer
+	s.updateWriter()
+}
+
+// BufferOutput buffers up to size bytes of output before writing it out,
+// which saves a write per print for commands printing many lines, e.g. over
+// slow connections. The buffer is flushed before the prompt is shown, around
+// the pager and when a command calls Flush. A size of 0 or less disables
+// buffering. Buffering is disabled by default.
+func (s *Shell) BufferOutput(size int) {
+	s.flush()
+	s.outBuf = nil
+	if size > 0 {
+		s.outBuf = &syncWriter{buf: bufio.NewWriterSize(s.outWriter, size)}
+	}
+	s.updateWriter()
+}
+
+// updateWriter sets the writer used for output, layering the output rate
+// limit and buffer on top of the writer set with SetOut.
+func (s *Shell) updateWriter() {
+	writer := s.outWriter
+	if s.outputLimit != nil {
+		writer = &throttledWriter{writer: writer, limiter: s.outputLimit}
+	}
+	if s.outBuf != nil {
+		s.outBuf.Reset(writer)
+		writer = s.outBuf
+	}
 	s.writer = writer
 }
 
+// syncWriter is a bufio.Writer that is safe for concurrent use, as output
+// of commands running in the background is written along with the output
+// of the command in the foreground.
+type syncWriter struct {
+	buf *bufio.Writer
+	mu  sync.Mutex
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *syncWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Flush()
+}
+
+// Reset flushes the buffered output and writes to writer from then on.
+func (w *syncWriter) Reset(writer io.Writer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Flush()
+	w.buf.Reset(writer)
+}
+
 // SetPager sets the pager and its arguments for paged output
 func (s *Shell) SetPager(pager string, args []string) {
 	s.pager = pager
@@ -493,7 +925,7 @@ func (s *Shell) multiChoice(options []string, text string, init []int, multiResu
 	s.multiChoiceActive = true
 	defer func() { s.multiChoiceActive = false }()
 
-	conf := s.reader.scanner.Config.Clone()
+	conf := s.reader.instance().Config.Clone()
 
 	conf.DisableAutoSaveHistory = true
 
@@ -540,7 +972,7 @@ func (s *Shell) multiChoice(options []string, text string, init []int, multiResu
 	offset := fd
 
 	update := func() {
-		strs := buildOptionsStrings(options, selected, cur)
+		strs := buildOptionsStrings(options, selected, cur, s.Theme().Selection)
 		if len(strs) > maxRows-1 {
 			strs = strs[offset : maxRows+offset-1]
 		}
@@ -549,6 +981,7 @@ func (s *Shell) multiChoice(options []string, text string, init []int, multiResu
 		s.Print("\033[0J")
 		s.Println(text)
 		s.Print(strings.Join(strs, "\n"))
+		s.flush()
 	}
 	var lastKey rune
 	refresh := make(chan struct{}, 1)
@@ -585,7 +1018,7 @@ func (s *Shell) multiChoice(options []string, text string, init []int, multiResu
 		return
 	}
 	conf.Listener = readline.FuncListener(listener)
-	oldconf := s.reader.scanner.SetConfig(conf)
+	oldconf := s.reader.setConfig(conf)
 
 	stop := make(chan struct{})
 	defer func() {
@@ -612,7 +1045,7 @@ func (s *Shell) multiChoice(options []string, text string, init []int, multiResu
 	}()
 	s.ReadLine()
 
-	s.reader.scanner.SetConfig(oldconf)
+	s.reader.setConfig(oldconf)
 
 	// only handles Ctrl-c for now
 	// this can be broaden later
@@ -627,7 +1060,7 @@ func (s *Shell) multiChoice(options []string, text string, init []int, multiResu
 	return []int{cur}
 }
 
-func buildOptionsStrings(options []string, selected []int, index int) []string {
+func buildOptionsStrings(options []string, selected []int, index int, highlight *color.Color) []string {
 	var strs []string
 	symbol := strMultiChoice
 	if runtime.GOOS == "windows" {
@@ -644,8 +1077,7 @@ func buildOptionsStrings(options []string, selected []int, index int) []string {
 			}
 		}
 		if i == index {
-			cyan := color.New(color.FgCyan).Add(color.Bold).SprintFunc()
-			strs = append(strs, cyan(symbol+mark+opt))
+			strs = append(strs, styled(highlight, symbol+mark+opt))
 		} else {
 			strs = append(strs, strings.Repeat(" ", utf8.RuneCountInString(symbol))+mark+opt)
 		}
@@ -655,9 +1087,18 @@ func buildOptionsStrings(options []string, selected []int, index int) []string {
 
 // IgnoreCase specifies whether commands should not be case sensitive.
 // Defaults to false i.e. commands are case sensitive.
-// If true, commands must be registered in lower cases.
+// If true, "STATUS" and "Status" run the "status" command, at any level,
+// while arguments are passed as typed. See Cmd.IgnoreCase.
 func (s *Shell) IgnoreCase(ignore bool) {
-	s.ignoreCase = ignore
+	s.rootCmd.IgnoreCase = ignore
+}
+
+// SetNamespaceSeparator lets a single word name nested commands joined by
+// sep, so "net.ping 8.8.8.8" runs "net ping 8.8.8.8" with ".". Completion
+// completes such words too. An empty sep, the default, turns it off. See
+// Cmd.NamespaceSeparator.
+func (s *Shell) SetNamespaceSeparator(sep string) {
+	s.rootCmd.NamespaceSeparator = sep
 }
 
 // ProgressBar returns the progress bar for the shell.
@@ -665,18 +1106,20 @@ func (s *Shell) ProgressBar() ProgressBar {
 	return s.progressBar
 }
 
-func newContext(s *Shell, cmd *Cmd, args []string, parsed_args []ParsedArg) *Context {
+func newContext(s *Shell, cmd *Cmd, args []string, parsed_args ParsedArgs) *Context {
 	if cmd == nil {
 		cmd = &Cmd{}
 	}
 
 	ret := Context{
 		Actions:     s.Actions,
+		shell:       s,
 		progressBar: copyShellProgressBar(s),
 		Args:        args,
 		RawArgs:     s.rawArgs,
+		User:        s.user,
 		ParsedArgs: parsed_args,
-		Cmd:         *cmd,
+		Cmd:         cmd.snapshot(),
 		contextValues: func() contextValues {
 			values := contextValues{}
 			for k := range s.contextValues {
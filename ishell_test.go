@@ -0,0 +1,1500 @@
+package ishell_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/abiosoft/readline"
+	"github.com/fatih/color"
+	"github.com/ryupatterson/ishell"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestShell() (*ishell.Shell, *bytes.Buffer) {
+	var out bytes.Buffer
+	shell := ishell.New()
+	shell.SetOut(&out)
+	return shell, &out
+}
+
+// lockedBuffer is a bytes.Buffer safe for output of background commands.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newEchoCmd(name string) *ishell.Cmd {
+	cmd := &ishell.Cmd{
+		Name: name,
+		Func: func(c *ishell.Context) {
+			for _, arg := range c.ParsedArgs {
+				c.Println(name, arg.Value)
+			}
+		},
+	}
+	arg, _ := ishell.NewCmdArg("", "words", ishell.StringType, true, false)
+	cmd.AddCmdArg(arg)
+	return cmd
+}
+
+func TestProcess(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("hello"))
+	assert.NoError(t, shell.Process("hello", "world"))
+	assert.Equal(t, "hello world\n", out.String())
+	assert.Error(t, shell.Process("unknown"))
+}
+
+func TestProcessBatch(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	results := shell.ProcessBatch(3,
+		[]string{"echo", "1"},
+		[]string{"echo", "2"},
+		[]string{"unknown"},
+		[]string{"echo", "3"},
+	)
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, "echo 2\n", results[1].Output)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, "echo 1\necho 2\nError: incorrect input, try 'help'\necho 3\n", out.String())
+
+	// buffered output is written out when the batch is done
+	out.Reset()
+	shell.BufferOutput(4096)
+	shell.ProcessBatch(2, []string{"echo", "4"}, []string{"echo", "5"})
+	assert.Equal(t, "echo 4\necho 5\n", out.String())
+}
+
+func TestProcessBatchWorkers(t *testing.T) {
+	shell, out := newTestShell()
+	var mu sync.Mutex
+	running, peak := 0, 0
+	sleep := &ishell.Cmd{
+		Name: "sleep",
+		Func: func(c *ishell.Context) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			// later lines finish first, the output stays in order
+			d, _ := time.ParseDuration(c.Args[0])
+			time.Sleep(d)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			c.Println("slept", c.Args[0])
+		},
+	}
+	arg, _ := ishell.NewArg("duration", ishell.StringType)
+	sleep.AddCmdArg(arg)
+	shell.AddCmd(sleep)
+	results := shell.ProcessBatch(2,
+		[]string{"sleep", "30ms"},
+		[]string{"sleep", "20ms"},
+		[]string{"sleep", "10ms"},
+		[]string{"sleep", "1ms"},
+	)
+	assert.Len(t, results, 4)
+	assert.Equal(t, 2, peak, "runs up to workers commands at once")
+	assert.Equal(t, "slept 30ms\nslept 20ms\nslept 10ms\nslept 1ms\n", out.String())
+	assert.Equal(t, []string{"sleep", "10ms"}, results[2].Args)
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := ishell.SplitArgs(`add --name "John Smith" my\ file 'it "is"' "a\"b\c"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"add", "--name", "John Smith", "my file", `it "is"`, `a"b\c`}, args)
+
+	args, err = ishell.SplitArgs(`tag a#b #prod "" x\`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tag", "a#b", "#prod", "", `x\`}, args)
+
+	_, err = ishell.SplitArgs(`add --name "John`)
+	assert.Equal(t, ishell.ErrUnclosedQuote, err)
+}
+
+func TestInputPolicy(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	shell.SetInputPolicy(&ishell.InputPolicy{})
+	assert.NoError(t, shell.Process("echo", "red\x1b[31m\x1b]0;title\a\x07text"))
+	assert.Equal(t, "echo redtext\n", out.String())
+
+	shell.SetInputPolicy(&ishell.InputPolicy{Reject: true})
+	assert.Equal(t, ishell.ErrControlCharacters, shell.Process("echo", "\x1b[2J"))
+	assert.NoError(t, shell.Process("echo", "plain"))
+}
+
+func TestAuthenticator(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(&ishell.Cmd{
+		Name: "whoami",
+		Func: func(c *ishell.Context) {
+			c.Println(c.User)
+		},
+	})
+	tokens := []string{"wrong", "right"}
+	shell.SetAuthenticator(func(c *ishell.Context) (string, error) {
+		token := tokens[0]
+		tokens = tokens[1:]
+		if token != "right" {
+			return "", ishell.ErrAuthFailed
+		}
+		return "admin", nil
+	}, 3)
+
+	assert.Equal(t, ishell.ErrNotAuthenticated, shell.Process("whoami"))
+	assert.NoError(t, shell.Authenticate())
+	out.Reset()
+	assert.NoError(t, shell.Process("whoami"))
+	assert.Equal(t, "admin\n", out.String())
+
+	shell.SetAuthenticator(func(c *ishell.Context) (string, error) {
+		return "", ishell.ErrAuthFailed
+	}, 2)
+	assert.Equal(t, ishell.ErrAuthLocked, shell.Authenticate())
+	assert.Equal(t, ishell.ErrAuthLocked, shell.Authenticate(), "shell must stay locked")
+
+	shell, out = newTestShell()
+	shell.SetAuthenticator(func(c *ishell.Context) (string, error) {
+		return "", io.EOF
+	}, 1)
+	err := shell.Authenticate()
+	assert.Equal(t, io.EOF, err)
+	assert.NotErrorIs(t, err, ishell.ErrAuthFailed)
+	assert.Equal(t, io.EOF, shell.Authenticate(), "input errors must not lock the shell")
+
+	users := []string{"", "admin"}
+	shell.SetAuthenticator(func(c *ishell.Context) (string, error) {
+		user := users[0]
+		users = users[1:]
+		return user, nil
+	}, 0)
+	assert.NoError(t, shell.Authenticate())
+	assert.Equal(t, "admin", shell.User())
+	assert.Contains(t, out.String(), "empty user name")
+}
+
+func TestUserStore(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "alice"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "alice", "rc"), []byte("# comment\necho rc\n"), 0600))
+	shell.SetUserStore(ishell.FileUserStore{Dir: dir})
+	var user string
+	shell.SetAuthenticator(func(c *ishell.Context) (string, error) {
+		return user, nil
+	}, 0)
+
+	user = "alice"
+	assert.NoError(t, shell.Authenticate())
+	assert.Equal(t, "echo rc\n", out.String())
+	assert.Equal(t, filepath.Join(dir, "alice", "history"), shell.HistoryPath())
+	shell.Set("color", "red")
+
+	out.Reset()
+	user = "bob"
+	assert.NoError(t, shell.Authenticate())
+	assert.Empty(t, out.String(), "rc of alice must not run for bob")
+	assert.Equal(t, filepath.Join(dir, "bob", "history"), shell.HistoryPath())
+	assert.Nil(t, shell.Get("color"))
+	assert.FileExists(t, filepath.Join(dir, "alice", "values.json"))
+
+	user = "alice"
+	assert.NoError(t, shell.Authenticate())
+	assert.Equal(t, "red", shell.Get("color"))
+
+	out.Reset()
+	shell.SetRestricted(ishell.RestrictFiles)
+	user = "bob"
+	assert.NoError(t, shell.Authenticate())
+	assert.NotContains(t, out.String(), "Error")
+	assert.Empty(t, shell.HistoryPath())
+}
+
+func TestAuditLog(t *testing.T) {
+	shell, _ := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	var log bytes.Buffer
+	shell.SetAuditLog(ishell.NewAuditLog(&log))
+	assert.NoError(t, shell.Process("echo", "one"))
+	assert.Error(t, shell.Process("unknown"))
+	assert.NoError(t, shell.Process("echo", "two"))
+	assert.NoError(t, ishell.VerifyAuditLog(bytes.NewReader(log.Bytes())))
+
+	resumed := ishell.NewAuditLog(&log)
+	assert.NoError(t, resumed.Resume(bytes.NewReader(log.Bytes())))
+	assert.NoError(t, resumed.Record("", []string{"echo", "three"}, nil))
+	assert.NoError(t, ishell.VerifyAuditLog(bytes.NewReader(log.Bytes())))
+
+	tampered := bytes.Replace(log.Bytes(), []byte(`"one"`), []byte(`"uno"`), 1)
+	err := ishell.VerifyAuditLog(bytes.NewReader(tampered))
+	if assert.Error(t, err) {
+		assert.Equal(t, uint64(1), err.(*ishell.AuditError).Seq)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	assert.NoError(t, shell.SetAuditFile(path))
+	assert.NoError(t, shell.Process("echo", "one"))
+	assert.NoError(t, shell.SetAuditFile(path), "the chain of the file must resume")
+	assert.NoError(t, shell.Process("echo", "two"))
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(b, []byte("\n")))
+	assert.NoError(t, ishell.VerifyAuditLog(bytes.NewReader(b)))
+
+	shell.SetRestricted(ishell.RestrictFiles)
+	assert.Equal(t, ishell.ErrRestricted, shell.SetAuditFile(filepath.Join(t.TempDir(), "audit.log")))
+	shell.Close()
+}
+
+func TestSecretArgs(t *testing.T) {
+	shell, out := newTestShell()
+	cmd := &ishell.Cmd{
+		Name: "login",
+		Func: func(c *ishell.Context) {
+			c.Println(c.ParsedArgs.GetString("--user"), len(c.ParsedArgs.GetString("--password")))
+		},
+	}
+	user, _ := ishell.NewArg("--user", ishell.StringType)
+	password, _ := ishell.NewArg("--password", ishell.SecretType, ishell.WithShort("-p"), ishell.Required())
+	cmd.AddCmdArg(user)
+	cmd.AddCmdArg(password)
+	shell.AddCmd(cmd)
+	var log bytes.Buffer
+	shell.SetAuditLog(ishell.NewAuditLog(&log))
+
+	assert.NoError(t, shell.Process("login", "--user", "admin", "--password", "hunter2"))
+	assert.NoError(t, shell.Process("login", "-phunter2"))
+	assert.Equal(t, "admin 7\n 7\n", out.String())
+	assert.NotContains(t, log.String(), "hunter2")
+	assert.Contains(t, log.String(), `"--password","***"`)
+	assert.Contains(t, log.String(), `"-p***"`)
+
+	verbose, _ := ishell.NewArg("--verbose", ishell.BoolType, ishell.WithShort("-v"))
+	cmd.AddCmdArg(verbose)
+	assert.NoError(t, shell.Process("login", "-vphunter2"))
+	assert.NoError(t, shell.Process("login", "-vp", "hunter3"))
+	assert.NotContains(t, log.String(), "hunter")
+	assert.Contains(t, log.String(), `"-vp***"`)
+	assert.Contains(t, log.String(), `"-vp","***"`)
+
+	// there is no prompt outside the interactive shell
+	assert.Error(t, shell.Process("login", "--user", "admin"))
+
+	_, err := ishell.NewArg("password", ishell.SecretType)
+	assert.Error(t, err)
+
+	// typed secrets are kept out of the history
+	history := filepath.Join(t.TempDir(), "history")
+	shell = ishell.NewWithConfig(&readline.Config{Stdin: io.NopCloser(strings.NewReader("")), Stdout: io.Discard, HistoryFile: history})
+	shell.AddCmd(cmd)
+	assert.NoError(t, shell.AddHistory("login --user 'the admin' -vp hunter4"))
+	assert.NoError(t, shell.AddHistory("login --user admin"))
+	b, err := os.ReadFile(history)
+	assert.NoError(t, err)
+	assert.Equal(t, "login --user 'the admin' -vp ***\nlogin --user admin\n", string(b))
+
+	// and out of crash reports
+	var report *ishell.CrashReport
+	shell.SetCrashHandler(func(r *ishell.CrashReport) {
+		report = r
+	})
+	crash := &ishell.Cmd{
+		Name: "crash",
+		Func: func(c *ishell.Context) {
+			panic("bug")
+		},
+	}
+	crash.AddCmdArg(password)
+	shell.AddCmd(crash)
+	assert.Error(t, shell.Process("crash", "-p", "hunter5"))
+	if assert.NotNil(t, report) {
+		assert.Equal(t, []string{"crash", "-p", "***"}, report.Line)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	shell, _ := newTestShell()
+	shell.EnableTransactions()
+	var log []string
+	cmd := &ishell.Cmd{
+		Name: "add",
+		Func: func(c *ishell.Context) {
+			item := c.ParsedArgs[0].Value
+			c.OnCommit(func() error {
+				log = append(log, "commit "+item)
+				return nil
+			})
+			c.OnRollback(func() error {
+				log = append(log, "undo "+item)
+				return nil
+			})
+		},
+	}
+	arg, _ := ishell.NewCmdArg("", "item", ishell.StringType, false, true)
+	cmd.AddCmdArg(arg)
+	shell.AddCmd(cmd)
+
+	assert.NoError(t, shell.Process("add", "a"))
+	assert.Equal(t, []string{"commit a"}, log)
+
+	log = nil
+	assert.NoError(t, shell.Process("begin"))
+	assert.Error(t, shell.Process("begin"))
+	assert.NoError(t, shell.Process("add", "b"))
+	assert.NoError(t, shell.Process("add", "c"))
+	assert.Nil(t, log, "effects must be staged")
+	assert.NoError(t, shell.Process("rollback"))
+	assert.Equal(t, []string{"undo c", "undo b"}, log)
+
+	log = nil
+	assert.NoError(t, shell.Process("begin"))
+	assert.NoError(t, shell.Process("add", "d"))
+	assert.NoError(t, shell.Process("commit"))
+	assert.Equal(t, []string{"commit d"}, log)
+	assert.Equal(t, ishell.ErrNoTransaction, shell.Commit())
+
+	// a failed effect skips the rest and runs the compensations
+	log = nil
+	errFull := errors.New("disk full")
+	shell.AddCmd(&ishell.Cmd{
+		Name: "fail",
+		Func: func(c *ishell.Context) {
+			c.OnCommit(func() error { return errFull })
+		},
+	})
+	assert.NoError(t, shell.Process("begin"))
+	assert.NoError(t, shell.Process("add", "e"))
+	assert.NoError(t, shell.Process("fail"))
+	assert.NoError(t, shell.Process("add", "f"))
+	err := shell.Commit()
+	assert.True(t, errors.Is(err, errFull))
+	assert.Equal(t, []string{"commit e", "undo f", "undo e"}, log)
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	shell, _ := newTestShell()
+	var applied string
+	err := shell.Config().Register("color", ishell.BoolType, "true", "colored output", func(value string) error {
+		applied = value
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, shell.EnableConfig(path))
+
+	assert.NoError(t, shell.Process("config", "set", "color", "false"))
+	assert.Equal(t, "false", applied)
+	assert.False(t, shell.Config().GetBool("color"))
+	assert.Error(t, shell.Config().Set("color", "maybe"))
+	assert.Error(t, shell.Config().Set("unknown", "1"))
+	assert.Equal(t, 500, shell.Config().GetInt("history.size"))
+
+	// values are loaded at startup, also for keys registered later.
+	shell, _ = newTestShell()
+	assert.NoError(t, shell.EnableConfig(path))
+	applied = ""
+	err = shell.Config().Register("color", ishell.BoolType, "true", "colored output", func(value string) error {
+		applied = value
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "false", applied)
+	value, ok := shell.Config().Get("color")
+	assert.True(t, ok)
+	assert.Equal(t, "false", value)
+
+	// loading doesn't rewrite the file.
+	content := []byte(`{"color":"true","later":"1"}`)
+	assert.NoError(t, os.WriteFile(path, content, 0600))
+	assert.NoError(t, shell.Config().Load(path))
+	assert.True(t, shell.Config().GetBool("color"))
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, b)
+
+	shell.SetRestricted(ishell.RestrictFiles)
+	assert.Equal(t, ishell.ErrRestricted, shell.Config().Load(path))
+	assert.NoError(t, shell.Process("config", "set", "color", "false"))
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, content, b, "restricted shells must not save the config")
+}
+
+func TestTheme(t *testing.T) {
+	red := color.New(color.FgRed)
+	red.EnableColor()
+	ishell.RegisterTheme(&ishell.Theme{Name: "test", Command: red, Error: red})
+
+	shell, out := newTestShell()
+	shell.EnableConfig("")
+	shell.AddCmd(&ishell.Cmd{
+		Name: "fail",
+		Func: func(c *ishell.Context) {
+			c.Errorln("boom")
+		},
+	})
+	assert.NoError(t, shell.Process("fail"))
+	assert.Equal(t, "Error: boom\n", out.String())
+
+	assert.NoError(t, shell.Process("config", "set", "theme", "test"))
+	assert.Equal(t, "test", shell.Theme().Name)
+	out.Reset()
+	assert.NoError(t, shell.Process("fail"))
+	assert.Equal(t, red.Sprint("Error: boom")+"\n", out.String())
+	assert.Contains(t, shell.HelpText(), red.Sprint("fail"))
+	assert.NotContains(t, shell.Cmds()[0].HelpText(), "\x1b[")
+
+	assert.Error(t, shell.Process("config", "set", "theme", "unknown"))
+
+	// themes registered later are listed in the help of the key
+	ishell.RegisterTheme(&ishell.Theme{Name: "later"})
+	assert.Contains(t, shell.Config().Help("theme"), "later")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ishell.RegisterTheme(&ishell.Theme{Name: "test" + strconv.Itoa(i)})
+			assert.NoError(t, shell.SetThemeByName("test"))
+			ishell.Themes()
+		}(i)
+	}
+	wg.Wait()
+}
+
+// printActions implements only Actions, printing to out.
+type printActions struct {
+	ishell.Actions
+	out *bytes.Buffer
+}
+
+func (p printActions) Println(val ...interface{}) {
+	fmt.Fprintln(p.out, val...)
+}
+
+func TestOutputActions(t *testing.T) {
+	var out bytes.Buffer
+	c := &ishell.Context{Actions: printActions{out: &out}}
+	c.Errorln("boom")
+	c.Warnln("careful")
+	assert.NoError(t, c.Flush())
+	assert.Equal(t, "Error: boom\ncareful\n", out.String())
+}
+
+func TestDeprecatedArgs(t *testing.T) {
+	shell, out := newTestShell()
+	cmd := newEchoCmd("echo")
+	old, _ := ishell.NewCmdArg("-o", "--old", ishell.BoolType, true, false)
+	old.Deprecated = true
+	old.ReplacedBy = "--new"
+	cmd.AddCmdArg(old)
+	shell.AddCmd(cmd)
+
+	assert.NoError(t, shell.Process("echo", "-o", "--old"))
+	assert.Equal(t, "Argument '--old' is deprecated, use '--new' instead\necho \necho \n", out.String())
+	assert.Contains(t, cmd.HelpText(), "deprecated, use --new")
+}
+
+func TestPreAndPostRun(t *testing.T) {
+	shell, out := newTestShell()
+	var conn string
+	shell.AddCmd(&ishell.Cmd{
+		Name: "query",
+		PreRun: func(c *ishell.Context) {
+			if conn == "down" {
+				c.Err(errors.New("no connection"))
+				return
+			}
+			conn = "open"
+		},
+		Func: func(c *ishell.Context) {
+			c.Println("query on", conn)
+		},
+		PostRun: func(c *ishell.Context) {
+			conn = "closed"
+		},
+	})
+	assert.NoError(t, shell.Process("query"))
+	assert.Equal(t, "query on open\n", out.String())
+	assert.Equal(t, "closed", conn)
+
+	conn = "down"
+	assert.EqualError(t, shell.Process("query"), "no connection")
+	assert.Equal(t, "down", conn, "PostRun is skipped when PreRun fails")
+}
+
+func TestMiddleware(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	shell.AddCmd(&ishell.Cmd{Name: "admin", Func: func(c *ishell.Context) {
+		c.Println("admin")
+	}})
+	shell.Use(func(next func(*ishell.Context)) func(*ishell.Context) {
+		return func(c *ishell.Context) {
+			c.Println("before", c.Cmd.Name)
+			next(c)
+			c.Println("after", c.Cmd.Name)
+		}
+	})
+	shell.Use(func(next func(*ishell.Context)) func(*ishell.Context) {
+		return func(c *ishell.Context) {
+			if c.Cmd.Name == "admin" {
+				c.Err(errors.New("permission denied"))
+				return
+			}
+			next(c)
+		}
+	})
+	assert.NoError(t, shell.Process("echo", "hi"))
+	assert.EqualError(t, shell.Process("admin"), "permission denied")
+	assert.Equal(t, "before echo\necho hi\nafter echo\nbefore admin\nafter admin\n", out.String())
+}
+
+func TestDeprecatedCmd(t *testing.T) {
+	shell, out := newTestShell()
+	old := newEchoCmd("ls")
+	old.Help = "list files"
+	old.Deprecated = true
+	old.DeprecationMessage = "use 'list' instead"
+	shell.AddCmd(old)
+
+	assert.NoError(t, shell.Process("ls", "a"))
+	assert.NoError(t, shell.Process("ls", "b"))
+	assert.Equal(t, "Command 'ls' is deprecated, use 'list' instead\nls a\nls b\n", out.String())
+	assert.Contains(t, shell.HelpText(), "list files (deprecated)")
+	assert.Contains(t, old.HelpText(), "Command 'ls' is deprecated, use 'list' instead")
+
+	// deprecated commands complete as they are typed
+	shell.AddCmd(newEchoCmd("lsblk"))
+	assert.Equal(t, []string{"ls", "lsblk"}, shell.Complete("l"))
+	assert.Equal(t, []string{"lsblk"}, shell.Complete("lsb"))
+	shell.AddCmdProvider(func() []*ishell.Cmd {
+		lsof := newEchoCmd("lsof")
+		lsof.Deprecated = true
+		return []*ishell.Cmd{lsof}
+	})
+	assert.Equal(t, []string{"ls", "lsblk", "lsof"}, shell.Complete("l"))
+}
+
+func TestCmdProvider(t *testing.T) {
+	shell, out := newTestShell()
+	var names []string
+	calls := 0
+	shell.AddCmdProvider(func() []*ishell.Cmd {
+		calls++
+		var cmds []*ishell.Cmd
+		for _, name := range names {
+			cmds = append(cmds, newEchoCmd(name))
+		}
+		return cmds
+	})
+	assert.Error(t, shell.Process("users", "list"))
+
+	names = []string{"users", "groups"}
+	assert.NoError(t, shell.Process("users", "list"))
+	assert.Equal(t, "users list\n", out.String())
+	assert.Contains(t, shell.HelpText(), "groups")
+
+	// the commands are kept until the next input or refresh
+	calls = 0
+	names = []string{"hosts"}
+	assert.Contains(t, shell.HelpText(), "groups")
+	shell.Complete("u")
+	assert.Equal(t, 0, calls)
+	shell.RefreshCmds()
+	assert.Contains(t, shell.HelpText(), "hosts")
+	assert.NotContains(t, shell.HelpText(), "groups")
+	assert.Equal(t, 1, calls)
+}
+
+func TestErrorHandler(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(&ishell.Cmd{
+		Name: "fail",
+		Func: func(c *ishell.Context) {
+			c.Err(errors.New("boom"))
+		},
+	})
+	shell.SetErrorHandler(func(c *ishell.Context, err error) {
+		if err == ishell.ErrUnknownCommand {
+			c.Println("unknown command", c.Args[0])
+			return
+		}
+		c.Println(c.Cmd.Name, "failed:", err)
+	})
+	shell.ProcessBatch(1, []string{"fail"}, []string{"nope"})
+	assert.Equal(t, "fail failed: boom\nunknown command nope\n", out.String())
+}
+
+func TestCrashRecovery(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(&ishell.Cmd{
+		Name: "crash",
+		Func: func(c *ishell.Context) {
+			panic("bug")
+		},
+	})
+	shell.AddCmd(newEchoCmd("echo"))
+	var report *ishell.CrashReport
+	shell.SetCrashHandler(func(r *ishell.CrashReport) {
+		report = r
+	})
+	shell.ProcessBatch(1, []string{"crash"}, []string{"echo", "alive"})
+	assert.Equal(t, "Error: command crashed: bug\necho alive\n", out.String())
+	if assert.NotNil(t, report) {
+		assert.Equal(t, []string{"crash"}, report.Line)
+		assert.Equal(t, "bug", report.Value)
+		assert.Contains(t, string(report.Stack), "TestCrashRecovery")
+	}
+}
+
+func TestPersistentArgs(t *testing.T) {
+	shell, out := newTestShell()
+	cloud := &ishell.Cmd{Name: "cloud"}
+	vm := &ishell.Cmd{Name: "vm"}
+	list := &ishell.Cmd{
+		Name: "list",
+		Func: func(c *ishell.Context) {
+			c.Println(c.ParsedArgs.GetBool("--verbose"), c.ParsedArgs.GetString("--profile"), c.ParsedArgs.GetString("--zone"))
+		},
+	}
+	verbose, _ := ishell.NewArg("--verbose", ishell.BoolType, ishell.WithShort("-v"))
+	profile, _ := ishell.NewArg("--profile", ishell.StringType, ishell.WithShort("-p"))
+	zone, _ := ishell.NewArg("--zone", ishell.StringType, ishell.WithShort("-v"))
+	assert.NoError(t, cloud.AddPersistentCmdArg(verbose))
+	assert.NoError(t, vm.AddPersistentCmdArg(profile))
+	list.AddCmdArg(zone)
+	vm.AddCmd(list)
+	cloud.AddCmd(vm)
+	shell.AddCmd(cloud)
+
+	assert.NoError(t, shell.Process("cloud", "vm", "list", "--verbose", "-p", "dev", "-v", "eu"))
+	assert.Equal(t, "true dev eu\n", out.String())
+
+	// inherited flags are shown in help and completed
+	out.Reset()
+	assert.NoError(t, shell.Process("cloud", "vm", "list", "help"))
+	assert.Contains(t, out.String(), "Usage: list [-v|--zone <string>] [-p|--profile <string>] [--verbose]")
+	assert.Equal(t, []string{"--profile", "--verbose", "--zone"}, shell.Complete("cloud vm list --"))
+	assert.Equal(t, []string{"--profile", "--verbose"}, shell.Complete("cloud vm --"))
+
+	positional, _ := ishell.NewArg("name", ishell.StringType)
+	assert.Error(t, cloud.AddPersistentCmdArg(positional))
+}
+
+func TestArgDefaults(t *testing.T) {
+	shell, out := newTestShell()
+	net := &ishell.Cmd{Name: "net"}
+	ping := &ishell.Cmd{
+		Name:    "ping",
+		Aliases: []string{"p"},
+		Func: func(c *ishell.Context) {
+			c.Println(c.ParsedArgs.GetString("--region"), c.ParsedArgs.Values("--tag"))
+		},
+	}
+	region, _ := ishell.NewArg("--region", ishell.StringType, ishell.Required())
+	tag, _ := ishell.NewArg("--tag", ishell.StringType, ishell.Multiple())
+	ping.AddCmdArg(region)
+	ping.AddCmdArg(tag)
+	net.AddCmd(ping)
+	shell.AddCmd(net)
+
+	path := filepath.Join(t.TempDir(), "defaults.yaml")
+	os.WriteFile(path, []byte("net ping:\n  --region: eu-west-1\n  --tag: [a, b]\n"), 0600)
+	assert.NoError(t, shell.LoadArgDefaults(path))
+
+	assert.NoError(t, shell.Process("net", "p"))
+	assert.NoError(t, shell.Process("net", "ping", "--region", "us-east-1"))
+	assert.Equal(t, "eu-west-1 [a b]\nus-east-1 [a b]\n", out.String())
+
+	for _, content := range []string{
+		"net pong:\n  --region: eu\n",
+		"net ping:\n  -r: eu\n",
+		"net ping:\n  --zone: eu\n",
+	} {
+		os.WriteFile(path, []byte(content), 0600)
+		assert.Error(t, shell.LoadArgDefaults(path), content)
+	}
+	os.WriteFile(path, []byte("net p:\n  --region: ap-south-1\n"), 0600)
+	assert.NoError(t, shell.LoadArgDefaults(path), "aliases name the command")
+	out.Reset()
+	assert.NoError(t, shell.Process("net", "ping"))
+	assert.Equal(t, "ap-south-1 [a b]\n", out.String())
+
+	// defaults imply arguments like given ones
+	trace := &ishell.Cmd{
+		Name: "trace",
+		Func: func(c *ishell.Context) {
+			c.Println(c.ParsedArgs.GetBool("--verbose"))
+		},
+	}
+	debug, _ := ishell.NewArg("--debug", ishell.BoolType)
+	debug.Implies = []string{"--verbose"}
+	verbose, _ := ishell.NewArg("--verbose", ishell.BoolType)
+	trace.AddCmdArg(debug)
+	trace.AddCmdArg(verbose)
+	shell.AddCmd(trace)
+	os.WriteFile(path, []byte("trace:\n  --debug: true\n"), 0600)
+	assert.NoError(t, shell.LoadArgDefaults(path))
+	out.Reset()
+	assert.NoError(t, shell.Process("trace"))
+	assert.Equal(t, "true\n", out.String())
+
+	shell.SetRestricted(ishell.RestrictFiles)
+	assert.Equal(t, ishell.ErrRestricted, shell.LoadArgDefaults(path))
+}
+
+func TestConcurrentCmdRegistry(t *testing.T) {
+	shell, _ := newTestShell()
+	root := &ishell.Cmd{Name: "root"}
+	shell.AddCmd(root)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			name := "cmd" + strconv.Itoa(i%10)
+			root.AddCmd(&ishell.Cmd{Name: name, Func: func(c *ishell.Context) {}})
+			root.DeleteCmd(name)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			root.FindCmd([]string{"cmd1"})
+			root.Children()
+			root.HelpText()
+			shell.Process("root", "cmd2")
+		}
+	}()
+	wg.Wait()
+
+	root.AddCmd(&ishell.Cmd{Name: "cmd1"})
+	cmd, _ := root.FindCmd([]string{"cmd1"})
+	assert.NotNil(t, cmd)
+}
+
+func TestShellIgnoreCase(t *testing.T) {
+	shell, out := newTestShell()
+	shell.IgnoreCase(true)
+	echo := &ishell.Cmd{
+		Name: "echo",
+		Func: func(c *ishell.Context) {
+			c.Println(c.ParsedArgs.GetString("text"))
+		},
+	}
+	text, _ := ishell.NewArg("text", ishell.StringType)
+	echo.AddCmdArg(text)
+	shell.AddCmd(echo)
+	assert.NoError(t, shell.Process("ECHO", "Hello"))
+	assert.Equal(t, "Hello\n", out.String())
+}
+
+func TestAutoCorrect(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("status"))
+	shell.AddCmd(newEchoCmd("stats"))
+	shell.AddCmd(newEchoCmd("stop"))
+
+	err := shell.Process("stauts")
+	assert.ErrorIs(t, err, ishell.ErrUnknownCommand)
+	assert.EqualError(t, err, "Unknown command 'stauts', did you mean 'stats' or 'status'?")
+
+	shell.AutoCorrect(true)
+	assert.Error(t, shell.Process("stauts"))
+	assert.NoError(t, shell.Process("stp", "now"))
+	assert.Equal(t, "Running 'stop'\nstop now\n", out.String())
+}
+
+func TestCmdTimeout(t *testing.T) {
+	shell, out := newTestShell()
+	timedOut, stopped := make(chan struct{}), make(chan struct{})
+	shell.AddCmd(&ishell.Cmd{
+		Name:    "hang",
+		Timeout: 10 * time.Millisecond,
+		Func: func(c *ishell.Context) {
+			<-c.Context().Done()
+			<-timedOut
+			c.Println("too late")
+			c.Errorln("too late")
+			close(stopped)
+		},
+	})
+	shell.AddCmd(&ishell.Cmd{
+		Name:    "quick",
+		Timeout: time.Minute,
+		Func: func(c *ishell.Context) {
+			c.Println("done")
+		},
+	})
+
+	err := shell.Process("hang")
+	assert.ErrorIs(t, err, ishell.ErrTimeout)
+	assert.EqualError(t, err, "command timed out after 10ms")
+	close(timedOut)
+	<-stopped
+
+	assert.NoError(t, shell.Process("quick"))
+	assert.Equal(t, "done\n", out.String())
+}
+
+func TestErrFunc(t *testing.T) {
+	shell, out := newTestShell()
+	rm := &ishell.Cmd{
+		Name: "rm",
+		ErrFunc: func(c *ishell.Context) error {
+			if len(c.Args) == 0 {
+				return errors.New("nothing to remove")
+			}
+			c.Println("removed", c.Args[0])
+			return nil
+		},
+		Func: func(c *ishell.Context) {
+			c.Println("not called")
+		},
+	}
+	name, _ := ishell.NewArg("name", ishell.StringType)
+	rm.AddCmdArg(name)
+	shell.AddCmd(rm)
+
+	assert.EqualError(t, shell.Process("rm"), "nothing to remove")
+	assert.NoError(t, shell.Process("rm", "a"))
+	assert.Equal(t, "removed a\n", out.String())
+
+	shell.SetErrorHandler(func(c *ishell.Context, err error) {
+		c.Println(c.Cmd.Name, "failed:", err)
+	})
+	shell.ProcessBatch(1, []string{"rm"})
+	assert.Equal(t, "removed a\nrm failed: nothing to remove\n", out.String())
+}
+
+func TestCmdNotFoundFunc(t *testing.T) {
+	shell, out := newTestShell()
+	ssh := &ishell.Cmd{
+		Name: "ssh",
+		Help: "connect to a host",
+		NotFoundFunc: func(c *ishell.Context) {
+			c.Println(c.Cmd.Name, c.Args)
+		},
+	}
+	ssh.AddCmd(newEchoCmd("keys"))
+	shell.AddCmd(ssh)
+
+	assert.NoError(t, shell.Process("ssh", "web-1", "-p", "22"))
+	assert.NoError(t, shell.Process("ssh", "keys", "list"))
+	assert.Equal(t, "ssh [web-1 -p 22]\nkeys list\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, shell.Process("ssh"))
+	assert.Contains(t, out.String(), "keys")
+
+	root := &ishell.Cmd{Name: "root"}
+	root.AddCmd(ssh)
+	cmd, rest, err := root.FindCmdStrict([]string{"ssh", "web-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, ssh, cmd)
+	assert.Equal(t, []string{"web-1"}, rest)
+}
+
+func TestNamespaceSeparator(t *testing.T) {
+	shell, out := newTestShell()
+	shell.SetNamespaceSeparator(".")
+	net := &ishell.Cmd{Name: "net"}
+	net.AddCmd(newEchoCmd("ping"))
+	shell.AddCmd(net)
+
+	assert.NoError(t, shell.Process("net.ping", "8.8.8.8"))
+	assert.NoError(t, shell.Process("net", "ping", "1.1.1.1"))
+	assert.Equal(t, "ping 8.8.8.8\nping 1.1.1.1\n", out.String())
+}
+
+func TestPlugins(t *testing.T) {
+	shell, out := newTestShell()
+	shell.EnablePlugins()
+
+	path := filepath.Join(t.TempDir(), "missing.so")
+	assert.Error(t, shell.Process("plugin", "load", path))
+	assert.EqualError(t, shell.Process("plugin", "unload", path), "plugin "+path+" is not loaded")
+	assert.EqualError(t, shell.Process("plugin", "load"), "usage: plugin load <path>")
+
+	assert.NoError(t, shell.Process("plugin", "list"))
+	assert.Equal(t, "PLUGIN  COMMANDS\n", out.String())
+
+	shell.SetRestricted(ishell.RestrictPlugins)
+	assert.ErrorIs(t, shell.LoadPlugin(path), ishell.ErrRestricted)
+	assert.ErrorIs(t, shell.Process("plugin", "load", path), ishell.ErrRestricted)
+}
+
+func TestVersion(t *testing.T) {
+	shell, out := newTestShell()
+	shell.SetVersion("1.2.0")
+	shell.AddCmd(&ishell.Cmd{
+		Name:    "k8s",
+		Version: "0.3.1",
+		Func: func(c *ishell.Context) {
+			c.Println("not called")
+		},
+	})
+
+	assert.NoError(t, shell.Process("version"))
+	assert.Contains(t, out.String(), "version  1.2.0\n")
+	assert.Contains(t, out.String(), "go       go1.")
+
+	out.Reset()
+	assert.NoError(t, shell.Process("--version"))
+	assert.Contains(t, out.String(), "version  1.2.0\n")
+
+	out.Reset()
+	assert.NoError(t, shell.Process("k8s", "--version"))
+	assert.Equal(t, "k8s version 0.3.1\n", out.String())
+}
+
+func TestDisableCmd(t *testing.T) {
+	shell, out := newTestShell()
+	db := &ishell.Cmd{Name: "db", Help: "database commands"}
+	db.AddCmd(newEchoCmd("query"))
+	shell.AddCmd(db)
+
+	db.Disable("requires login")
+	err := shell.Process("db", "query", "x")
+	var disabled *ishell.ErrCmdDisabled
+	if assert.ErrorAs(t, err, &disabled) {
+		assert.Equal(t, "db", disabled.Name)
+	}
+	assert.EqualError(t, err, "Command 'db' is disabled, requires login")
+	assert.Contains(t, shell.HelpText(), "database commands (disabled: requires login)")
+
+	db.Enable()
+	assert.NoError(t, shell.Process("db", "query", "x"))
+	assert.Equal(t, "query x\n", out.String())
+	assert.NotContains(t, shell.HelpText(), "disabled")
+}
+
+func TestExportManifest(t *testing.T) {
+	shell, _ := newTestShell()
+	shell.SetVersion("1.2.0")
+	ping := &ishell.Cmd{Name: "ping", Aliases: []string{"p"}, Help: "ping a host"}
+	host, _ := ishell.NewArg("host", ishell.StringType, ishell.Required())
+	count, _ := ishell.NewArg("--count", ishell.IntType, ishell.WithShort("-c"), ishell.WithDefault("1"))
+	ping.AddCmdArg(host)
+	ping.AddCmdArg(count)
+	net := &ishell.Cmd{Name: "net", Category: "Networking"}
+	net.AddCmd(ping)
+	shell.AddCmd(net)
+
+	var b bytes.Buffer
+	assert.NoError(t, shell.ExportManifest(&b, ishell.ManifestYAML))
+	assert.Contains(t, b.String(), "version: 1.2.0\ncommands:\n")
+	assert.Contains(t, b.String(), `
+  - name: net
+    category: Networking
+    commands:
+      - name: ping
+        aliases:
+          - p
+        help: ping a host
+        args:
+          - name: host
+            type: string
+            required: true
+          - name: --count
+            short: -c
+            type: int
+            default: "1"
+`)
+
+	b.Reset()
+	assert.NoError(t, shell.ExportManifest(&b, ishell.ManifestJSON))
+	var manifest ishell.Manifest
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &manifest))
+	var names []string
+	for _, cmd := range manifest.Commands {
+		names = append(names, cmd.Name)
+	}
+	assert.Equal(t, []string{"clear", "exit", "help", "net", "version"}, names)
+	assert.Equal(t, ishell.IntType, manifest.Commands[3].Commands[0].Args[1].Type)
+}
+
+func TestLoadCmds(t *testing.T) {
+	shell, out := newTestShell()
+	funcs := map[string]func(*ishell.Context){
+		"ping": func(c *ishell.Context) {
+			c.Println("ping", c.ParsedArgs.GetString("host"), c.ParsedArgs.GetInt("--count"))
+		},
+	}
+	path := filepath.Join(t.TempDir(), "commands.yaml")
+	os.WriteFile(path, []byte(`commands:
+  - name: net
+    help: network tools
+    commands:
+      - name: ping
+        aliases: [p]
+        func: ping
+        args:
+          - name: host
+            type: string
+            required: true
+          - name: --count
+            short: -c
+            type: int
+            default: "1"
+`), 0600)
+	assert.NoError(t, shell.LoadCmds(path, funcs))
+	assert.NoError(t, shell.Process("net", "p", "example.com"))
+	assert.NoError(t, shell.Process("net", "ping", "example.com", "-c", "3"))
+	assert.Equal(t, "ping example.com 1\nping example.com 3\n", out.String())
+
+	os.WriteFile(path, []byte(`{"commands": [{"name": "dns", "func": "lookup"}]}`), 0600)
+	assert.EqualError(t, shell.LoadCmds(path, funcs), path+": Command 'dns': no func 'lookup'")
+	assert.NotContains(t, shell.HelpText(), "dns")
+
+	os.WriteFile(path, []byte(`{"commands": [{"name": "dns", "args": [{"name": "--ttl", "type": "uuid"}]}]}`), 0600)
+	assert.Error(t, shell.LoadCmds(path, funcs))
+
+	os.WriteFile(path, []byte(`{"commands": [{"name": "dns"}]}`), 0600)
+	shell.SetRestricted(ishell.RestrictFiles)
+	assert.ErrorIs(t, shell.LoadCmds(path, funcs), ishell.ErrRestricted)
+	assert.NotContains(t, shell.HelpText(), "dns")
+}
+
+func TestHelpTemplate(t *testing.T) {
+	shell, out := newTestShell()
+	ping := &ishell.Cmd{Name: "ping", Help: "ping a host"}
+	count, _ := ishell.NewArg("--count", ishell.IntType, ishell.WithHelp("number of pings"))
+	ping.AddCmdArg(count)
+	net := &ishell.Cmd{Name: "net", Help: "network tools"}
+	net.AddCmd(ping)
+	shell.AddCmd(net)
+
+	shell.SetHelpTemplate(template.Must(template.New("help").Parse(
+		"ACME {{.Cmd.Name}}: {{.Cmd.Help}}\n{{range .Children}}- {{.Name}}\n{{end}}{{range .Args}}{{.Name}} ({{.Type}}) {{.Help}}\n{{end}}")))
+	assert.NoError(t, shell.Process("net"))
+	assert.NoError(t, shell.Process("net", "ping", "help"))
+	assert.Equal(t, "ACME net: network tools\n- ping\n\nACME ping: ping a host\n--count (int) number of pings\n\n", out.String())
+
+	out.Reset()
+	ping.HelpTemplate = template.Must(template.New("ping").Parse("{{.Default}}See the wiki."))
+	assert.NoError(t, shell.Process("net", "ping", "help"))
+	assert.Equal(t, "\nUsage: ping [--count <int>]\n\nping a host\n\nArguments:\n  --count  int      number of pings\n\nSee the wiki.\n", out.String())
+	assert.Equal(t, "\nUsage: ping [--count <int>]\n\nping a host\n\nArguments:\n  --count  int      number of pings\n\nSee the wiki.", ping.HelpText())
+}
+
+func TestRequireSubcommand(t *testing.T) {
+	shell, out := newTestShell()
+	ran := false
+	config := &ishell.Cmd{Name: "config", Help: "configuration", RequireSubcommand: true, Func: func(c *ishell.Context) { ran = true }}
+	config.AddCmd(newEchoCmd("get"))
+	shell.AddCmd(config)
+
+	err := shell.Process("config")
+	assert.ErrorIs(t, err, ishell.ErrSubcommandRequired)
+	assert.EqualError(t, err, "Command 'config': subcommand required")
+	assert.Contains(t, out.String(), "Commands:\n  get")
+
+	err = shell.Process("config", "gte")
+	assert.EqualError(t, err, "Unknown command 'gte' in 'config', did you mean 'get'?")
+	assert.False(t, ran)
+
+	out.Reset()
+	assert.NoError(t, shell.Process("config", "get", "x"))
+	assert.Equal(t, "get x\n", out.String())
+}
+
+func TestSubshell(t *testing.T) {
+	var out bytes.Buffer
+	input := "config\nwhere\nget x\ntop y\nnope\ndb\nwhere\nquery z\n..\nwhere\nexit\nwhere\nget x\nconfig\n"
+	shell := ishell.NewWithConfig(&readline.Config{Stdin: io.NopCloser(strings.NewReader(input)), Stdout: &out, Prompt: "app> "})
+	shell.SetOut(&out)
+	shell.EOF(func(c *ishell.Context) {
+		c.Stop()
+	})
+	shell.NotFound(func(c *ishell.Context) {
+		c.Println("not found", c.Args)
+	})
+	config := &ishell.Cmd{Name: "config", Help: "configuration", Subshell: true}
+	config.AddCmd(newEchoCmd("get"))
+	db := &ishell.Cmd{Name: "db", Subshell: true}
+	db.AddCmd(newEchoCmd("query"))
+	config.AddCmd(db)
+	shell.AddCmd(config)
+	shell.AddCmd(newEchoCmd("top"))
+	shell.AddCmd(&ishell.Cmd{
+		Name: "where",
+		Func: func(c *ishell.Context) {
+			c.Println(shell.Prompt(), shell.Complete(""))
+		},
+	})
+
+	shell.Run()
+	assert.Equal(t, "app(config)>  [db get]\n"+
+		"get x\ntop y\nnot found [nope]\n"+
+		"app(config db)>  [query]\nquery z\n"+
+		"app(config)>  [db get]\n"+
+		"app>  [clear config exit help top where]\nnot found [get x]\n", out.String())
+
+	// the scope applies to input typed at the prompt only
+	assert.Equal(t, []string{"config"}, shell.Scope())
+	cmd, args := shell.FindCmd([]string{"get", "x"})
+	assert.Equal(t, "get", cmd.Name)
+	assert.Equal(t, []string{"x"}, args)
+	cmd, _ = shell.FindCmd([]string{"top"})
+	assert.Equal(t, "top", cmd.Name)
+	cmd, args = shell.FindCmd([]string{"nope"})
+	assert.Nil(t, cmd)
+	assert.Equal(t, []string{"nope"}, args)
+
+	out.Reset()
+	assert.NoError(t, shell.Process("db"))
+	assert.NoError(t, shell.Process("config", "get", "y"))
+	assert.Equal(t, "not found [db]\nget y\n", out.String())
+	shell.ProcessBatch(1, []string{"config", "db"})
+	assert.Equal(t, []string{"config"}, shell.Scope())
+}
+
+func TestCommandsByTag(t *testing.T) {
+	shell, out := newTestShell()
+	net := &ishell.Cmd{Name: "net", Help: "network commands"}
+	ping := &ishell.Cmd{Name: "ping", Help: "ping a host", Tags: []string{"network", "diagnostics"}}
+	net.AddCmd(ping)
+	net.AddCmd(&ishell.Cmd{Name: "dns", Help: "resolve a name", Tags: []string{"network"}})
+	shell.AddCmd(net)
+	shell.AddCmd(&ishell.Cmd{Name: "disk", Help: "disk usage", Tags: []string{"diagnostics"}})
+
+	var names []string
+	for _, cmd := range shell.CommandsByTag("network") {
+		names = append(names, cmd.Name)
+	}
+	assert.Equal(t, []string{"dns", "ping"}, names)
+	assert.Empty(t, shell.CommandsByTag("storage"))
+
+	// listed by the words that run them
+	tools := &ishell.Cmd{Name: "tools"}
+	tools.AddCmd(ping)
+	shell.AddCmd(tools)
+	assert.NoError(t, shell.Process("help", "--tag", "diagnostics"))
+	assert.Equal(t, "disk        disk usage\nnet ping    ping a host\ntools ping  ping a host\n", out.String())
+	assert.EqualError(t, shell.Process("help", "-t", "storage"), "no commands tagged 'storage'")
+}
+
+func TestCompletionTags(t *testing.T) {
+	shell, _ := newTestShell()
+	net := &ishell.Cmd{Name: "net"}
+	net.AddCmd(&ishell.Cmd{Name: "ping", Tags: []string{"network"}})
+	net.AddCmd(&ishell.Cmd{Name: "df", Tags: []string{"storage"}})
+	shell.AddCmd(net)
+	shell.AddCmd(&ishell.Cmd{Name: "disk", Tags: []string{"storage"}})
+	shell.AddCmd(&ishell.Cmd{Name: "dig", Tags: []string{"network"}})
+
+	shell.SetCompletionTags("network")
+	assert.Equal(t, []string{"dig", "net"}, shell.Complete(""))
+	assert.Equal(t, []string{"ping"}, shell.Complete("net "))
+	assert.Equal(t, []string{"dig"}, shell.Complete("d"))
+
+	shell.SetCompletionTags("storage", "network")
+	assert.Equal(t, []string{"df", "ping"}, shell.Complete("net "))
+
+	shell.SetCompletionTags()
+	assert.Equal(t, []string{"dig", "disk"}, shell.Complete("di"))
+}
+
+func TestAsyncCmd(t *testing.T) {
+	var out lockedBuffer
+	shell := ishell.New()
+	shell.SetOut(&out)
+	shell.EnableTasks()
+	// tasks do not take command slots
+	shell.SetRateLimits(ishell.RateLimits{Commands: 1})
+	release := make(chan struct{})
+	shell.AddCmd(&ishell.Cmd{
+		Name:  "scan",
+		Async: true,
+		Func: func(c *ishell.Context) {
+			c.Println("scanning")
+			select {
+			case <-release:
+				c.Println("found 3 hosts")
+			case <-c.Context().Done():
+			}
+		},
+	})
+	reported := func(text string) func() bool {
+		return func() bool {
+			return strings.Contains(out.String(), text)
+		}
+	}
+
+	assert.NoError(t, shell.Process("scan"))
+	assert.NoError(t, shell.Process("scan"))
+	tasks := shell.Tasks()
+	if assert.Len(t, tasks, 2) {
+		assert.Equal(t, "running", tasks[0].Status())
+		assert.Equal(t, []string{"scan"}, tasks[0].Line)
+	}
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(shell.Tasks()[1].Output, "scanning")
+	}, time.Second, time.Millisecond, "both tasks run")
+	assert.NoError(t, shell.Process("tasks", "cancel", "2"))
+	assert.Eventually(t, reported("[2] cancelled\n"), time.Second, time.Millisecond)
+	close(release)
+	assert.Eventually(t, reported("[1] done\n"), time.Second, time.Millisecond)
+	// tasks have ended when they are reported
+	tasks = shell.Tasks()
+	assert.Equal(t, "done", tasks[0].Status())
+	assert.Equal(t, "scanning\nfound 3 hosts\n", tasks[0].Output)
+	assert.Equal(t, "cancelled", tasks[1].Status())
+	assert.Contains(t, out.String(), "[1] started\n[2] started\n")
+
+	out.Reset()
+	assert.NoError(t, shell.Process("tasks", "output", "1"))
+	assert.Equal(t, "scanning\nfound 3 hosts\n", out.String())
+	assert.EqualError(t, shell.Process("tasks", "output", "3"), "no task 3")
+	assert.NoError(t, shell.Process("tasks", "clear"))
+	assert.Empty(t, shell.Tasks())
+}
+
+func TestNotFoundLine(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	shell.NotFoundLine(func(c *ishell.Context, line string) {
+		c.Printf("eval %q %d\n", line, len(c.Args))
+	})
+
+	assert.NoError(t, shell.Process("1", "+", "2"))
+	assert.NoError(t, shell.Process("echo", "x"))
+	assert.NoError(t, shell.Process("send", "a  b", `x"y`))
+	assert.Equal(t, "eval \"1 + 2\" 3\necho x\neval \"send 'a  b' 'x\\\"y'\" 3\n", out.String())
+
+	// typed lines are passed as they are
+	var typed bytes.Buffer
+	input := "send  \"a  b\" 'x\"y'\n"
+	shell = ishell.NewWithConfig(&readline.Config{Stdin: io.NopCloser(strings.NewReader(input)), Stdout: &typed})
+	shell.SetOut(&typed)
+	shell.EOF(func(c *ishell.Context) {
+		c.Stop()
+	})
+	shell.NotFoundLine(func(c *ishell.Context, line string) {
+		c.Printf("%s|%d\n", line, len(c.Args))
+	})
+	shell.Run()
+	assert.Equal(t, "send  \"a  b\" 'x\"y'|3\n", typed.String())
+}
+
+func TestCompletion(t *testing.T) {
+	shell, _ := newTestShell()
+	net := &ishell.Cmd{Name: "net"}
+	net.AddCmd(&ishell.Cmd{Name: "ping"})
+	net.AddCmd(&ishell.Cmd{Name: "trace"})
+	shell.AddCmd(net)
+
+	assert.Equal(t, []string{"net"}, shell.Complete("ne"))
+	assert.Equal(t, []string{"ping", "trace"}, shell.Complete("net "))
+	assert.Equal(t, []string{"trace"}, shell.Complete("net t"))
+}
+
+func TestValueCompletion(t *testing.T) {
+	shell, _ := newTestShell()
+	var prefixes []string
+	region, _ := ishell.NewArg("--region", ishell.StringType, ishell.WithShort("-r"), ishell.WithCompleter(func(prefix string) []string {
+		prefixes = append(prefixes, prefix)
+		return []string{"eu-west-1", "eu-central-1", "us-east-1"}
+	}))
+	format, _ := ishell.NewArg("--format", ishell.StringType, ishell.WithChoices("json", "yaml"))
+	deploy := &ishell.Cmd{Name: "deploy"}
+	deploy.AddCmdArg(region)
+	deploy.AddCmdArg(format)
+	shell.AddCmd(deploy)
+
+	assert.Equal(t, []string{"eu-west-1", "eu-central-1"}, shell.Complete("deploy --region eu"))
+	assert.Equal(t, []string{"us-east-1"}, shell.Complete("deploy -r u"))
+	assert.Equal(t, []string{"eu-west-1", "eu-central-1", "us-east-1"}, shell.Complete("deploy --region "))
+	assert.Equal(t, []string{"eu", "u", ""}, prefixes)
+	assert.Equal(t, []string{"yaml"}, shell.Complete("deploy --format y"))
+	assert.Equal(t, []string{"--format", "--region"}, shell.Complete("deploy --"))
+}
+
+func TestBufferOutputConcurrent(t *testing.T) {
+	shell, out := newTestShell()
+	shell.BufferOutput(64)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				shell.Println("line")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, shell.Flush())
+	assert.Equal(t, strings.Repeat("line\n", 800), out.String())
+}
+
+func TestCommandsLimit(t *testing.T) {
+	shell, out := newTestShell()
+	shell.SetRateLimits(ishell.RateLimits{Commands: 1})
+	shell.AddCmd(newEchoCmd("echo"))
+	shell.AddCmd(&ishell.Cmd{
+		Name: "nested",
+		Func: func(c *ishell.Context) {
+			c.Err(shell.Process("echo", "inner"))
+		},
+	})
+
+	done := make(chan error)
+	go func() { done <- shell.Process("nested") }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("nested Process deadlocked")
+	}
+	results := shell.ProcessBatch(2, []string{"nested"}, []string{"echo", "x"})
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "echo inner\necho inner\necho x\n", out.String())
+}
+
+func TestDebugCmd(t *testing.T) {
+	var out lockedBuffer
+	shell := ishell.New()
+	shell.SetOut(&out)
+	shell.AddDebugCmd()
+	dir := t.TempDir()
+
+	heap := filepath.Join(dir, "heap.pprof")
+	assert.NoError(t, shell.Process("debug", "pprof", "heap", heap))
+	info, err := os.Stat(heap)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Size())
+	assert.Error(t, shell.Process("debug", "pprof", "nope", heap))
+	assert.Error(t, shell.Process("debug", "pprof", "cpu", heap, "0"))
+
+	cpu := filepath.Join(dir, "cpu.pprof")
+	start := time.Now()
+	assert.NoError(t, shell.Process("debug", "pprof", "cpu", cpu, "1"))
+	assert.Less(t, time.Since(start), time.Second, "cpu profile blocked the shell")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "profile written to "+cpu)
+	}, 3*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, shell.Process("debug", "stats"))
+	for _, stat := range []string{"sessions", "history size", "completion cache hit rate", "num gc"} {
+		assert.Contains(t, out.String(), stat)
+	}
+}
+
+func TestRestricted(t *testing.T) {
+	shell, out := newTestShell()
+	shell.AddDebugCmd()
+	shell.SetRestricted(ishell.RestrictAll)
+	assert.True(t, shell.Restricted(ishell.RestrictFiles|ishell.RestrictExec))
+
+	path := filepath.Join(t.TempDir(), "heap.pprof")
+	shell.SetHistoryPath(filepath.Join(t.TempDir(), "history"))
+	assert.Contains(t, out.String(), ishell.ErrRestricted.Error())
+	assert.ErrorIs(t, shell.Process("debug", "pprof", "heap", path), ishell.ErrRestricted)
+	assert.NoFileExists(t, path)
+
+	shell.SetRestricted(0)
+	assert.False(t, shell.Restricted(ishell.RestrictFiles))
+	assert.NoError(t, shell.Process("debug", "pprof", "heap", path))
+	assert.FileExists(t, path)
+}
+
+func TestScheduler(t *testing.T) {
+	var out lockedBuffer
+	shell := ishell.New()
+	shell.SetOut(&out)
+	shell.AddCmd(newEchoCmd("echo"))
+	shell.EnableScheduler()
+
+	assert.NoError(t, shell.Process("every", "1h", "echo", "hourly"))
+	assert.NoError(t, shell.Process("at", "23:59", "echo", "late"))
+	assert.Error(t, shell.Process("every", "0s", "echo", "never"))
+	jobs := shell.ScheduledJobs()
+	if assert.Len(t, jobs, 2) {
+		assert.Equal(t, "every 1h0m0s", jobs[0].When)
+		assert.Equal(t, []string{"echo", "hourly"}, jobs[0].Line)
+		assert.Equal(t, "at 23:59:00", jobs[1].When)
+	}
+	assert.NoError(t, shell.Process("schedule", "list"))
+	assert.Contains(t, out.String(), "echo hourly")
+
+	assert.NoError(t, shell.Process("schedule", "run", "1"))
+	assert.Contains(t, out.String(), "[1] echo hourly\necho hourly\n")
+	assert.Len(t, shell.ScheduledJobs(), 2, "run must not change the schedule")
+
+	assert.NoError(t, shell.Process("schedule", "cancel", "2"))
+	assert.Error(t, shell.Process("schedule", "cancel", "2"))
+	assert.Error(t, shell.Process("schedule", "run", "2"))
+	assert.Len(t, shell.ScheduledJobs(), 1)
+
+	id, err := shell.ScheduleEvery(10*time.Millisecond, "echo", "tick")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return strings.Count(out.String(), "echo tick\n") >= 2
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, shell.CancelScheduled(id))
+
+	id = shell.ScheduleAt(time.Now().Add(10*time.Millisecond), "echo", "once")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "echo once\n")
+	}, time.Second, time.Millisecond)
+	assert.Error(t, shell.CancelScheduled(id), "jobs run at a time end once run")
+	assert.NoError(t, shell.CancelScheduled(1))
+	assert.Empty(t, shell.ScheduledJobs())
+}
+
+func TestWatch(t *testing.T) {
+	shell, _ := newTestShell()
+	shell.AddCmd(newEchoCmd("echo"))
+	_, _, err := shell.RootCmd().FindCmdStrict([]string{"watch"})
+	assert.Error(t, err, "watch must be opt-in")
+
+	shell.EnableWatch()
+	shell.EnableWatch()
+	assert.Len(t, shell.RootCmd().Children(), 5)
+	assert.Error(t, shell.Process("watch"))
+	assert.Error(t, shell.Process("watch", "-n", "0", "echo", "x"))
+	err = shell.Process("watch", "-n", "0.5", "echo", "x")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "interactive shell")
+	}
+}
@@ -0,0 +1,130 @@
+package ishell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFormat is the encoding of a manifest written by ExportManifest.
+type ManifestFormat int
+
+const (
+	ManifestJSON ManifestFormat = iota
+	ManifestYAML
+)
+
+// Manifest describes the commands of a shell, see ExportManifest.
+type Manifest struct {
+	// Version is the version set with SetVersion.
+	Version  string    `json:"version,omitempty" yaml:"version,omitempty"`
+	Commands []CmdSpec `json:"commands" yaml:"commands"`
+}
+
+// CmdSpec describes a command, its arguments and its subcommands as data.
+type CmdSpec struct {
+	Name               string   `json:"name" yaml:"name"`
+	Aliases            []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Help               string   `json:"help,omitempty" yaml:"help,omitempty"`
+	LongHelp           string   `json:"long_help,omitempty" yaml:"long_help,omitempty"`
+	Category           string   `json:"category,omitempty" yaml:"category,omitempty"`
+	Tags               []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Weight             int      `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Deprecated         bool     `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	DeprecationMessage string   `json:"deprecation_message,omitempty" yaml:"deprecation_message,omitempty"`
+	RequireSubcommand  bool     `json:"require_subcommand,omitempty" yaml:"require_subcommand,omitempty"`
+	// Func is the name the Func of the command is registered under, see
+	// LoadCmds. It is not exported in manifests.
+	Func     string    `json:"func,omitempty" yaml:"func,omitempty"`
+	Examples []Example `json:"examples,omitempty" yaml:"examples,omitempty"`
+	Args     []ArgSpec `json:"args,omitempty" yaml:"args,omitempty"`
+	Commands []CmdSpec `json:"commands,omitempty" yaml:"commands,omitempty"`
+}
+
+// ArgSpec describes an argument of a command as data.
+type ArgSpec struct {
+	// Name is the long flag, e.g. "--force", or the key of a positional
+	// argument.
+	Name       string   `json:"name" yaml:"name"`
+	Short      string   `json:"short,omitempty" yaml:"short,omitempty"`
+	Type       ArgType  `json:"type" yaml:"type"`
+	Required   bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Multiple   bool     `json:"multiple,omitempty" yaml:"multiple,omitempty"`
+	Rest       bool     `json:"rest,omitempty" yaml:"rest,omitempty"`
+	Hidden     bool     `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Deprecated bool     `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Aliases    []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Choices    []string `json:"choices,omitempty" yaml:"choices,omitempty"`
+	Default    string   `json:"default,omitempty" yaml:"default,omitempty"`
+	Help       string   `json:"help,omitempty" yaml:"help,omitempty"`
+	Group      string   `json:"group,omitempty" yaml:"group,omitempty"`
+}
+
+// ExportManifest writes the commands of the shell, with their aliases and
+// arguments, to w in format. The output is ordered like help, so manifests
+// of two releases can be diffed, or fed to documentation tools.
+func (s *Shell) ExportManifest(w io.Writer, format ManifestFormat) error {
+	manifest := Manifest{Commands: s.rootCmd.spec().Commands}
+	if s.version != nil {
+		manifest.Version = versionOrBuild(*s.version)
+	}
+	switch format {
+	case ManifestJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(manifest)
+	case ManifestYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(manifest); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return fmt.Errorf("unknown manifest format %d", format)
+}
+
+// spec returns c and its subcommands as a CmdSpec.
+func (c *Cmd) spec() CmdSpec {
+	spec := CmdSpec{
+		Name:               c.Name,
+		Aliases:            c.Aliases,
+		Help:               c.Help,
+		LongHelp:           c.LongHelp,
+		Category:           c.Category,
+		Tags:               c.Tags,
+		Weight:             c.Weight,
+		Deprecated:         c.Deprecated,
+		DeprecationMessage: c.DeprecationMessage,
+		RequireSubcommand:  c.RequireSubcommand,
+		Examples:           c.Examples,
+	}
+	for _, arg := range c.arglist {
+		spec.Args = append(spec.Args, arg.spec())
+	}
+	for _, child := range c.Children() {
+		spec.Commands = append(spec.Commands, child.spec())
+	}
+	return spec
+}
+
+// spec returns a as an ArgSpec.
+func (a *CmdArg) spec() ArgSpec {
+	return ArgSpec{
+		Name:       a.longFlag,
+		Short:      a.flag,
+		Type:       a.typ,
+		Required:   a.required,
+		Multiple:   a.canHaveMultiple,
+		Rest:       a.Rest,
+		Hidden:     a.Hidden,
+		Deprecated: a.Deprecated,
+		Aliases:    a.Aliases,
+		Choices:    a.Choices,
+		Default:    a.Default,
+		Help:       a.Help,
+		Group:      a.Group,
+	}
+}
@@ -0,0 +1,302 @@
+package ishell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ParsedArgs are the arguments returned by ParseArgs, in the order they
+// were given. Keys are the long flags of the arguments, e.g. "--format",
+// or the names of positional arguments.
+type ParsedArgs []ParsedArg
+
+// Has tells if the argument key was given.
+func (p ParsedArgs) Has(key string) bool {
+	_, ok := p.Get(key)
+	return ok
+}
+
+// Get returns the first value given for key.
+func (p ParsedArgs) Get(key string) (ParsedArg, bool) {
+	for _, arg := range p {
+		if arg.Key == key {
+			return arg, true
+		}
+	}
+	return ParsedArg{}, false
+}
+
+// GetAll returns all values given for key, e.g. of an argument that can
+// have multiple values.
+func (p ParsedArgs) GetAll(key string) []ParsedArg {
+	var ret []ParsedArg
+	for _, arg := range p {
+		if arg.Key == key {
+			ret = append(ret, arg)
+		}
+	}
+	return ret
+}
+
+// Values returns the values given for key, e.g. of a repeated "--tag".
+func (p ParsedArgs) Values(key string) []string {
+	var ret []string
+	for _, arg := range p {
+		if arg.Key == key {
+			ret = append(ret, arg.Value)
+		}
+	}
+	return ret
+}
+
+// IntValues returns the values given for the IntType argument key.
+func (p ParsedArgs) IntValues(key string) []int {
+	var ret []int
+	for _, arg := range p {
+		if i, ok := arg.Parsed.(int); ok && arg.Key == key {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// FloatValues returns the values given for the FloatType argument key.
+func (p ParsedArgs) FloatValues(key string) []float64 {
+	var ret []float64
+	for _, arg := range p {
+		if f, ok := arg.Parsed.(float64); ok && arg.Key == key {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// DurationValues returns the values given for the DurationType argument
+// key.
+func (p ParsedArgs) DurationValues(key string) []time.Duration {
+	var ret []time.Duration
+	for _, arg := range p {
+		if d, ok := arg.Parsed.(time.Duration); ok && arg.Key == key {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// GetIntSlice returns the elements of all values of the IntSliceType
+// argument key.
+func (p ParsedArgs) GetIntSlice(key string) []int {
+	var ret []int
+	for _, arg := range p.GetAll(key) {
+		ret = append(ret, arg.IntSlice()...)
+	}
+	return ret
+}
+
+// GetStringSlice returns the elements of all values of the StringSliceType
+// argument key.
+func (p ParsedArgs) GetStringSlice(key string) []string {
+	var ret []string
+	for _, arg := range p.GetAll(key) {
+		ret = append(ret, arg.StringSlice()...)
+	}
+	return ret
+}
+
+// GetString returns the first value of key, "" if it wasn't given.
+func (p ParsedArgs) GetString(key string) string {
+	arg, _ := p.Get(key)
+	return arg.Value
+}
+
+// GetInt returns the first value of the IntType argument key, 0 if it
+// wasn't given.
+func (p ParsedArgs) GetInt(key string) int {
+	arg, _ := p.Get(key)
+	i, _ := arg.Parsed.(int)
+	return i
+}
+
+// GetBool tells if the BoolType argument key was given and not set to
+// false.
+func (p ParsedArgs) GetBool(key string) bool {
+	arg, _ := p.Get(key)
+	b, _ := arg.Parsed.(bool)
+	return b
+}
+
+// GetFloat returns the first value of the FloatType argument key, 0 if it
+// wasn't given.
+func (p ParsedArgs) GetFloat(key string) float64 {
+	arg, _ := p.Get(key)
+	return arg.Float()
+}
+
+// GetDuration returns the first value of the DurationType argument key, 0
+// if it wasn't given.
+func (p ParsedArgs) GetDuration(key string) time.Duration {
+	arg, _ := p.Get(key)
+	return arg.Duration()
+}
+
+// GetSize returns the first value of the SizeType argument key in bytes, 0
+// if it wasn't given.
+func (p ParsedArgs) GetSize(key string) int64 {
+	arg, _ := p.Get(key)
+	return arg.Size()
+}
+
+// DecodeJSON decodes the first value of the JSONType argument key into the
+// value dst points to, as json.Unmarshal does. dst is left untouched if key
+// wasn't given.
+func (p ParsedArgs) DecodeJSON(key string, dst interface{}) error {
+	arg, ok := p.Get(key)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal([]byte(arg.Value), dst)
+}
+
+// GetTime returns the first value of the TimeType argument key, the zero
+// Time if it wasn't given.
+func (p ParsedArgs) GetTime(key string) time.Time {
+	arg, _ := p.Get(key)
+	return arg.Time()
+}
+
+// GetURL returns the first value of the URLType argument key, nil if it
+// wasn't given.
+func (p ParsedArgs) GetURL(key string) *url.URL {
+	arg, _ := p.Get(key)
+	return arg.URL()
+}
+
+// GetIP returns the first value of the IPType argument key, the zero Addr
+// if it wasn't given.
+func (p ParsedArgs) GetIP(key string) netip.Addr {
+	arg, _ := p.Get(key)
+	return arg.IP()
+}
+
+// Unmarshal stores the arguments in the fields of the struct dst points to.
+// Fields are mapped with tags naming the argument key, e.g.
+//
+//	type options struct {
+//		Format string   `ishell:"--format"`
+//		Tags   []string `ishell:"--tag"`
+//		Path   string   `ishell:"path"`
+//	}
+//
+// Values are converted to the type of the field. Slice fields receive all
+// values of the argument, or all elements of IntSliceType and StringSliceType
+// values, other fields the first. Fields of arguments that
+// weren't given are left untouched.
+func (p ParsedArgs) Unmarshal(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("Unmarshal requires a pointer to a struct")
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key, ok := field.Tag.Lookup("ishell")
+		if !ok || key == "" || key == "-" {
+			continue
+		}
+		args := p.GetAll(key)
+		if len(args) == 0 {
+			continue
+		}
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			return fmt.Errorf("field %s is not exported", field.Name)
+		}
+		if fv.Kind() == reflect.Slice && is_slice_of(args[0], fv.Type()) {
+			slice := reflect.MakeSlice(fv.Type(), 0, 0)
+			for _, arg := range args {
+				slice = reflect.AppendSlice(slice, reflect.ValueOf(arg.Parsed))
+			}
+			fv.Set(slice)
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(fv.Type(), len(args), len(args))
+			for j, arg := range args {
+				if err := set_field(slice.Index(j), arg); err != nil {
+					return fmt.Errorf("field %s: %v", field.Name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := set_field(fv, args[0]); err != nil {
+			return fmt.Errorf("field %s: %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// tells if arg holds the elements of a slice value of type typ
+func is_slice_of(arg ParsedArg, typ reflect.Type) bool {
+	return arg.Parsed != nil && reflect.TypeOf(arg.Parsed).AssignableTo(typ)
+}
+
+// sets v to the value of arg, converted to the type of v
+func set_field(v reflect.Value, arg ParsedArg) error {
+	if arg.Parsed != nil {
+		parsed := reflect.ValueOf(arg.Parsed)
+		if parsed.Type().AssignableTo(v.Type()) {
+			v.Set(parsed)
+			return nil
+		}
+	}
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(arg.Value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(arg.Value)
+	case reflect.Bool:
+		if arg.Typ == BoolType {
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(arg.Value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(arg.Value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(arg.Value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(arg.Value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
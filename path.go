@@ -0,0 +1,55 @@
+package ishell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// PathCheck selects the checks ParseArgs does on the value of a
+// FilePathType argument. Checks can be combined, e.g.
+// PathIsFile | PathReadable.
+type PathCheck int
+
+const (
+	// PathExists requires the path to exist.
+	PathExists PathCheck = 1 << iota
+	// PathIsFile requires the path to be an existing regular file.
+	PathIsFile
+	// PathIsDir requires the path to be an existing directory.
+	PathIsDir
+	// PathReadable requires the path to exist and be readable.
+	PathReadable
+	// PathWritable requires the path to exist and be writable.
+	PathWritable
+)
+
+// check_path validates path against checks
+func check_path(path string, checks PathCheck) error {
+	if checks == 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: file does not exist", path)
+	} else if err != nil {
+		return err
+	}
+	if checks&PathIsFile != 0 && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", path)
+	}
+	if checks&PathIsDir != 0 && !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", path)
+	}
+	if checks&PathReadable != 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("%s: file is not readable", path)
+		}
+		f.Close()
+	}
+	if checks&PathWritable != 0 && !writable(info) {
+		return fmt.Errorf("%s: file is not writable", path)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build (linux || darwin || freebsd) && cgo
+// +build linux darwin freebsd
+// +build cgo
+
+package ishell
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// openPlugin opens the Go plugin at path and returns its Commands function.
+func openPlugin(path string) (func() []*Cmd, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Commands")
+	if err != nil {
+		return nil, err
+	}
+	commands, ok := sym.(func() []*Cmd)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: Commands is %T, not func() []*ishell.Cmd", path, sym)
+	}
+	return commands, nil
+}
@@ -0,0 +1,9 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+// +build !linux,!darwin,!freebsd !cgo
+
+package ishell
+
+// openPlugin fails, as Go plugins are not supported on this platform.
+func openPlugin(path string) (func() []*Cmd, error) {
+	return nil, ErrPluginsUnsupported
+}
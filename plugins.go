@@ -0,0 +1,153 @@
+package ishell
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// ErrPluginsUnsupported is the error of loading a plugin on a platform or
+// build without Go plugin support, which needs cgo on Linux, macOS or
+// FreeBSD.
+var ErrPluginsUnsupported = errors.New("plugins are not supported on this platform")
+
+// pluginSet holds the commands added by each loaded plugin, by path.
+type pluginSet struct {
+	loaded map[string][]*Cmd
+	sync.Mutex
+}
+
+// LoadPlugin adds the commands of the Go plugin at path, a shared object
+// built with "go build -buildmode=plugin" that exports
+//
+//	func Commands() []*ishell.Cmd
+//
+// The plugin must be built with the same version of Go and of ishell as
+// the shell. Its commands must not have the name of a command already
+// added. It fails with ErrRestricted if the shell restricts plugins.
+func (s *Shell) LoadPlugin(path string) error {
+	if err := s.checkRestricted(RestrictPlugins); err != nil {
+		return err
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	s.plugins.Lock()
+	defer s.plugins.Unlock()
+	if _, ok := s.plugins.loaded[path]; ok {
+		return fmt.Errorf("plugin %s is already loaded", path)
+	}
+	commands, err := openPlugin(path)
+	if err != nil {
+		return err
+	}
+	cmds := commands()
+	for _, cmd := range cmds {
+		if _, ok := s.rootCmd.child(cmd.Name); ok {
+			return fmt.Errorf("plugin %s: command '%s' already exists", path, cmd.Name)
+		}
+	}
+	for _, cmd := range cmds {
+		s.AddCmd(cmd)
+	}
+	if s.plugins.loaded == nil {
+		s.plugins.loaded = make(map[string][]*Cmd)
+	}
+	s.plugins.loaded[path] = cmds
+	return nil
+}
+
+// UnloadPlugin deletes the commands added by the plugin at path. Go cannot
+// unload the plugin's code, so loading it again adds the same commands,
+// even if the file has changed.
+func (s *Shell) UnloadPlugin(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	s.plugins.Lock()
+	defer s.plugins.Unlock()
+	cmds, ok := s.plugins.loaded[path]
+	if !ok {
+		return fmt.Errorf("plugin %s is not loaded", path)
+	}
+	for _, cmd := range cmds {
+		s.DeleteCmd(cmd.Name)
+	}
+	delete(s.plugins.loaded, path)
+	return nil
+}
+
+// EnablePlugins adds commands to manage plugins, see LoadPlugin:
+//
+//	plugin load ./plugins/k8s.so
+//	plugin list
+//	plugin unload ./plugins/k8s.so
+func (s *Shell) EnablePlugins() {
+	if _, ok := s.rootCmd.child("plugin"); ok {
+		return
+	}
+	plugin := &Cmd{
+		Name: "plugin",
+		Help: "manage plugins",
+	}
+	plugin.AddCmd(&Cmd{
+		Name:     "load",
+		Help:     "add the commands of a plugin",
+		LongHelp: "usage: plugin load <path>",
+		Func: func(c *Context) {
+			s.pluginFunc(c, "load", s.LoadPlugin)
+		},
+		rawArgs: true,
+	})
+	plugin.AddCmd(&Cmd{
+		Name:     "unload",
+		Help:     "delete the commands of a plugin",
+		LongHelp: "usage: plugin unload <path>",
+		Func: func(c *Context) {
+			s.pluginFunc(c, "unload", s.UnloadPlugin)
+		},
+		rawArgs: true,
+	})
+	plugin.AddCmd(&Cmd{
+		Name: "list",
+		Help: "list loaded plugins",
+		Func: s.pluginListFunc,
+	})
+	s.AddCmd(plugin)
+}
+
+// pluginFunc runs the plugin subcommand action with the path in c.Args.
+func (s *Shell) pluginFunc(c *Context, action string, f func(path string) error) {
+	if len(c.Args) != 1 {
+		c.Err(fmt.Errorf("usage: plugin %s <path>", action))
+		return
+	}
+	c.Err(f(c.Args[0]))
+}
+
+func (s *Shell) pluginListFunc(c *Context) {
+	s.plugins.Lock()
+	paths := make([]string, 0, len(s.plugins.loaded))
+	for path := range s.plugins.loaded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	w := tabwriter.NewWriter(c.Writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tCOMMANDS")
+	for _, path := range paths {
+		var names []string
+		for _, cmd := range s.plugins.loaded[path] {
+			names = append(names, cmd.Name)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", path, strings.Join(names, ", "))
+	}
+	s.plugins.Unlock()
+	c.Err(w.Flush())
+}
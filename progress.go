@@ -115,9 +115,17 @@ func (p *progressBarImpl) write(s string) error {
 	p.erase(p.writtenLen)
 	p.writtenLen = utf8.RuneCountInString(s)
 	_, err := p.writer.Write([]byte(s))
+	p.flush()
 	return err
 }
 
+// flush writes out the progress bar if the output is buffered.
+func (p *progressBarImpl) flush() {
+	if f, ok := p.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
+
 func (p *progressBarImpl) erase(n int) {
 	for i := 0; i < n; i++ {
 		p.writer.Write([]byte{'\b'})
@@ -130,6 +138,7 @@ func (p *progressBarImpl) done() {
 
 	p.erase(p.writtenLen)
 	fmt.Fprintln(p.writer, p.final)
+	p.flush()
 }
 
 func (p *progressBarImpl) output() string {
@@ -0,0 +1,110 @@
+package ishell
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimits protects a shell from clients driving it faster than intended,
+// e.g. misbehaving automated clients on a network connection. Exceeding a
+// limit slows the client down rather than failing. A zero value field
+// means no limit.
+type RateLimits struct {
+	// InputLines is the number of input lines processed per second.
+	InputLines float64
+	// InputBurst is the number of lines that may arrive at once before
+	// InputLines applies. Defaults to 1.
+	InputBurst int
+	// OutputBytes is the number of bytes written per second.
+	OutputBytes float64
+	// Commands is the number of commands that may run at the same time
+	// in the background, i.e. by ProcessBatch and the scheduler. Further
+	// commands wait for a running one to finish. The command run at the
+	// prompt or by Process does not count, so commands may call Process
+	// themselves.
+	Commands int
+}
+
+// SetRateLimits sets the rate limits of the shell. There are no limits
+// by default.
+func (s *Shell) SetRateLimits(limits RateLimits) {
+	s.inputLimit = nil
+	if limits.InputLines > 0 {
+		burst := limits.InputBurst
+		if burst < 1 {
+			burst = 1
+		}
+		s.inputLimit = newRateLimiter(limits.InputLines, float64(burst))
+	}
+	s.outputLimit = nil
+	if limits.OutputBytes > 0 {
+		// allow a second worth of output at once.
+		s.outputLimit = newRateLimiter(limits.OutputBytes, limits.OutputBytes)
+	}
+	s.commandSlots = nil
+	if limits.Commands > 0 {
+		s.commandSlots = make(chan struct{}, limits.Commands)
+	}
+	s.updateWriter()
+}
+
+// acquireCommandSlot waits until a command may run under the Commands
+// limit and returns a function that frees the slot again. It is only
+// taken where commands start concurrently, as it is not reentrant.
+func (s *Shell) acquireCommandSlot() func() {
+	slots := s.commandSlots
+	if slots == nil {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second up to
+// burst tokens.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	sync.Mutex
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until they are available. Requests larger
+// than the burst are let through and paid back by later callers.
+// A nil rateLimiter never waits.
+func (l *rateLimiter) wait(n float64) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= n
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.Unlock()
+	time.Sleep(delay)
+}
+
+// throttledWriter limits the bytes per second written to writer.
+type throttledWriter struct {
+	writer  io.Writer
+	limiter *rateLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	t.limiter.wait(float64(len(p)))
+	return t.writer.Write(p)
+}
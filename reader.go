@@ -2,10 +2,12 @@ package ishell
 
 import (
 	"bytes"
+	"log"
 	"strings"
 	"sync"
 
 	"github.com/abiosoft/readline"
+	"github.com/fatih/color"
 )
 
 type (
@@ -15,39 +17,111 @@ type (
 	}
 
 	shellReader struct {
+		// scanner is created on first use, see instance.
 		scanner      *readline.Instance
+		config       *readline.Config
+		scannerMutex sync.Mutex
 		consumers    chan lineString
 		reading      bool
 		readingMulti bool
-		buf          *bytes.Buffer
+		buf          *printBuffer
 		prompt       string
+		scope        string
 		multiPrompt  string
 		showPrompt   bool
+		promptColor  *color.Color
 		completer    readline.AutoCompleter
 		defaultInput string
 		sync.Mutex
 	}
 )
 
+// instance returns the readline instance, creating it on first use. This
+// way shells that are only used non-interactively, e.g. with Process,
+// never touch the terminal.
+func (s *shellReader) instance() *readline.Instance {
+	s.scannerMutex.Lock()
+	defer s.scannerMutex.Unlock()
+	if s.scanner == nil {
+		rl, err := readline.NewEx(s.config)
+		if err != nil {
+			log.Println("Shell or operating system not supported.")
+			log.Fatal(err)
+		}
+		s.scanner = rl
+	}
+	return s.scanner
+}
+
+// getConfig returns the readline config, without creating the readline
+// instance.
+func (s *shellReader) getConfig() *readline.Config {
+	s.scannerMutex.Lock()
+	defer s.scannerMutex.Unlock()
+	if s.scanner != nil {
+		return s.scanner.Config
+	}
+	return s.config
+}
+
+// setConfig sets the readline config and returns the previous one.
+func (s *shellReader) setConfig(config *readline.Config) *readline.Config {
+	s.scannerMutex.Lock()
+	defer s.scannerMutex.Unlock()
+	old := s.config
+	s.config = config
+	if s.scanner != nil {
+		old = s.scanner.SetConfig(config)
+	}
+	return old
+}
+
+// setHistoryPath sets the history file. A new readline instance is needed
+// for the history to work, it is created on next use.
+func (s *shellReader) setHistoryPath(path string) {
+	s.scannerMutex.Lock()
+	defer s.scannerMutex.Unlock()
+	if s.scanner != nil {
+		s.config = s.scanner.Config
+		s.scanner = nil
+	}
+	s.config = s.config.Clone()
+	s.config.HistoryFile = path
+}
+
+// updatePrompt shows the current prompt if reading has started.
+func (s *shellReader) updatePrompt() {
+	s.scannerMutex.Lock()
+	defer s.scannerMutex.Unlock()
+	if s.scanner != nil {
+		s.scanner.SetPrompt(s.rlPrompt())
+	}
+}
+
+// close closes the readline instance, if any.
+func (s *shellReader) close() {
+	s.scannerMutex.Lock()
+	defer s.scannerMutex.Unlock()
+	if s.scanner != nil {
+		s.scanner.Close()
+	}
+}
+
 // rlPrompt returns the proper prompt for readline based on showPrompt and
 // prompt members.
 func (s *shellReader) rlPrompt() string {
 	if s.showPrompt {
 		if s.readingMulti {
-			return s.multiPrompt
+			return styled(s.promptColor, s.multiPrompt)
 		}
-		return s.prompt
+		return styled(s.promptColor, scopedPrompt(s.prompt, s.scope))
 	}
 	return ""
 }
 
 func (s *shellReader) readPasswordErr() (string, error) {
-	prompt := ""
-	if s.buf.Len() > 0 {
-		prompt = s.buf.String()
-		s.buf.Truncate(0)
-	}
-	password, err := s.scanner.ReadPassword(prompt)
+	prompt := s.buf.take()
+	password, err := s.instance().ReadPassword(prompt)
 	return string(password), err
 }
 
@@ -77,23 +151,51 @@ func (s *shellReader) readLine(consumer chan lineString) {
 	// TODO find better way.
 	shellPrompt := s.prompt
 	prompt := s.rlPrompt()
-	if s.buf.Len() > 0 {
-		lines := strings.Split(s.buf.String(), "\n")
+	if printed := s.buf.take(); printed != "" {
+		lines := strings.Split(printed, "\n")
 		if p := lines[len(lines)-1]; strings.TrimSpace(p) != "" {
 			prompt = p
 		}
-		s.buf.Truncate(0)
 	}
 
 	// use printed statement as prompt
-	s.scanner.SetPrompt(prompt)
+	scanner := s.instance()
+	scanner.SetPrompt(prompt)
 
-	line, err := s.scanner.ReadlineWithDefault(s.defaultInput)
+	line, err := scanner.ReadlineWithDefault(s.defaultInput)
 
 	// reset prompt
-	s.scanner.SetPrompt(shellPrompt)
+	scanner.SetPrompt(shellPrompt)
 
 	ls := lineString{string(line), err}
 	consumer <- ls
 	s.reading = false
 }
+
+// printBuffer holds what was printed last, to be used as the prompt. It is
+// safe for concurrent use, as commands may print from other goroutines.
+type printBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *printBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *printBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// take returns the printed text and empties the buffer.
+func (b *printBuffer) take() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	text := b.buf.String()
+	b.buf.Reset()
+	return text
+}
@@ -0,0 +1,49 @@
+package ishell
+
+import "errors"
+
+// ErrRestricted is returned for operations that the shell's restrictions
+// do not permit.
+var ErrRestricted = errors.New("not permitted in restricted mode")
+
+// Restriction is a set of capabilities a shell is denied, see
+// Shell.SetRestricted.
+type Restriction uint
+
+const (
+	// RestrictExec prevents the shell from starting external processes.
+	// Paged output is printed directly instead of through the pager.
+	RestrictExec Restriction = 1 << iota
+	// RestrictFiles prevents the shell from accessing files on behalf of
+	// the user, such as the history file or debug profiles.
+	RestrictFiles
+	// RestrictPlugins prevents loading commands from plugins.
+	RestrictPlugins
+
+	// RestrictAll denies everything above, so that the shell can only run
+	// its registered commands.
+	RestrictAll = RestrictExec | RestrictFiles | RestrictPlugins
+)
+
+// SetRestricted denies the shell the capabilities in r, replacing any
+// previous restrictions. A shell is unrestricted by default.
+func (s *Shell) SetRestricted(r Restriction) {
+	s.restriction = r
+	if r&RestrictFiles != 0 {
+		s.reader.setHistoryPath("")
+		s.config.setPath("")
+	}
+}
+
+// Restricted reports whether all capabilities in r are denied.
+func (s *Shell) Restricted(r Restriction) bool {
+	return s.restriction&r == r
+}
+
+// checkRestricted returns ErrRestricted if any capability in r is denied.
+func (s *Shell) checkRestricted(r Restriction) error {
+	if s.restriction&r != 0 {
+		return ErrRestricted
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package ishell
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrControlCharacters is returned for input containing control characters
+// or escape sequences when the input policy rejects them.
+var ErrControlCharacters = errors.New("input contains control characters")
+
+// InputPolicy filters control characters and terminal escape sequences out
+// of input before it is dispatched to commands. This matters when input
+// comes from untrusted sources such as network connections, where
+// embedded escape sequences could manipulate the terminal of whoever
+// reads the output or logs.
+type InputPolicy struct {
+	// Reject fails input that contains control characters with
+	// ErrControlCharacters instead of removing them.
+	Reject bool
+	// Allow lists the control characters that are let through, e.g. "\t".
+	// Newlines are always allowed, multiline input relies on them.
+	Allow string
+}
+
+// SetInputPolicy sets the policy applied to input before dispatch. A nil
+// policy, the default, lets all input through unchanged.
+func (s *Shell) SetInputPolicy(policy *InputPolicy) {
+	s.inputPolicy = policy
+}
+
+// apply returns args filtered according to the policy. A nil policy
+// returns args unchanged.
+func (p *InputPolicy) apply(args []string) ([]string, error) {
+	if p == nil {
+		return args, nil
+	}
+	var ret []string
+	for i, arg := range args {
+		clean := p.sanitize(arg)
+		if clean == arg {
+			if ret != nil {
+				ret = append(ret, arg)
+			}
+			continue
+		}
+		if p.Reject {
+			return nil, ErrControlCharacters
+		}
+		if ret == nil {
+			ret = append(make([]string, 0, len(args)), args[:i]...)
+		}
+		ret = append(ret, clean)
+	}
+	if ret == nil {
+		return args, nil
+	}
+	return ret, nil
+}
+
+func (p *InputPolicy) allowed(r rune) bool {
+	return r == '\n' || !unicode.IsControl(r) || strings.ContainsRune(p.Allow, r)
+}
+
+// sanitize removes escape sequences and disallowed control characters
+// from str.
+func (p *InputPolicy) sanitize(str string) string {
+	clean := true
+	for _, r := range str {
+		if !p.allowed(r) {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return str
+	}
+
+	var b strings.Builder
+	runes := []rune(str)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\x1b' {
+			i = skipEscape(runes, i)
+			continue
+		}
+		if p.allowed(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// skipEscape returns the index of the last rune of the escape sequence
+// starting at runes[i].
+func skipEscape(runes []rune, i int) int {
+	if i+1 >= len(runes) {
+		return i
+	}
+	switch runes[i+1] {
+	case '[':
+		// CSI: parameters and intermediates up to a final byte.
+		for j := i + 2; j < len(runes); j++ {
+			if runes[j] >= 0x40 && runes[j] <= 0x7e {
+				return j
+			}
+		}
+		return len(runes) - 1
+	case ']', 'P', '_', '^':
+		// OSC and other strings, terminated by BEL or ESC \.
+		for j := i + 2; j < len(runes); j++ {
+			if runes[j] == '\a' {
+				return j
+			}
+			if runes[j] == '\x1b' && j+1 < len(runes) && runes[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(runes) - 1
+	}
+	// two character sequence.
+	return i + 1
+}
@@ -0,0 +1,329 @@
+package ishell
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ScheduledJob is a command line scheduled to run later, see
+// Shell.ScheduleAt and Shell.ScheduleEvery.
+type ScheduledJob struct {
+	// ID identifies the job in the schedule commands.
+	ID int
+	// Line is the command line the job runs, with the values of secret
+	// arguments redacted.
+	Line []string
+	// When describes the schedule, e.g. "at 22:00" or "every 5m".
+	When string
+	// Next is when the job runs next.
+	Next time.Time
+}
+
+// scheduledJob is a scheduled command line and the channel stopping it.
+type scheduledJob struct {
+	ScheduledJob
+	stop chan struct{}
+}
+
+type scheduler struct {
+	shell  *Shell
+	jobs   map[int]*scheduledJob
+	nextID int
+	// outMu keeps the output of jobs finishing together apart.
+	outMu sync.Mutex
+	sync.Mutex
+}
+
+// EnableScheduler adds commands to run command lines at a later time or
+// repeatedly, in the background:
+//
+//	at 22:00 backup run
+//	every 5m status --brief
+//	schedule list
+//	schedule run 2
+//	schedule cancel 2
+//
+// The output of scheduled commands is printed once they finish.
+func (s *Shell) EnableScheduler() {
+	if _, ok := s.rootCmd.child("schedule"); ok {
+		return
+	}
+	s.AddCmd(&Cmd{
+		Name:     "at",
+		Help:     "run a command at a time of day",
+		LongHelp: "usage: at <HH:MM[:SS]> <command...>\n\nRuns the command at the next occurrence of the time.",
+		Func:     s.scheduler.atFunc,
+		rawArgs:  true,
+	})
+	s.AddCmd(&Cmd{
+		Name:     "every",
+		Help:     "run a command repeatedly",
+		LongHelp: "usage: every <interval> <command...>\n\nRuns the command every interval, e.g. 30s or 5m.",
+		Func:     s.scheduler.everyFunc,
+		rawArgs:  true,
+	})
+	schedule := &Cmd{
+		Name: "schedule",
+		Help: "manage scheduled commands",
+	}
+	schedule.AddCmd(&Cmd{
+		Name: "list",
+		Help: "list scheduled commands",
+		Func: s.scheduler.listFunc,
+	})
+	schedule.AddCmd(&Cmd{
+		Name:     "run",
+		Help:     "run a scheduled command now",
+		LongHelp: "usage: schedule run <id>\n\nRuns the command now, without changing its schedule.",
+		Func:     s.scheduler.runFunc,
+		rawArgs:  true,
+	})
+	schedule.AddCmd(&Cmd{
+		Name:     "cancel",
+		Help:     "cancel a scheduled command",
+		LongHelp: "usage: schedule cancel <id>",
+		Func:     s.scheduler.cancelFunc,
+		rawArgs:  true,
+	})
+	s.AddCmd(schedule)
+}
+
+// ScheduleAt runs the command line once at t, in the background. It
+// returns the ID of the job.
+func (s *Shell) ScheduleAt(t time.Time, line ...string) int {
+	sc := s.scheduler
+	job := sc.add(line, "at "+t.Format("15:04:05"), t)
+	go func() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			sc.remove(job.ID)
+			sc.run(job)
+		case <-job.stop:
+		}
+	}()
+	return job.ID
+}
+
+// ScheduleEvery runs the command line every interval, in the background,
+// until the job is cancelled. It returns the ID of the job.
+func (s *Shell) ScheduleEvery(interval time.Duration, line ...string) (int, error) {
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid interval %s", interval)
+	}
+	sc := s.scheduler
+	job := sc.add(line, "every "+interval.String(), time.Now().Add(interval))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case t := <-ticker.C:
+				sc.Lock()
+				job.Next = t.Add(interval)
+				sc.Unlock()
+				sc.run(job)
+			case <-job.stop:
+				return
+			}
+		}
+	}()
+	return job.ID, nil
+}
+
+// ScheduledJobs returns the jobs waiting to run, ordered by ID.
+func (s *Shell) ScheduledJobs() []ScheduledJob {
+	sc := s.scheduler
+	sc.Lock()
+	jobs := make([]ScheduledJob, 0, len(sc.jobs))
+	for _, job := range sc.jobs {
+		jobs = append(jobs, job.ScheduledJob)
+	}
+	sc.Unlock()
+	for i := range jobs {
+		jobs[i].Line = append([]string(nil), s.redactSecrets(jobs[i].Line)...)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// RunScheduled runs the job with id now and waits for it, without
+// changing its schedule.
+func (s *Shell) RunScheduled(id int) error {
+	sc := s.scheduler
+	sc.Lock()
+	job, ok := sc.jobs[id]
+	sc.Unlock()
+	if !ok {
+		return fmt.Errorf("no scheduled command %d", id)
+	}
+	sc.run(job)
+	return nil
+}
+
+// CancelScheduled cancels the job with id.
+func (s *Shell) CancelScheduled(id int) error {
+	job := s.scheduler.remove(id)
+	if job == nil {
+		return fmt.Errorf("no scheduled command %d", id)
+	}
+	close(job.stop)
+	return nil
+}
+
+// nextTimeOfDay returns the next time after now at the time of day in
+// value, formatted as 15:04 or 15:04:05.
+func nextTimeOfDay(value string, now time.Time) (time.Time, error) {
+	var t time.Time
+	var err error
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err = time.Parse(layout, value); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return t, fmt.Errorf("invalid time of day %s", value)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+func (sc *scheduler) atFunc(c *Context) {
+	if len(c.Args) < 2 {
+		c.Err(fmt.Errorf("usage: at <HH:MM[:SS]> <command...>"))
+		return
+	}
+	next, err := nextTimeOfDay(c.Args[0], time.Now())
+	if err != nil {
+		c.Err(err)
+		return
+	}
+	id := sc.shell.ScheduleAt(next, c.Args[1:]...)
+	c.Printf("[%d] scheduled at %s\n", id, next.Format(time.RFC1123))
+}
+
+func (sc *scheduler) everyFunc(c *Context) {
+	if len(c.Args) < 2 {
+		c.Err(fmt.Errorf("usage: every <interval> <command...>"))
+		return
+	}
+	interval, err := time.ParseDuration(c.Args[0])
+	if err != nil || interval <= 0 {
+		c.Err(fmt.Errorf("invalid interval %s", c.Args[0]))
+		return
+	}
+	id, err := sc.shell.ScheduleEvery(interval, c.Args[1:]...)
+	if err != nil {
+		c.Err(err)
+		return
+	}
+	c.Printf("[%d] scheduled every %s\n", id, interval)
+}
+
+func (sc *scheduler) listFunc(c *Context) {
+	w := tabwriter.NewWriter(c.Writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSCHEDULE\tNEXT RUN\tCOMMAND")
+	for _, job := range sc.shell.ScheduledJobs() {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", job.ID, job.When, job.Next.Format(time.RFC1123), strings.Join(job.Line, " "))
+	}
+	c.Err(w.Flush())
+}
+
+// jobID parses the id argument of the schedule commands.
+func jobID(args []string, usage string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("usage: %s", usage)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %s", args[0])
+	}
+	return id, nil
+}
+
+func (sc *scheduler) runFunc(c *Context) {
+	id, err := jobID(c.Args, "schedule run <id>")
+	if err != nil {
+		c.Err(err)
+		return
+	}
+	c.Err(sc.shell.RunScheduled(id))
+}
+
+func (sc *scheduler) cancelFunc(c *Context) {
+	id, err := jobID(c.Args, "schedule cancel <id>")
+	if err != nil {
+		c.Err(err)
+		return
+	}
+	if err := sc.shell.CancelScheduled(id); err != nil {
+		c.Err(err)
+		return
+	}
+	c.Printf("[%d] cancelled\n", id)
+}
+
+func (sc *scheduler) add(line []string, when string, next time.Time) *scheduledJob {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.nextID++
+	job := &scheduledJob{
+		ScheduledJob: ScheduledJob{
+			ID:   sc.nextID,
+			Line: append([]string(nil), line...),
+			When: when,
+			Next: next,
+		},
+		stop: make(chan struct{}),
+	}
+	sc.jobs[job.ID] = job
+	return job
+}
+
+func (sc *scheduler) remove(id int) *scheduledJob {
+	sc.Lock()
+	defer sc.Unlock()
+	job := sc.jobs[id]
+	delete(sc.jobs, id)
+	return job
+}
+
+// run runs the job's command line and prints its output at once.
+func (sc *scheduler) run(job *scheduledJob) {
+	s := sc.shell
+	out := newCaptureBuffer(s.captureLimit, s.captureSpill)
+	defer out.Close()
+	fmt.Fprintf(out, "[%d] %s\n", job.ID, strings.Join(s.redactSecrets(job.Line), " "))
+
+	actions := &shellActionsImpl{Shell: s, output: out}
+	release := s.acquireCommandSlot()
+	if err := handleInputWith(s, actions, job.Line); err != nil {
+		s.reportError(actions, job.Line, err)
+	}
+	release()
+	sc.outMu.Lock()
+	defer sc.outMu.Unlock()
+	out.WriteTo(s.backgroundWriter())
+}
+
+// backgroundWriter returns the writer for output of commands running in
+// the background. While the shell reads input, output is printed above
+// the prompt.
+func (s *Shell) backgroundWriter() io.Writer {
+	s.reader.scannerMutex.Lock()
+	defer s.reader.scannerMutex.Unlock()
+	if s.reader.scanner != nil && s.Active() && s.outWriter == s.reader.scanner.Config.Stdout {
+		return s.reader.scanner
+	}
+	return s.writer
+}
@@ -0,0 +1,112 @@
+package ishell
+
+import (
+	"strings"
+	"sync"
+)
+
+// scopeStack holds the paths of the commands entered with Cmd.Subshell,
+// innermost last.
+type scopeStack struct {
+	paths [][]string
+	sync.Mutex
+}
+
+// Scope returns the path of the command entered with Cmd.Subshell, e.g.
+// []string{"config"}, or nil at the top level.
+func (s *Shell) Scope() []string {
+	s.scopes.Lock()
+	defer s.scopes.Unlock()
+	if len(s.scopes.paths) == 0 {
+		return nil
+	}
+	return s.scopes.paths[len(s.scopes.paths)-1]
+}
+
+// enterScope makes path the scope of the input, see Cmd.Subshell.
+func (s *Shell) enterScope(path []string) {
+	s.scopes.Lock()
+	s.scopes.paths = append(s.scopes.paths, path)
+	s.scopes.Unlock()
+	s.updateScopePrompt()
+}
+
+// leaveScope returns to the scope entered before the current one.
+func (s *Shell) leaveScope() {
+	s.scopes.Lock()
+	if len(s.scopes.paths) > 0 {
+		s.scopes.paths = s.scopes.paths[:len(s.scopes.paths)-1]
+	}
+	s.scopes.Unlock()
+	s.updateScopePrompt()
+}
+
+func (s *Shell) updateScopePrompt() {
+	s.reader.scope = strings.Join(s.Scope(), " ")
+	s.reader.updatePrompt()
+}
+
+// scopeInput returns line as run from the top level, see inScope. It
+// reports false for ".." and "exit" in a scope, which leave it.
+func (s *Shell) scopeInput(line []string) ([]string, bool) {
+	if len(line) == 0 {
+		return line, true
+	}
+	if len(s.Scope()) > 0 && len(line) == 1 && (line[0] == ".." || line[0] == "exit") {
+		s.leaveScope()
+		return nil, false
+	}
+	return s.inScope(line), true
+}
+
+// inScope returns words as run from the top level: prefixed with the
+// scope if that names a command below it, or else as they are, e.g. for
+// top level commands.
+func (s *Shell) inScope(words []string) []string {
+	scope := s.Scope()
+	if len(scope) == 0 {
+		return words
+	}
+	scoped := append(scope[:len(scope):len(scope)], words...)
+	if len(words) > 0 {
+		if _, n := s.rootCmd.findPath(scoped); n <= len(scope) {
+			return words
+		}
+	}
+	return scoped
+}
+
+// enterSubshell enters the command that line runs if it is a Cmd.Subshell
+// without arguments, reporting whether it did.
+func (s *Shell) enterSubshell(line []string) bool {
+	path, n := s.rootCmd.findPath(line)
+	if n == 0 || n != len(line) || !path[len(path)-1].Subshell {
+		return false
+	}
+	names := make([]string, len(path))
+	for i, cmd := range path {
+		if disabled, _ := cmd.Disabled(); disabled {
+			return false
+		}
+		names[i] = cmd.Name
+	}
+	s.enterScope(names)
+	return true
+}
+
+// FindCmd finds the command that args run when typed at the prompt, in the
+// scope of the command entered with Cmd.Subshell, if any. It returns the
+// Cmd and the remaining args, see Cmd.FindCmd.
+func (s *Shell) FindCmd(args []string) (*Cmd, []string) {
+	return s.rootCmd.FindCmd(s.inScope(args))
+}
+
+// scopedPrompt returns prompt showing scope before its trailing marker,
+// e.g. "app(config)> " for "app> ".
+func scopedPrompt(prompt, scope string) string {
+	if scope == "" {
+		return prompt
+	}
+	base := strings.TrimRight(prompt, " >$#")
+	return base + "(" + scope + ")" + prompt[len(base):]
+}
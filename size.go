@@ -0,0 +1,55 @@
+package ishell
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the multipliers of the units accepted by SizeType. Single
+// letters and the "iB" units are powers of 1024, the "B" units powers of
+// 1000, as in "512K", "10MB" and "2GiB".
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kib": 1 << 10,
+	"kb":  1e3,
+	"m":   1 << 20,
+	"mib": 1 << 20,
+	"mb":  1e6,
+	"g":   1 << 30,
+	"gib": 1 << 30,
+	"gb":  1e9,
+	"t":   1 << 40,
+	"tib": 1 << 40,
+	"tb":  1e12,
+	"p":   1 << 50,
+	"pib": 1 << 50,
+	"pb":  1e15,
+}
+
+// parse_size converts a size such as "512K" or "1.5GB" to a number of bytes
+func parse_size(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i == -1 {
+		i = len(value)
+	}
+	n, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a valid size", value)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("%s has an unknown unit %s", value, value[i:])
+	}
+	size := n * unit
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("%s is too large", value)
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,76 @@
+package ishell
+
+import (
+	"sort"
+	"strings"
+)
+
+// suggestDistance is the largest edit distance of a command name suggested
+// for an unknown one.
+const suggestDistance = 2
+
+// suggest returns the names of the subcommands whose name or an alias is
+// close to name, closest first, for "did you mean" messages. Deprecated
+// commands are not suggested.
+func (c *Cmd) suggest(name string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	var found []suggestion
+	for _, cmd := range append(c.added(), c.provided()...) {
+		if cmd.Deprecated {
+			continue
+		}
+		best := -1
+		for _, n := range append([]string{cmd.Name}, cmd.Aliases...) {
+			d := levenshtein(strings.ToLower(name), strings.ToLower(n))
+			// a distance as long as the name would suggest anything short
+			if d <= suggestDistance && d < len(n) && (best < 0 || d < best) {
+				best = d
+			}
+		}
+		if best >= 0 {
+			found = append(found, suggestion{cmd.Name, best})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].name < found[j].name
+	})
+	names := make([]string, len(found))
+	for i, s := range found {
+		names[i] = s.name
+	}
+	return names
+}
+
+// levenshtein returns the number of single rune insertions, deletions and
+// substitutions that turn a into b. Swapping two adjacent runes counts as
+// one edit, since it is a common typo, e.g. "lsit" for "list".
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
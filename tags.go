@@ -0,0 +1,96 @@
+package ishell
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// HasTag tells if tag is one of the Tags of the command.
+func (c *Cmd) HasTag(tag string) bool {
+	return has_name(c.Tags, tag, false)
+}
+
+// taggedChildren returns the names of the subcommands of c that have one
+// of tags, or have a command below them that has one, in one Walk.
+func (c *Cmd) taggedChildren(tags []string) map[string]bool {
+	names := make(map[string]bool)
+	c.Walk(func(path []string, cmd *Cmd) error {
+		if len(path) == 0 {
+			return nil
+		}
+		if names[path[0]] {
+			return SkipCmd
+		}
+		for _, tag := range tags {
+			if cmd.HasTag(tag) {
+				names[path[0]] = true
+				return SkipCmd
+			}
+		}
+		return nil
+	})
+	return names
+}
+
+// CommandsByTag returns the commands of the shell tagged with tag, in the
+// order of Walk. A command added below several commands is returned for
+// each of them.
+func (s *Shell) CommandsByTag(tag string) []*Cmd {
+	var cmds []*Cmd
+	s.walkTag(tag, func(path []string, cmd *Cmd) {
+		cmds = append(cmds, cmd)
+	})
+	return cmds
+}
+
+// walkTag calls f for the commands of the shell tagged with tag, with the
+// words that run them.
+func (s *Shell) walkTag(tag string, f func(path []string, cmd *Cmd)) {
+	s.Walk(func(path []string, cmd *Cmd) error {
+		if cmd.HasTag(tag) {
+			f(path, cmd)
+		}
+		return nil
+	})
+}
+
+// tagFilter holds the tags completion is restricted to.
+type tagFilter struct {
+	tags []string
+	sync.RWMutex
+}
+
+// SetCompletionTags restricts the completion of command names to the
+// commands that have one of tags, or have a subcommand that has one, e.g.
+// to focus a large shell on one area. Without tags, every command is
+// completed again.
+func (s *Shell) SetCompletionTags(tags ...string) {
+	s.completionTags.Lock()
+	defer s.completionTags.Unlock()
+	s.completionTags.tags = tags
+}
+
+func (s *Shell) getCompletionTags() []string {
+	s.completionTags.RLock()
+	defer s.completionTags.RUnlock()
+	return s.completionTags.tags
+}
+
+// helpTagFunc lists the commands tagged with tag, for "help --tag".
+func (s *Shell) helpTagFunc(c *Context, tag string) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	found := false
+	s.walkTag(tag, func(path []string, cmd *Cmd) {
+		found = true
+		fmt.Fprintf(w, "%s\t%s\n", strings.Join(path, " "), cmd.Help)
+	})
+	if !found {
+		c.Err(fmt.Errorf("no commands tagged '%s'", tag))
+		return
+	}
+	w.Flush()
+	c.Print(b.String())
+}
@@ -0,0 +1,236 @@
+package ishell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Task is the state of a command run in the background, see Cmd.Async.
+type Task struct {
+	// ID identifies the task in the tasks command.
+	ID int
+	// Line is the command line that started the task, with the values of
+	// secret arguments redacted.
+	Line []string
+	// Started and Ended are when the task started and ended, Ended being
+	// zero while it runs.
+	Started time.Time
+	Ended   time.Time
+	// Err is the error of the command once it ended.
+	Err error
+	// Output is what the command printed so far.
+	Output string
+}
+
+// Status returns "running", "done", "failed" or "cancelled".
+func (t Task) Status() string {
+	switch {
+	case t.Ended.IsZero():
+		return "running"
+	case errors.Is(t.Err, context.Canceled):
+		return "cancelled"
+	case t.Err != nil:
+		return "failed"
+	}
+	return "done"
+}
+
+// task is a running or ended Task.
+type task struct {
+	Task
+	out    *captureBuffer
+	cancel context.CancelFunc
+	sync.Mutex
+}
+
+// Write collects the output of the task.
+func (t *task) Write(p []byte) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+	return t.out.Write(p)
+}
+
+func (t *task) snapshot() Task {
+	t.Lock()
+	defer t.Unlock()
+	info := t.Task
+	info.Output = t.out.String()
+	return info
+}
+
+type taskList struct {
+	tasks  map[int]*task
+	nextID int
+	sync.Mutex
+}
+
+// startTask runs f for c in the background as a new task, see Cmd.Async.
+func (s *Shell) startTask(f func(*Context), c *Context, line []string, timeout time.Duration) *task {
+	ctx, cancel := context.WithCancel(c.Context())
+	t := &task{
+		Task:   Task{Line: append([]string(nil), s.redactSecrets(line)...), Started: time.Now()},
+		out:    newCaptureBuffer(s.captureLimit, s.captureSpill),
+		cancel: cancel,
+	}
+	s.tasks.Lock()
+	if s.tasks.tasks == nil {
+		s.tasks.tasks = make(map[int]*task)
+	}
+	s.tasks.nextID++
+	t.ID = s.tasks.nextID
+	s.tasks.tasks[t.ID] = t
+	s.tasks.Unlock()
+
+	c.ctx = ctx
+	c.Actions = &shellActionsImpl{Shell: s, output: t}
+	// no command slot is taken, so the tasks commands can always run
+	go func() {
+		var err error
+		if timeout > 0 {
+			err = s.callWithTimeout(f, c, line, timeout)
+		} else {
+			err = s.call(f, c, line)
+		}
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		cancel()
+		t.Lock()
+		t.Ended, t.Err = time.Now(), err
+		status := t.Status()
+		t.Unlock()
+		if status == "failed" {
+			fmt.Fprintf(s.backgroundWriter(), "[%d] failed: %v\n", t.ID, err)
+		} else {
+			fmt.Fprintf(s.backgroundWriter(), "[%d] %s\n", t.ID, status)
+		}
+	}()
+	return t
+}
+
+// Tasks returns the commands run in the background, see Cmd.Async, in
+// the order they started. Ended tasks are kept until "tasks clear".
+func (s *Shell) Tasks() []Task {
+	s.tasks.Lock()
+	tasks := make([]*task, 0, len(s.tasks.tasks))
+	for _, t := range s.tasks.tasks {
+		tasks = append(tasks, t)
+	}
+	s.tasks.Unlock()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	infos := make([]Task, len(tasks))
+	for i, t := range tasks {
+		infos[i] = t.snapshot()
+	}
+	return infos
+}
+
+func (s *Shell) task(arg []string, usage string) (*task, error) {
+	if len(arg) != 1 {
+		return nil, fmt.Errorf("usage: %s", usage)
+	}
+	id, err := strconv.Atoi(arg[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid id %s", arg[0])
+	}
+	s.tasks.Lock()
+	defer s.tasks.Unlock()
+	t, ok := s.tasks.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("no task %d", id)
+	}
+	return t, nil
+}
+
+// EnableTasks adds a command to manage the commands run in the background
+// with Cmd.Async:
+//
+//	tasks list
+//	tasks output 2
+//	tasks cancel 2
+//	tasks clear
+func (s *Shell) EnableTasks() {
+	if _, ok := s.rootCmd.child("tasks"); ok {
+		return
+	}
+	tasks := &Cmd{
+		Name: "tasks",
+		Help: "manage commands running in the background",
+	}
+	tasks.AddCmd(&Cmd{
+		Name: "list",
+		Help: "list background commands",
+		Func: s.tasksListFunc,
+	})
+	tasks.AddCmd(&Cmd{
+		Name:     "output",
+		Help:     "show the output of a background command",
+		LongHelp: "usage: tasks output <id>",
+		Func:     s.tasksOutputFunc,
+		rawArgs:  true,
+	})
+	tasks.AddCmd(&Cmd{
+		Name:     "cancel",
+		Help:     "cancel a background command",
+		LongHelp: "usage: tasks cancel <id>\n\nCancels the context of the command, see Context.Context.",
+		Func:     s.tasksCancelFunc,
+		rawArgs:  true,
+	})
+	tasks.AddCmd(&Cmd{
+		Name: "clear",
+		Help: "forget background commands that ended",
+		Func: s.tasksClearFunc,
+	})
+	s.AddCmd(tasks)
+}
+
+func (s *Shell) tasksListFunc(c *Context) {
+	w := tabwriter.NewWriter(c.Writer(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tSTARTED\tCOMMAND")
+	for _, t := range s.Tasks() {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.Status(), t.Started.Format(time.RFC1123), strings.Join(t.Line, " "))
+	}
+	c.Err(w.Flush())
+}
+
+func (s *Shell) tasksOutputFunc(c *Context) {
+	t, err := s.task(c.Args, "tasks output <id>")
+	if err != nil {
+		c.Err(err)
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	_, err = t.out.WriteTo(c.Writer())
+	c.Err(err)
+}
+
+func (s *Shell) tasksCancelFunc(c *Context) {
+	t, err := s.task(c.Args, "tasks cancel <id>")
+	if err != nil {
+		c.Err(err)
+		return
+	}
+	t.cancel()
+}
+
+func (s *Shell) tasksClearFunc(c *Context) {
+	s.tasks.Lock()
+	defer s.tasks.Unlock()
+	for id, t := range s.tasks.tasks {
+		t.Lock()
+		ended := !t.Ended.IsZero()
+		t.Unlock()
+		if ended {
+			t.out.Close()
+			delete(s.tasks.tasks, id)
+		}
+	}
+}
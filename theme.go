@@ -0,0 +1,131 @@
+package ishell
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// Theme is a set of named styles used for the output of the shell. A nil
+// style leaves the text as is. Colors are disabled automatically when the
+// output is not a terminal, see color.NoColor.
+type Theme struct {
+	// Name identifies the theme, e.g. for "config set theme <name>".
+	Name string
+	// Prompt styles the prompt and the multiline prompt.
+	Prompt *color.Color
+	// Command styles command names in help.
+	Command *color.Color
+	// Flag styles flags and arguments in help.
+	Flag *color.Color
+	// Heading styles section headings in help.
+	Heading *color.Color
+	// Error styles error messages.
+	Error *color.Color
+	// Warning styles warnings.
+	Warning *color.Color
+	// Selection styles the highlighted option of MultiChoice and Checklist.
+	Selection *color.Color
+}
+
+var (
+	// PlainTheme uses no styles at all.
+	PlainTheme = &Theme{Name: "plain"}
+
+	// DefaultTheme is the theme of new shells.
+	DefaultTheme = &Theme{
+		Name:      "default",
+		Selection: color.New(color.FgCyan, color.Bold),
+	}
+
+	// ColorfulTheme styles every part of the output.
+	ColorfulTheme = &Theme{
+		Name:      "colorful",
+		Prompt:    color.New(color.FgGreen, color.Bold),
+		Command:   color.New(color.FgCyan),
+		Flag:      color.New(color.FgYellow),
+		Heading:   color.New(color.Bold, color.Underline),
+		Error:     color.New(color.FgRed, color.Bold),
+		Warning:   color.New(color.FgYellow),
+		Selection: color.New(color.FgCyan, color.Bold),
+	}
+)
+
+var (
+	themes = map[string]*Theme{
+		PlainTheme.Name:    PlainTheme,
+		DefaultTheme.Name:  DefaultTheme,
+		ColorfulTheme.Name: ColorfulTheme,
+	}
+	themesMutex sync.RWMutex
+)
+
+// RegisterTheme makes t available to Shell.SetThemeByName and the "theme"
+// config key, replacing a theme with the same name.
+func RegisterTheme(t *Theme) {
+	themesMutex.Lock()
+	defer themesMutex.Unlock()
+	themes[t.Name] = t
+}
+
+// Themes returns the names of the registered themes in alphabetical order.
+func Themes() []string {
+	themesMutex.RLock()
+	defer themesMutex.RUnlock()
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// styled renders a with style, or plainly if style is nil.
+func styled(style *color.Color, a ...interface{}) string {
+	if style == nil {
+		return fmt.Sprint(a...)
+	}
+	return style.Sprint(a...)
+}
+
+// SetTheme sets the theme used for the prompt, help, errors and warnings.
+// A nil theme is the same as PlainTheme.
+func (s *Shell) SetTheme(t *Theme) {
+	if t == nil {
+		t = PlainTheme
+	}
+	s.themeMutex.Lock()
+	s.theme = t
+	s.themeMutex.Unlock()
+
+	s.reader.Lock()
+	s.reader.promptColor = t.Prompt
+	s.reader.Unlock()
+	s.reader.updatePrompt()
+}
+
+// SetThemeByName sets the registered theme called name.
+func (s *Shell) SetThemeByName(name string) error {
+	themesMutex.RLock()
+	t, ok := themes[name]
+	themesMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown theme %s", name)
+	}
+	s.SetTheme(t)
+	return nil
+}
+
+// Theme returns the current theme of the shell.
+func (s *Shell) Theme() *Theme {
+	s.themeMutex.RLock()
+	defer s.themeMutex.RUnlock()
+	return s.theme
+}
+
+// printError prints err styled with the theme.
+func (s *Shell) printError(err error) {
+	s.Println(styled(s.Theme().Error, "Error: "+err.Error()))
+}
@@ -0,0 +1,103 @@
+package ishell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is the error of a command that ran longer than its Timeout.
+var ErrTimeout = errors.New("command timed out")
+
+// callWithTimeout is call that gives up on f after timeout, cancelling the
+// context of c. f keeps running in the background until it returns, so it
+// should watch c.Context(). What it prints after the timeout is discarded.
+func (s *Shell) callWithTimeout(f func(*Context), c *Context, line []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+	c.ctx = ctx
+	actions := &timedActions{Actions: c.Actions}
+	c.Actions = actions
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.call(f, c, line)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		actions.expire()
+		return fmt.Errorf("%w after %v", ErrTimeout, timeout)
+	}
+}
+
+// timedActions are the Actions of a command with a Timeout. Once the
+// shell stops waiting for the command, its output is discarded.
+type timedActions struct {
+	Actions
+	mu      sync.RWMutex
+	expired bool
+}
+
+func (a *timedActions) expire() {
+	a.mu.Lock()
+	a.expired = true
+	a.mu.Unlock()
+}
+
+// output calls f unless the command timed out.
+func (a *timedActions) output(f func()) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.expired {
+		f()
+	}
+}
+
+func (a *timedActions) Println(val ...interface{}) {
+	a.output(func() { a.Actions.Println(val...) })
+}
+
+func (a *timedActions) Print(val ...interface{}) {
+	a.output(func() { a.Actions.Print(val...) })
+}
+
+func (a *timedActions) Printf(format string, val ...interface{}) {
+	a.output(func() { a.Actions.Printf(format, val...) })
+}
+
+func (a *timedActions) Errorln(val ...interface{}) {
+	a.output(func() { errorln(a.Actions, val...) })
+}
+
+func (a *timedActions) Warnln(val ...interface{}) {
+	a.output(func() { warnln(a.Actions, val...) })
+}
+
+func (a *timedActions) Flush() error {
+	if o, ok := a.Actions.(OutputActions); ok {
+		return o.Flush()
+	}
+	return nil
+}
+
+func (a *timedActions) ShowPaged(text string) error {
+	return a.ShowPagedReader(strings.NewReader(text))
+}
+
+// ShowPagedReader does not hold the lock while paging, as the pager waits
+// for the user.
+func (a *timedActions) ShowPagedReader(r io.Reader) error {
+	a.mu.RLock()
+	expired := a.expired
+	a.mu.RUnlock()
+	if expired {
+		return nil
+	}
+	return a.Actions.ShowPagedReader(r)
+}
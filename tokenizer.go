@@ -0,0 +1,222 @@
+package ishell
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// endOfFlags ends flag parsing, the arguments after it are positional.
+const endOfFlags = "--"
+
+// ErrUnclosedQuote is returned by SplitArgs for a line with a quote that is
+// not closed.
+var ErrUnclosedQuote = errors.New("unclosed quote")
+
+// SplitArgs splits line into arguments the way a shell does, e.g.
+//
+//	add --name "John Smith" --path my\ files 'a "quoted" word'
+//
+// Single quotes keep everything up to the closing quote as is. Outside
+// quotes a backslash escapes the next character, inside double quotes only
+// ", \, $ and `. A backslash before a newline joins the lines. The shell
+// splits its input with SplitArgs before ParseArgs.
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`\n", r) {
+				arg.WriteRune('\\')
+			}
+			if r != '\n' {
+				arg.WriteRune(r)
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, ErrUnclosedQuote
+	}
+	if escaped {
+		arg.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// joinArgs joins args into a line that SplitArgs splits into args again,
+// quoting the arguments that need it.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shortFlags holds the single character flags "-a", "-b", ... for every
+// ASCII character so that splitting grouped flags does not allocate.
+var shortFlags [utf8.RuneSelf]string
+
+func init() {
+	for i := range shortFlags {
+		shortFlags[i] = "-" + string(rune(i))
+	}
+}
+
+// tokenizer splits command arguments into the tokens understood by
+// ParseArgs. Its buffer is reused between calls, so the result of split is
+// only valid until the next call.
+type tokenizer struct {
+	buf []string
+	// origin holds the index in args of the argument each token came from.
+	origin []int
+}
+
+var tokenizers = sync.Pool{
+	New: func() interface{} {
+		return &tokenizer{buf: make([]string, 0, 16), origin: make([]int, 0, 16)}
+	},
+}
+
+// getTokenizer returns a tokenizer from the pool. Return it with release.
+func getTokenizer() *tokenizer {
+	return tokenizers.Get().(*tokenizer)
+}
+
+// release clears references to the last tokens and puts t back in the pool.
+func (t *tokenizer) release() {
+	for i := range t.buf {
+		t.buf[i] = ""
+	}
+	t.buf = t.buf[:0]
+	t.origin = t.origin[:0]
+	tokenizers.Put(t)
+}
+
+// split expands args into t's buffer and returns it, see appendSplitArg.
+// Arguments after the end of flags "--" are not split. A "--" that is the
+// value of the flag before it does not end the flags. Negative numbers are
+// split only if every digit is a short flag that isDeclared and no flag
+// value is expected, so "-12" can group "-1" and "-2".
+func (t *tokenizer) split(args []string, takesValue, isDeclared func(flag string) bool) []string {
+	t.buf = t.buf[:0]
+	t.origin = t.origin[:0]
+	awaiting_value := false
+	for i, arg := range args {
+		if arg == endOfFlags && !awaiting_value {
+			t.buf = append(t.buf, args[i:]...)
+			for j := i; j < len(args); j++ {
+				t.origin = append(t.origin, j)
+			}
+			break
+		}
+		if is_negative_number(arg) && (awaiting_value || !declared_group(arg, isDeclared)) {
+			t.buf = append(t.buf, arg)
+		} else {
+			t.buf = appendSplitArg(t.buf, arg, takesValue)
+		}
+		last := t.buf[len(t.buf)-1]
+		awaiting_value = is_short_arg(last) && !is_negative_number(last) && takesValue != nil && takesValue(last)
+		for len(t.origin) < len(t.buf) {
+			t.origin = append(t.origin, i)
+		}
+	}
+	return t.buf
+}
+
+// unsplit returns the token at k and the ones following it as they were
+// given in args, i.e. with grouped flags in one piece, and the index in args
+// of each. If the token is not the first of its group, the rest of the group
+// stays split.
+func (t *tokenizer) unsplit(args []string, k int) ([]string, []int) {
+	start := t.origin[k]
+	var ret []string
+	var origin []int
+	if k > 0 && t.origin[k-1] == start {
+		for j := k; j < len(t.buf) && t.origin[j] == start; j++ {
+			ret = append(ret, t.buf[j])
+			origin = append(origin, start)
+		}
+		start++
+	}
+	for i := start; i < len(args); i++ {
+		origin = append(origin, i)
+	}
+	return append(ret, args[start:]...), origin
+}
+
+// appendSplitArg appends arg to dst, splitting grouped short flags such as
+// "-yz" into "-y" and "-z", and returns the extended slice. If takesValue
+// reports that a flag takes a value, the rest of the group is its value, so
+// "-n5" becomes "-n" and "5".
+func appendSplitArg(dst []string, arg string, takesValue func(flag string) bool) []string {
+	if !is_short_arg(arg) || is_long_arg(arg) || len(arg) <= 2 {
+		return append(dst, arg)
+	}
+	for i, char := range arg[1:] {
+		var flag string
+		if char < utf8.RuneSelf {
+			flag = shortFlags[char]
+		} else {
+			flag = "-" + string(char)
+		}
+		dst = append(dst, flag)
+		rest := arg[1+i+utf8.RuneLen(char):]
+		if rest != "" && takesValue != nil && takesValue(flag) {
+			return append(dst, rest)
+		}
+	}
+	return dst
+}
+
+// declared_group tells if every character of the group of short flags in
+// arg is a flag that isDeclared.
+func declared_group(arg string, isDeclared func(flag string) bool) bool {
+	if isDeclared == nil {
+		return false
+	}
+	for _, char := range arg[1:] {
+		if char >= utf8.RuneSelf || !isDeclared(shortFlags[char]) {
+			return false
+		}
+	}
+	return true
+}
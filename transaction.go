@@ -0,0 +1,124 @@
+package ishell
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrNoTransaction is returned when committing or rolling back without
+	// a transaction in progress.
+	ErrNoTransaction = errors.New("no transaction in progress")
+	// ErrTransactionInProgress is returned when beginning a transaction
+	// while another one is in progress.
+	ErrTransactionInProgress = errors.New("a transaction is already in progress")
+)
+
+// transaction collects the staged effects and compensations of the
+// commands run between begin and commit.
+type transaction struct {
+	staged        []func() error
+	compensations []func() error
+	sync.Mutex
+}
+
+// EnableTransactions adds the begin, commit and rollback commands, see
+// Shell.Begin.
+func (s *Shell) EnableTransactions() {
+	s.AddCmd(&Cmd{
+		Name: "begin",
+		Help: "start a transaction",
+		Func: func(c *Context) { c.Err(s.Begin()) },
+	})
+	s.AddCmd(&Cmd{
+		Name: "commit",
+		Help: "apply the commands since begin",
+		Func: func(c *Context) { c.Err(s.Commit()) },
+	})
+	s.AddCmd(&Cmd{
+		Name: "rollback",
+		Help: "undo the commands since begin",
+		Func: func(c *Context) { c.Err(s.Rollback()) },
+	})
+}
+
+// Begin starts a transaction. Until Commit or Rollback, commands stage
+// their effects with Context.OnCommit and register compensations with
+// Context.OnRollback.
+func (s *Shell) Begin() error {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	if s.tx != nil {
+		return ErrTransactionInProgress
+	}
+	s.tx = &transaction{}
+	return nil
+}
+
+// InTransaction reports whether a transaction is in progress.
+func (s *Shell) InTransaction() bool {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	return s.tx != nil
+}
+
+// endTransaction ends the transaction in progress and returns it.
+func (s *Shell) endTransaction() (*transaction, error) {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	tx := s.tx
+	if tx == nil {
+		return nil, ErrNoTransaction
+	}
+	s.tx = nil
+	return tx, nil
+}
+
+// Commit runs the staged effects in order. If one fails, the effects after
+// it are skipped, the compensations are run as by Rollback and the error is
+// returned. The effects that already ran are only undone as far as the
+// compensations undo them.
+func (s *Shell) Commit() error {
+	tx, err := s.endTransaction()
+	if err != nil {
+		return err
+	}
+	for _, f := range tx.staged {
+		if err := f(); err != nil {
+			if rerr := tx.rollback(); rerr != nil {
+				return fmt.Errorf("commit failed: %w, compensations failed: %w", err, rerr)
+			}
+			return fmt.Errorf("commit failed, compensations run: %w", err)
+		}
+	}
+	return nil
+}
+
+// Rollback discards the staged effects and runs the compensations in
+// reverse order of registration.
+func (s *Shell) Rollback() error {
+	tx, err := s.endTransaction()
+	if err != nil {
+		return err
+	}
+	return tx.rollback()
+}
+
+// rollback runs all compensations, returning the first error.
+func (tx *transaction) rollback() error {
+	var first error
+	for i := len(tx.compensations) - 1; i >= 0; i-- {
+		if err := tx.compensations[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// currentTransaction returns the transaction in progress, or nil.
+func (s *Shell) currentTransaction() *transaction {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	return s.tx
+}
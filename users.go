@@ -0,0 +1,154 @@
+package ishell
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UserStore keeps the state of each user of a shell separate, so that
+// users of a shared shell don't share or clobber each other's history and
+// values. It is used once a user authenticates, see SetAuthenticator.
+type UserStore interface {
+	// HistoryPath returns the history file of user, or an empty string
+	// to disable history.
+	HistoryPath(user string) string
+	// RC returns the command lines to run after user authenticates.
+	RC(user string) ([]string, error)
+	// LoadValues returns the shell values saved for user.
+	LoadValues(user string) (map[string]interface{}, error)
+	// SaveValues saves the shell values of user.
+	SaveValues(user string, values map[string]interface{}) error
+}
+
+// SetUserStore sets the store for per-user state.
+func (s *Shell) SetUserStore(store UserStore) {
+	s.userStore = store
+}
+
+// loadUser switches the shell to the state of the authenticated user.
+func (s *Shell) loadUser() error {
+	if s.userStore == nil {
+		return nil
+	}
+	if !s.Restricted(RestrictFiles) {
+		s.SetHistoryPath(s.userStore.HistoryPath(s.user))
+	}
+	values, err := s.userStore.LoadValues(s.user)
+	if err != nil {
+		return err
+	}
+	s.contextValues = values
+	lines, err := s.userStore.RC(s.user)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		args, err := SplitArgs(line)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := handleInput(s, args); err != nil {
+			s.printError(err)
+		}
+	}
+	return nil
+}
+
+// saveUser saves the values of the authenticated user.
+func (s *Shell) saveUser() error {
+	if s.userStore == nil || s.user == "" {
+		return nil
+	}
+	return s.userStore.SaveValues(s.user, s.contextValues)
+}
+
+// FileUserStore is a UserStore keeping each user's state in a directory
+// named after the user: the history in "history", the lines to run after
+// login in "rc" and the values as JSON in "values.json". Values are
+// restored as decoded by encoding/json, e.g. numbers as float64.
+type FileUserStore struct {
+	Dir string
+}
+
+func (f FileUserStore) userDir(user string) (string, error) {
+	if user == "" || user == "." || user == ".." || strings.ContainsAny(user, `/\`) {
+		return "", fmt.Errorf("invalid user name %q", user)
+	}
+	return filepath.Join(f.Dir, user), nil
+}
+
+// HistoryPath satisfies UserStore interface.
+func (f FileUserStore) HistoryPath(user string) string {
+	dir, err := f.userDir(user)
+	if err != nil || os.MkdirAll(dir, 0700) != nil {
+		return ""
+	}
+	return filepath.Join(dir, "history")
+}
+
+// RC satisfies UserStore interface. Empty lines and lines starting with
+// '#' are skipped.
+func (f FileUserStore) RC(user string) ([]string, error) {
+	dir, err := f.userDir(user)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(dir, "rc"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// LoadValues satisfies UserStore interface.
+func (f FileUserStore) LoadValues(user string) (map[string]interface{}, error) {
+	dir, err := f.userDir(user)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "values.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	err = json.Unmarshal(b, &values)
+	return values, err
+}
+
+// SaveValues satisfies UserStore interface.
+func (f FileUserStore) SaveValues(user string, values map[string]interface{}) error {
+	dir, err := f.userDir(user)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "values.json"), b, 0600)
+}
@@ -3,6 +3,9 @@
 package ishell
 
 import (
+	"os"
+	"syscall"
+
 	"github.com/abiosoft/readline"
 )
 
@@ -10,3 +13,37 @@ func clearScreen(s *Shell) error {
 	_, err := readline.ClearScreen(s.writer)
 	return err
 }
+
+// writable tells if the permission bits of info let the process write to
+// the file.
+func writable(info os.FileInfo) bool {
+	perm := info.Mode().Perm()
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return perm&0222 != 0
+	}
+	uid := os.Geteuid()
+	switch {
+	case uid == 0:
+		return true
+	case int(st.Uid) == uid:
+		return perm&0200 != 0
+	case in_group(int(st.Gid)):
+		return perm&0020 != 0
+	}
+	return perm&0002 != 0
+}
+
+// in_group tells if the process is a member of the group gid.
+func in_group(gid int) bool {
+	if os.Getegid() == gid {
+		return true
+	}
+	groups, _ := os.Getgroups()
+	for _, g := range groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
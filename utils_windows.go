@@ -3,9 +3,16 @@
 package ishell
 
 import (
+	"os"
+
 	"github.com/abiosoft/readline"
 )
 
 func clearScreen(s *Shell) error {
 	return readline.ClearScreen(s.writer)
 }
+
+// writable tells if the file is not read-only.
+func writable(info os.FileInfo) bool {
+	return info.Mode().Perm()&0200 != 0
+}
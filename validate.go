@@ -0,0 +1,85 @@
+package ishell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNameConflict is reported by Validate for a name or alias that more than
+// one subcommand of a command answers to. Which of them runs for the name
+// is then undefined.
+type ErrNameConflict struct {
+	// Path are the names of the commands down to the parent of the
+	// conflicting ones, empty for the subcommands of the command validated.
+	Path []string
+	// Name is the name or alias in conflict.
+	Name string
+	// Cmds are the names of the subcommands answering to Name, sorted.
+	Cmds []string
+}
+
+func (e *ErrNameConflict) Error() string {
+	quoted := make([]string, len(e.Cmds))
+	for i, name := range e.Cmds {
+		quoted[i] = "'" + name + "'"
+	}
+	msg := fmt.Sprintf("Name '%s' is used by commands %s", e.Name, strings.Join(quoted, " and "))
+	if len(e.Path) > 0 {
+		msg += fmt.Sprintf(" in '%s'", strings.Join(e.Path, " "))
+	}
+	return msg
+}
+
+// Validate checks c and every command below it for names and aliases that
+// more than one subcommand of the same command answers to, e.g. an alias
+// equal to the name of a sibling. AddCmd does not check this, as commands
+// can be added in any order. It returns nil, or every conflict found as an
+// *ErrNameConflict joined with errors.Join.
+func (c *Cmd) Validate() error {
+	var errs []error
+	c.validate(nil, false, &errs)
+	return errors.Join(errs...)
+}
+
+func (c *Cmd) validate(path []string, fold bool, errs *[]error) {
+	fold, _ = c.lookupSettings(fold, "")
+	children := c.Children()
+	var names []string
+	users := make(map[string][]string)
+	for _, cmd := range children {
+		seen := make(map[string]bool)
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			key := name
+			if fold {
+				key = strings.ToLower(name)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if users[key] == nil {
+				names = append(names, name)
+			}
+			users[key] = append(users[key], cmd.Name)
+		}
+	}
+	for _, name := range names {
+		key := name
+		if fold {
+			key = strings.ToLower(name)
+		}
+		if len(users[key]) > 1 {
+			*errs = append(*errs, &ErrNameConflict{Path: path, Name: name, Cmds: users[key]})
+		}
+	}
+	for _, cmd := range children {
+		cmd.validate(append(path[:len(path):len(path)], cmd.Name), fold, errs)
+	}
+}
+
+// Validate checks the commands of the shell for conflicting names and
+// aliases. See Cmd.Validate.
+func (s *Shell) Validate() error {
+	return s.rootCmd.Validate()
+}
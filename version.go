@@ -0,0 +1,67 @@
+package ishell
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/debug"
+	"text/tabwriter"
+)
+
+// SetVersion sets the version of the shell and adds a "version" command
+// showing it with the build information of the binary: module, commit and
+// Go version. "--version" as the whole input shows it too. An empty version
+// uses the version of the main module. A "version" command already added is
+// kept.
+func (s *Shell) SetVersion(version string) {
+	s.version = &version
+	if _, ok := s.rootCmd.child("version"); ok {
+		return
+	}
+	s.AddCmd(&Cmd{
+		Name: "version",
+		Help: "show version information",
+		Func: func(c *Context) {
+			c.Print(versionText(*s.version))
+		},
+	})
+}
+
+// versionText returns version followed by the build information of the
+// binary, if available.
+func versionText(version string) string {
+	info, ok := debug.ReadBuildInfo()
+	version = versionOrBuild(version)
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "version\t%s\n", version)
+	if ok {
+		if info.Main.Path != "" {
+			fmt.Fprintf(w, "module\t%s\n", info.Main.Path)
+		}
+		settings := make(map[string]string)
+		for _, setting := range info.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		if commit := settings["vcs.revision"]; commit != "" {
+			if settings["vcs.modified"] == "true" {
+				commit += " (modified)"
+			}
+			fmt.Fprintf(w, "commit\t%s\n", commit)
+		}
+		if built := settings["vcs.time"]; built != "" {
+			fmt.Fprintf(w, "built\t%s\n", built)
+		}
+		fmt.Fprintf(w, "go\t%s\n", info.GoVersion)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// versionOrBuild returns version, or the version of the main module if it
+// is empty.
+func versionOrBuild(version string) string {
+	if info, ok := debug.ReadBuildInfo(); ok && version == "" {
+		return info.Main.Version
+	}
+	return version
+}
@@ -0,0 +1,96 @@
+package ishell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/readline"
+)
+
+// EnableWatch adds the watch command, which runs a command line
+// repeatedly, showing its output full screen until a key is pressed:
+//
+//	watch status
+//	watch -n 0.5 queue stats
+func (s *Shell) EnableWatch() {
+	if _, ok := s.rootCmd.child("watch"); ok {
+		return
+	}
+	s.AddCmd(&Cmd{
+		Name:     "watch",
+		Help:     "run a command repeatedly",
+		LongHelp: "usage: watch [-n seconds] <command...>\n\nRuns the command every 2 seconds, or as given by -n, showing its\noutput full screen until a key is pressed.",
+		Func: func(c *Context) {
+			watchFunc(s, c)
+		},
+		rawArgs: true,
+	})
+}
+
+func watchFunc(s *Shell, c *Context) {
+	interval := 2 * time.Second
+	line := c.Args
+	if len(line) > 1 && line[0] == "-n" {
+		seconds, err := strconv.ParseFloat(line[1], 64)
+		if err != nil || seconds <= 0 {
+			c.Err(fmt.Errorf("invalid interval %s", line[1]))
+			return
+		}
+		interval = time.Duration(seconds * float64(time.Second))
+		line = line[2:]
+	}
+	if len(line) == 0 {
+		c.Err(fmt.Errorf("usage: watch [-n seconds] <command...>"))
+		return
+	}
+	if !s.Active() {
+		c.Err(fmt.Errorf("watch requires an interactive shell"))
+		return
+	}
+
+	// stop on any key press. The key is consumed by a pending read which
+	// is completed once the key is seen.
+	keyPressed := make(chan struct{}, 1)
+	scanner := s.reader.instance()
+	conf := scanner.Config.Clone()
+	conf.DisableAutoSaveHistory = true
+	conf.Listener = readline.FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		select {
+		case keyPressed <- struct{}{}:
+		default:
+		}
+		return nil, 0, false
+	})
+	oldconf := s.reader.setConfig(conf)
+	defer s.reader.setConfig(oldconf)
+
+	c.ShowPrompt(false)
+	defer c.ShowPrompt(true)
+	readDone := make(chan struct{})
+	go func() {
+		c.ReadLineErr()
+		close(readDone)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	header := fmt.Sprintf("Every %s: %s", interval, strings.Join(line, " "))
+	for {
+		c.ClearScreen()
+		c.Printf("%s\t%s\n\n", header, time.Now().Format(time.Stamp))
+		if err := handleInputWith(s, c.Actions, line); err != nil {
+			s.reportError(c.Actions, line, err)
+		}
+		select {
+		case <-ticker.C:
+			continue
+		case <-keyPressed:
+			scanner.WriteStdin([]byte("\n"))
+			<-readDone
+		case <-readDone:
+		}
+		return
+	}
+}